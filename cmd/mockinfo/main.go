@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"go.uber.org/zap"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"song-lib/internal/mockinfo"
+	"syscall"
+	"time"
+)
+
+func main() {
+	addr := flag.String("addr", ":8081", "address to listen on")
+	fixturesDir := flag.String("fixtures", "./cmd/mockinfo/fixtures", "directory with *.json song fixtures")
+	latency := flag.Duration("latency", 0, "delay added to every response")
+	notFoundRate := flag.Float64("not-found-rate", 0, "share of requests answered with 404 (0..1)")
+	errorRate := flag.Float64("error-rate", 0, "share of requests answered with 500 (0..1)")
+	malformedRate := flag.Float64("malformed-rate", 0, "share of requests answered with malformed JSON (0..1)")
+	flag.Parse()
+
+	logger, err := zap.NewProduction()
+	if err != nil {
+		log.Fatalf("failed to initialize logger: %v", err)
+	}
+	defer func(logger *zap.Logger) {
+		_ = logger.Sync()
+	}(logger)
+
+	sugar := logger.Sugar()
+
+	fixtures, err := mockinfo.LoadFixtures(*fixturesDir)
+	if err != nil {
+		sugar.Fatalw("failed to load fixtures", "dir", *fixturesDir, "error", err)
+	}
+
+	server := mockinfo.NewServer(fixtures, mockinfo.Faults{
+		Latency:       *latency,
+		NotFoundRate:  *notFoundRate,
+		ErrorRate:     *errorRate,
+		MalformedRate: *malformedRate,
+	})
+
+	mux := server.Handler()
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		mux.ServeHTTP(w, r)
+		sugar.Infow("request served", "uri", r.RequestURI, "latency", time.Since(start))
+	})
+	httpServer := &http.Server{Addr: *addr, Handler: handler}
+
+	sugar.Infow("starting mock info server", "addr", *addr, "fixtures", len(fixtures))
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+
+	go func() {
+		if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			sugar.Fatalw("failed to start server", "error", err)
+		}
+	}()
+
+	<-stop
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := httpServer.Shutdown(ctx); err != nil {
+		sugar.Fatalw("failed to gracefully shut down server", "error", err)
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"go.uber.org/zap"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"os/signal"
+	"song-lib/internal/auth"
+	"song-lib/internal/outbox"
+	"song-lib/internal/webhook"
+	"sync"
+	"syscall"
+	"time"
+)
+
+type delivery struct {
+	ReceivedAt time.Time       `json:"received_at"`
+	Path       string          `json:"path"`
+	DeliveryID string          `json:"delivery_id"`
+	EventID    string          `json:"event_id"`
+	EventType  string          `json:"event_type"`
+	Verified   bool            `json:"verified"`
+	Status     int             `json:"status"`
+	Body       json.RawMessage `json:"body"`
+}
+
+// mockreceiver is a webhook endpoint for trying /api/webhooks out locally:
+// it checks the signature of every delivery, can fail a share of them to
+// exercise retries, and lists what it received at GET /deliveries.
+func main() {
+	addr := flag.String("addr", ":8082", "address to listen on")
+	secret := flag.String("secret", "", "webhook secret; deliveries with a bad signature get 401, none are checked if empty")
+	tolerance := flag.Duration("tolerance", 5*time.Minute, "accepted age of the signature timestamp")
+	latency := flag.Duration("latency", 0, "delay added to every response")
+	errorRate := flag.Float64("error-rate", 0, "share of deliveries answered with 500 (0..1)")
+	keep := flag.Int("keep", 100, "number of recent deliveries listed at GET /deliveries")
+	flag.Parse()
+
+	logger, err := zap.NewProduction()
+	if err != nil {
+		log.Fatalf("failed to initialize logger: %v", err)
+	}
+	defer func(logger *zap.Logger) {
+		_ = logger.Sync()
+	}(logger)
+
+	sugar := logger.Sugar()
+
+	var (
+		mu       sync.Mutex
+		received []delivery
+	)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /deliveries", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(received)
+	})
+	mux.HandleFunc("POST /", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(*latency)
+
+		body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+		if err != nil {
+			http.Error(w, "failed to read body", http.StatusBadRequest)
+			return
+		}
+
+		d := delivery{
+			ReceivedAt: time.Now(),
+			Path:       r.URL.Path,
+			DeliveryID: r.Header.Get(webhook.HeaderDeliveryID),
+			EventID:    r.Header.Get(outbox.HeaderEventID),
+			EventType:  r.Header.Get(outbox.HeaderEventType),
+			Status:     http.StatusNoContent,
+		}
+		if json.Valid(body) {
+			d.Body = body
+		} else {
+			d.Body, _ = json.Marshal(string(body))
+		}
+		if *secret != "" {
+			d.Verified = auth.VerifyWebhook(*secret, r.Header.Get(webhook.HeaderSignature), body, *tolerance) == nil
+			if !d.Verified {
+				d.Status = http.StatusUnauthorized
+			}
+		}
+		if d.Status == http.StatusNoContent && rand.Float64() < *errorRate {
+			d.Status = http.StatusInternalServerError
+		}
+
+		mu.Lock()
+		received = append(received, d)
+		if len(received) > *keep {
+			received = received[len(received)-*keep:]
+		}
+		mu.Unlock()
+
+		sugar.Infow("delivery received", "deliveryID", d.DeliveryID, "eventID", d.EventID, "type", d.EventType,
+			"verified", d.Verified, "status", d.Status)
+		w.WriteHeader(d.Status)
+	})
+	httpServer := &http.Server{Addr: *addr, Handler: mux}
+
+	sugar.Infow("starting mock webhook receiver", "addr", *addr, "verify", *secret != "")
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+
+	go func() {
+		if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			sugar.Fatalw("failed to start server", "error", err)
+		}
+	}()
+
+	<-stop
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := httpServer.Shutdown(ctx); err != nil {
+		sugar.Fatalw("failed to gracefully shut down server", "error", err)
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"flag"
+	"github.com/alicebob/miniredis/v2"
+	"go.uber.org/zap"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// mockredis is an in-memory server speaking the Redis protocol, for running
+// the redis song cache store locally and in tests without a Redis install.
+func main() {
+	addr := flag.String("addr", "localhost:6379", "address to listen on")
+	password := flag.String("password", "", "password clients must AUTH with")
+	flag.Parse()
+
+	logger, err := zap.NewProduction()
+	if err != nil {
+		log.Fatalf("failed to initialize logger: %v", err)
+	}
+	defer func(logger *zap.Logger) {
+		_ = logger.Sync()
+	}(logger)
+
+	sugar := logger.Sugar()
+
+	server := miniredis.NewMiniRedis()
+	if *password != "" {
+		server.RequireAuth(*password)
+	}
+	if err := server.StartAddr(*addr); err != nil {
+		sugar.Fatalw("failed to start server", "error", err)
+	}
+	defer server.Close()
+
+	sugar.Infow("starting mock redis server", "addr", server.Addr())
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	<-stop
+}
@@ -2,31 +2,89 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
+	"flag"
 	"fmt"
+	"github.com/jmoiron/sqlx"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
+	"github.com/redis/go-redis/v9"
 	"github.com/swaggo/echo-swagger"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/labstack/echo/otelecho"
 	"go.uber.org/zap"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"song-lib/internal/audit"
+	"song-lib/internal/auth"
+	"song-lib/internal/cache"
 	"song-lib/internal/config"
 	"song-lib/internal/db"
 	"song-lib/internal/externalAPI"
 	"song-lib/internal/handlers"
+	"song-lib/internal/idempotency"
+	"song-lib/internal/logging"
+	"song-lib/internal/metrics"
+	"song-lib/internal/outbox"
+	"song-lib/internal/ratelimit"
+	"song-lib/internal/replica"
+	"song-lib/internal/repository/cached"
+	"song-lib/internal/repository/memory"
 	"song-lib/internal/repository/postgres"
+	"song-lib/internal/repository/sqlite"
+	"song-lib/internal/stream"
+	"song-lib/internal/tracing"
 	"song-lib/internal/usecase"
+	"song-lib/internal/usecase/song"
+	"song-lib/internal/webhook"
+	"sync"
 	"syscall"
 	"time"
 )
 
+var version = "dev"
+
+// @title Song Library API
+// @version 1.0
+// @description API для управления музыкальной библиотекой
+// @host localhost:8080
+// @securityDefinitions.apikey ApiKeyAuth
+// @in header
+// @name X-API-Key
+// @securityDefinitions.apikey BearerAuth
+// @in header
+// @name Authorization
 func main() {
+	configPath := flag.String("config", "", "path to the config file (default ./internal/config/config.yaml)")
+	profile := flag.String("profile", "", "config profile merged on top of the config file, e.g. local")
+	storage := flag.String("storage", "", "postgres, sqlite or memory, overrides the storage config key; memory needs no database and loses data on exit")
+	flag.Parse()
+
 	logger, err := zap.NewProduction()
 	if err != nil {
 		log.Fatalf("failed to initialize logger: %v", err)
 	}
+
+	sugar := logger.Sugar()
+
+	err = config.SetUp(*configPath, *profile)
+	if err != nil {
+		sugar.Fatalw("failed to fetch config", "error", err)
+	}
+	if *storage != "" {
+		config.AppConfig.Storage = *storage
+		if err := config.AppConfig.Validate(); err != nil {
+			sugar.Fatalw("failed to fetch config", "error", err)
+		}
+	}
+
+	logger, err = logging.New(config.AppConfig.Log.Level, config.AppConfig.Log.Format)
+	if err != nil {
+		sugar.Fatalw("failed to initialize logger", "error", err)
+	}
 	defer func(logger *zap.Logger) {
 		err := logger.Sync()
 		if err != nil {
@@ -34,65 +92,622 @@ func main() {
 		}
 	}(logger)
 
-	sugar := logger.Sugar()
+	zap.ReplaceGlobals(logger)
+	sugar = logger.Sugar()
+	sugar.Infow("config loaded", "config", config.AppConfig)
 
-	err = config.SetUp()
-	if err != nil {
-		sugar.Fatalw("failed to fetch config", "error", err)
-	}
-	postgresDB, err := db.InitDB()
+	// Cancelled on shutdown, which stops the background loops.
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	tracingCfg := config.AppConfig.Tracing
+	shutdownTracing, err := tracing.SetUp(context.Background(), tracing.Options{
+		Exporter:       tracingCfg.Exporter,
+		Endpoint:       tracingCfg.Endpoint,
+		Insecure:       tracingCfg.Insecure,
+		SampleRatio:    tracingCfg.SampleRatio,
+		ServiceName:    tracingCfg.ServiceName,
+		ServiceVersion: version,
+	})
 	if err != nil {
-		sugar.Fatalw("failed to initialize database", "error", err)
+		sugar.Fatalw("failed to set up tracing", "error", err)
 	}
-	err = db.MakeMigrations(true)
-	if err != nil {
-		sugar.Fatalw("failed to make migrations", "error", err)
+
+	var storageDB *sqlx.DB
+	if config.AppConfig.Storage != "memory" {
+		storageDB, err = db.Open()
+		if err != nil {
+			sugar.Fatalw("failed to initialize database", "error", err)
+		}
+		if config.AppConfig.DB.AutoMigrate {
+			if err := migrateUp(storageDB, sugar); err != nil {
+				sugar.Fatalw("failed to make migrations", "error", err)
+			}
+		}
 	}
 
 	e := echo.New()
+	// The rate limiter and the audit log key on the client IP, so it must not
+	// come from a header the client can set.
+	e.IPExtractor = ipExtractor(config.AppConfig.Server.TrustedProxies)
+
+	var replicas *db.ReplicaSet
+	if config.AppConfig.Storage == "postgres" {
+		replicas, err = db.InitReplicas(context.Background())
+		if err != nil {
+			sugar.Fatalw("failed to initialize read replicas", "error", err)
+		}
+		for _, status := range replicas.Status() {
+			sugar.Infow("read replica configured", "replica", status.Name, "healthy", status.Healthy, "error", status.Error)
+		}
+		if replicas != nil {
+			runEvery(ctx, config.AppConfig.DB.Replicas.HealthInterval, func(ctx context.Context) { watchReplicas(ctx, replicas, sugar) })
+		}
+	}
+
+	appMetrics := metrics.New()
+	switch config.AppConfig.Storage {
+	case "postgres":
+		appMetrics.RegisterDB(storageDB.DB, config.AppConfig.DB.Name)
+		for name, replicaDB := range replicas.DBs() {
+			appMetrics.RegisterDB(replicaDB.DB, name)
+		}
+	case "sqlite":
+		appMetrics.RegisterDB(storageDB.DB, config.AppConfig.SQLite.Path)
+	}
 
 	e.Use(middleware.Recover())
-	e.Use(middleware.Logger())
+	e.Use(otelecho.Middleware(tracingCfg.ServiceName, otelecho.WithSkipper(func(ctx echo.Context) bool {
+		switch ctx.Path() {
+		case "/healthz", "/readyz", "/metrics":
+			return true
+		}
+		return false
+	})))
+	e.Use(logging.Middleware(sugar))
+	e.Use(audit.Middleware())
+	e.Use(appMetrics.Middleware())
 
-	myClient := externalAPI.NewClient(
-		fmt.Sprintf("http://%s:%s",
-			config.AppConfig.Server.Host,
-			config.AppConfig.Server.Port)) // внешнее апи /info находится по пути http://localhost:8080/info, изменить, если требуется
+	breakerCfg := config.AppConfig.ExternalAPI.Breaker
+	myClient := externalAPI.NewClient(config.AppConfig.ExternalAPI.URL, externalAPI.NewBreaker(externalAPI.BreakerOptions{
+		FailureThreshold: breakerCfg.FailureThreshold,
+		OpenTimeout:      breakerCfg.OpenTimeout,
+	})) // для локальной разработки /info отдает cmd/mockinfo
 
-	songRepo := postgres.NewSongRepo(postgresDB, sugar)
-	songUseCase := usecase.NewSongInstance(songRepo, *myClient, sugar)
+	var detailsProvider song.DetailsProvider = metrics.NewExternalAPI(myClient, appMetrics)
+	var lyricsCache *cached.LyricsClient
+	if cacheCfg := config.AppConfig.LyricsCache; cacheCfg.Enabled {
+		var store cache.Store
+		switch cacheCfg.Store {
+		case "postgres":
+			pgStore := cache.NewPostgres(storageDB, "lyrics_cache")
+			runEvery(ctx, time.Hour, func(ctx context.Context) { purgeExpired(ctx, pgStore, sugar) })
+			store = pgStore
+		default:
+			store = cache.NewLRU(cacheCfg.Size)
+		}
+		lyricsCache = cached.NewLyricsClient(detailsProvider, store, cached.LyricsOptions{
+			TTL:         cacheCfg.TTL,
+			NegativeTTL: cacheCfg.NegativeTTL,
+		}, sugar)
+		detailsProvider = lyricsCache
+		appMetrics.RegisterLyricsCache(lyricsCache)
+	}
+
+	isolation, _ := db.ParseIsolation(config.AppConfig.DB.Isolation)
+	var (
+		songRepo       song.Repository
+		txManager      song.Transactor
+		apiKeyUseCase  *usecase.APIKeyUseCase
+		userUseCase    *usecase.UserUseCase
+		auditUseCase   *usecase.AuditUseCase
+		outboxStore    outbox.Store
+		webhookUseCase *usecase.WebhookUseCase
+		webhookStore   webhook.Store
+	)
+	switch config.AppConfig.Storage {
+	case "memory":
+		sugar.Warnw("using in-memory storage, data is lost on exit")
+		memoryDB := memory.NewDB()
+		songRepo = memory.NewSongRepo(memoryDB, sugar)
+		txManager = memory.NewTxManager(memoryDB)
+		apiKeyUseCase = usecase.NewAPIKeyInstance(memory.NewAPIKeyRepo(memoryDB, sugar), sugar)
+		userUseCase = usecase.NewUserInstance(memory.NewUserRepo(memoryDB, sugar), sugar)
+		auditUseCase = usecase.NewAuditInstance(memory.NewAuditRepo(memoryDB, sugar), sugar)
+		outboxStore = memory.NewOutboxRepo(memoryDB, sugar)
+		webhookUseCase = usecase.NewWebhookInstance(memory.NewWebhookRepo(memoryDB, sugar), sugar)
+		webhookStore = memory.NewWebhookRepo(memoryDB, sugar)
+	case "sqlite":
+		songRepo = sqlite.NewSongRepo(storageDB, sugar)
+		txManager = sqlite.NewTxManager(storageDB, config.AppConfig.DB.TxRetries)
+		apiKeyUseCase = usecase.NewAPIKeyInstance(sqlite.NewAPIKeyRepo(storageDB, sugar), sugar)
+		userUseCase = usecase.NewUserInstance(sqlite.NewUserRepo(storageDB, sugar), sugar)
+		auditUseCase = usecase.NewAuditInstance(sqlite.NewAuditRepo(storageDB, sugar), sugar)
+		outboxStore = sqlite.NewOutboxRepo(storageDB, sugar)
+		webhookUseCase = usecase.NewWebhookInstance(sqlite.NewWebhookRepo(storageDB, sugar), sugar)
+		webhookStore = sqlite.NewWebhookRepo(storageDB, sugar)
+	default:
+		songRepo = postgres.NewSongRepo(storageDB, replicas, sugar)
+		txManager = postgres.NewTxManager(storageDB, isolation, config.AppConfig.DB.TxRetries)
+		apiKeyUseCase = usecase.NewAPIKeyInstance(postgres.NewAPIKeyRepo(storageDB, sugar), sugar)
+		userUseCase = usecase.NewUserInstance(postgres.NewUserRepo(storageDB, sugar), sugar)
+		auditUseCase = usecase.NewAuditInstance(postgres.NewAuditRepo(storageDB, sugar), sugar)
+		outboxStore = postgres.NewOutboxRepo(storageDB, sugar)
+		webhookUseCase = usecase.NewWebhookInstance(postgres.NewWebhookRepo(storageDB, sugar), sugar)
+		webhookStore = postgres.NewWebhookRepo(storageDB, sugar)
+	}
+
+	songRepo = metrics.NewSongRepository(songRepo, appMetrics)
+	var songCache *cached.SongRepo
+	if cacheCfg := config.AppConfig.SongCache; cacheCfg.Enabled {
+		var store cache.Store
+		switch cacheCfg.Store {
+		case "redis":
+			redisCfg := config.AppConfig.Redis
+			store = cache.NewRedis(redis.NewClient(&redis.Options{
+				Addr:     redisCfg.Addr,
+				Password: string(redisCfg.Password),
+				DB:       redisCfg.DB,
+			}), redisCfg.KeyPrefix)
+		default:
+			store = cache.NewLRU(cacheCfg.Size)
+		}
+		songCache = cached.NewSongRepo(songRepo, txManager, store, cached.Options{
+			TTL:     cacheCfg.TTL,
+			ListTTL: cacheCfg.ListTTL,
+		}, sugar)
+		songRepo, txManager = songCache, songCache
+		appMetrics.RegisterSongCache(songCache)
+	}
+
+	songUseCase := usecase.NewSongInstance(songRepo, txManager, metrics.NewEnrichment(detailsProvider, appMetrics), sugar)
 	songHandlers := handlers.NewSongHandler(songUseCase, sugar)
 
+	var (
+		relay      *outbox.Relay
+		dispatcher *webhook.Dispatcher
+	)
+	if outboxCfg := config.AppConfig.Outbox; outboxCfg.Enabled {
+		var sink outbox.Sink
+		switch outboxCfg.Sink {
+		case "file":
+			fileSink, err := outbox.NewFileSink(outboxCfg.File)
+			if err != nil {
+				sugar.Fatalw("failed to open outbox file", "path", outboxCfg.File, "error", err)
+			}
+			defer fileSink.Close()
+			sink = fileSink
+		case "webhook":
+			sink = outbox.NewWebhookSink(outboxCfg.Webhook.URL, outboxCfg.Webhook.Timeout)
+		default:
+			sink = outbox.NewLogSink(sugar)
+		}
+		if webhooksCfg := config.AppConfig.Webhooks; webhooksCfg.Enabled {
+			dispatcher = webhook.NewDispatcher(webhookStore, webhook.Options{
+				BatchSize:      webhooksCfg.BatchSize,
+				Workers:        webhooksCfg.Workers,
+				Timeout:        webhooksCfg.Timeout,
+				MaxAttempts:    webhooksCfg.MaxAttempts,
+				InitialBackoff: webhooksCfg.InitialBackoff,
+				MaxBackoff:     webhooksCfg.MaxBackoff,
+				AllowInternal:  webhooksCfg.AllowInternal,
+			}, sugar)
+			sink = outbox.FanOut(sink, dispatcher)
+			runEvery(ctx, webhooksCfg.Interval, func(ctx context.Context) { deliverWebhooks(ctx, dispatcher, sugar) })
+		}
+		relay = outbox.NewRelay(outboxStore, sink, outbox.Options{
+			BatchSize:      outboxCfg.BatchSize,
+			MaxAttempts:    outboxCfg.MaxAttempts,
+			InitialBackoff: outboxCfg.InitialBackoff,
+			MaxBackoff:     outboxCfg.MaxBackoff,
+		}, sugar)
+		runEvery(ctx, outboxCfg.Interval, func(ctx context.Context) { relayOutbox(ctx, relay, sugar) })
+	}
+
+	latestVersion, err := db.LatestStorageVersion()
+	if err != nil {
+		sugar.Fatalw("failed to read embedded migrations", "error", err)
+	}
+	healthHandler := handlers.NewHealthHandler(storageDB, myClient, latestVersion, version, sugar)
+	if lyricsCache != nil {
+		healthHandler.AddStatus("lyrics_cache", func() any { return lyricsCache.Stats() })
+	}
+	if replicas != nil {
+		healthHandler.AddStatus("replicas", func() any { return replicas.Status() })
+	}
+	if songCache != nil {
+		healthHandler.AddStatus("song_cache", func() any { return songCache.Stats() })
+	}
+	if relay != nil {
+		healthHandler.AddStatus("outbox", func() any { return relay.Stats() })
+	}
+	if dispatcher != nil {
+		healthHandler.AddStatus("webhooks", func() any { return dispatcher.Stats() })
+	}
+
+	var hub *stream.Hub
+	if eventsCfg := config.AppConfig.SongEvents; eventsCfg.Enabled {
+		hub = stream.NewHub(auditUseCase, stream.Options{
+			LogSize:    eventsCfg.LogSize,
+			Buffer:     eventsCfg.Buffer,
+			GapTimeout: eventsCfg.GapTimeout,
+		}, sugar)
+		if _, err := hub.Poll(context.Background()); err != nil {
+			sugar.Warnw("failed to read song events, retrying in the background", "error", err)
+		}
+		runEvery(ctx, eventsCfg.PollInterval, func(ctx context.Context) { streamSongEvents(ctx, hub, sugar) })
+		healthHandler.AddStatus("song_events", func() any { return hub.Stats() })
+	}
+
+	tokenVerifier, err := newTokenVerifier(config.AppConfig.Auth.JWT)
+	if err != nil {
+		sugar.Fatalw("failed to set up JWT authentication", "error", err)
+	}
+	userHandlers := handlers.NewUserHandler(userUseCase, sugar)
+	authenticate := auth.Middleware(apiKeyUseCase, tokenVerifier, userUseCase, sugar)
+	switch {
+	case !config.AppConfig.Auth.Enabled:
+		sugar.Warnw("authentication is disabled, every request has admin access")
+		authenticate = auth.Anonymous()
+	case config.AppConfig.Storage == "memory":
+		// songctl cannot reach keys kept in this process, so hand out one.
+		// The key goes to stderr rather than the log, which is shipped and
+		// kept; the log only names its prefix.
+		plain, key, err := apiKeyUseCase.CreateKey(context.Background(), "demo", []string{auth.ScopeAdmin})
+		if err != nil {
+			sugar.Fatalw("failed to create demo api key", "error", err)
+		}
+		fmt.Fprintf(os.Stderr, "admin api key for in-memory storage: %s\n", plain)
+		sugar.Infow("created admin api key for in-memory storage, printed to stderr", "prefix", key.Prefix)
+	}
+
+	var readLimit, writeLimit, enrichmentLimit, authLimit echo.MiddlewareFunc = passThrough, passThrough, passThrough, passThrough
+	if rateCfg := config.AppConfig.RateLimit; rateCfg.Enabled {
+		limits := map[string]ratelimit.Limit{
+			"read":       ratelimit.PerPeriod(rateCfg.Read.Requests, rateCfg.Read.Period, rateCfg.Read.Burst),
+			"write":      ratelimit.PerPeriod(rateCfg.Write.Requests, rateCfg.Write.Period, rateCfg.Write.Burst),
+			"enrichment": ratelimit.PerPeriod(rateCfg.Enrichment.Requests, rateCfg.Enrichment.Period, rateCfg.Enrichment.Burst),
+			"auth":       ratelimit.PerPeriod(rateCfg.Auth.Requests, rateCfg.Auth.Period, rateCfg.Auth.Burst),
+		}
+
+		var store ratelimit.Store
+		switch rateCfg.Store {
+		case "postgres":
+			pgStore := ratelimit.NewPostgres(storageDB, "rate_limits")
+			var idle time.Duration
+			for _, limit := range limits {
+				idle = max(idle, limit.FillTime())
+			}
+			runEvery(ctx, time.Hour, func(ctx context.Context) { purgeIdleBuckets(ctx, pgStore, idle, sugar) })
+			store = pgStore
+		default:
+			store = ratelimit.NewMemory()
+		}
+
+		readLimit = ratelimit.Middleware(store, "read", limits["read"], sugar)
+		writeLimit = ratelimit.Middleware(store, "write", limits["write"], sugar)
+		enrichmentLimit = ratelimit.Middleware(store, "enrichment", limits["enrichment"], sugar)
+		// Runs before authentication, so there is no principal yet and the
+		// bucket is the client IP's; failed attempts are counted too.
+		authLimit = ratelimit.Middleware(store, "auth", limits["auth"], sugar)
+	}
+	checkCredentials := authenticate
+	authenticate = func(next echo.HandlerFunc) echo.HandlerFunc {
+		return authLimit(checkCredentials(next))
+	}
+
+	var idempotent echo.MiddlewareFunc = passThrough
+	if idemCfg := config.AppConfig.Idempotency; idemCfg.Enabled {
+		var store idempotency.Store
+		switch idemCfg.Store {
+		case "postgres":
+			pgStore := idempotency.NewPostgres(storageDB, "idempotency_keys")
+			runEvery(ctx, time.Hour, func(ctx context.Context) { purgeIdempotencyKeys(ctx, pgStore, sugar) })
+			store = pgStore
+		default:
+			store = idempotency.NewMemory()
+		}
+		idempotent = idempotency.Middleware(store, idemCfg.TTL, sugar)
+	}
+
+	var pinPrimary echo.MiddlewareFunc = passThrough
+	if window := config.AppConfig.DB.Replicas.ReadYourWrites; replicas != nil && window > 0 {
+		pinPrimary = replica.NewPinner(window).Middleware()
+	}
+
+	e.HTTPErrorHandler = handlers.ErrorHandler
+
+	e.GET("/healthz", healthHandler.Live)
+	e.GET("/readyz", healthHandler.Ready)
+	e.GET("/status", healthHandler.Status, authenticate, auth.RequireScope(auth.ScopeAdmin))
+
+	e.GET("/metrics", echo.WrapHandler(appMetrics.Handler()))
 	e.GET("/swagger/*", echoSwagger.WrapHandler)
 
-	songGroup := e.Group("/api/songs")
+	auditHandlers := handlers.NewAuditHandler(auditUseCase, sugar)
+	if retention := config.AppConfig.Audit.Retention; retention > 0 {
+		runEvery(ctx, time.Hour, func(ctx context.Context) { purgeAuditEvents(ctx, auditUseCase, retention, sugar) })
+	}
+
+	webhookHandlers := handlers.NewWebhookHandler(webhookUseCase, sugar)
+	if retention := config.AppConfig.Webhooks.Retention; retention > 0 {
+		runEvery(ctx, time.Hour, func(ctx context.Context) { purgeWebhookDeliveries(ctx, webhookUseCase, retention, sugar) })
+	}
+
+	e.GET("/api/me", userHandlers.Me, authenticate, readLimit)
+	e.GET("/api/audit", auditHandlers.List, authenticate, auth.RequireScope(auth.ScopeAdmin), readLimit)
+
+	webhookGroup := e.Group("/api/webhooks", authenticate, auth.RequireScope(auth.ScopeAdmin))
 
-	songGroup.POST("", songHandlers.Create)
-	songGroup.GET("/:id", songHandlers.Get)
-	songGroup.GET("/filter", songHandlers.GetSongs)
-	songGroup.PUT("/:id", songHandlers.Update)
-	songGroup.DELETE("/:id", songHandlers.Delete)
+	webhookGroup.POST("", webhookHandlers.Create, writeLimit)
+	webhookGroup.GET("", webhookHandlers.List, readLimit)
+	webhookGroup.GET("/:id", webhookHandlers.Get, readLimit)
+	webhookGroup.PUT("/:id", webhookHandlers.Update, writeLimit)
+	webhookGroup.DELETE("/:id", webhookHandlers.Delete, writeLimit)
+	webhookGroup.GET("/:id/deliveries", webhookHandlers.Deliveries, readLimit)
+	webhookGroup.POST("/:id/deliveries/:deliveryID/redeliver", webhookHandlers.Redeliver, writeLimit)
 
-	sugar.Infow("starting server", "port", 8080)
+	songGroup := e.Group("/api/songs", authenticate, pinPrimary)
+
+	songGroup.POST("", songHandlers.Create, auth.RequireScope(auth.ScopeSongsWrite), idempotent, enrichmentLimit)
+	cacheControl := handlers.CacheControl(config.AppConfig.SongCache.MaxAge)
+	songGroup.GET("/:id", songHandlers.Get, auth.RequireScope(auth.ScopeSongsRead), readLimit, cacheControl)
+	songGroup.GET("/filter", songHandlers.GetSongs, auth.RequireScope(auth.ScopeSongsRead), readLimit, cacheControl)
+	if hub != nil {
+		eventsHandlers := handlers.NewEventsHandler(hub, config.AppConfig.SongEvents.Heartbeat, sugar)
+		songGroup.GET("/events", eventsHandlers.Stream, auth.RequireScope(auth.ScopeSongsRead), readLimit)
+	}
+	songGroup.PUT("/:id", songHandlers.Update, auth.RequireScope(auth.ScopeSongsWrite), writeLimit)
+	songGroup.DELETE("/:id", songHandlers.Delete, auth.RequireScope(auth.ScopeSongsDelete), writeLimit)
+	songGroup.POST("/:id/restore", songHandlers.Restore, auth.RequireScope(auth.ScopeSongsWrite), idempotent, writeLimit)
+
+	serverCfg := config.AppConfig.Server
+	e.Server.Addr = serverCfg.Addr()
+	e.Server.ReadTimeout = serverCfg.ReadTimeout
+	e.Server.WriteTimeout = serverCfg.WriteTimeout
+	e.Server.IdleTimeout = serverCfg.IdleTimeout
+	if serverCfg.TLS.Enabled {
+		cert, err := tls.LoadX509KeyPair(serverCfg.TLS.CertFile, serverCfg.TLS.KeyFile)
+		if err != nil {
+			sugar.Fatalw("failed to load TLS certificate", "error", err)
+		}
+		e.Server.TLSConfig = &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			MinVersion:   tls.VersionTLS12,
+		}
+	}
 
-	stop := make(chan os.Signal, 1)
-	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	sugar.Infow("starting server", "addr", e.Server.Addr, "tls", serverCfg.TLS.Enabled)
 
 	go func() {
-		if err := e.Start(":8080"); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		if err := e.StartServer(e.Server); err != nil && !errors.Is(err, http.ErrServerClosed) {
 			sugar.Fatalw("failed to start server", "error", err)
 		}
 	}()
 
-	<-stop
+	<-ctx.Done()
+	// A second signal kills the process.
+	stop()
 	sugar.Infow("received shutdown signal, starting shutdown...")
+	healthHandler.MarkShuttingDown()
+	if hub != nil {
+		// Open streams would otherwise keep the shutdown waiting.
+		hub.Close()
+	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), serverCfg.ShutdownTimeout)
 	defer cancel()
 
-	if err := e.Shutdown(ctx); err != nil {
+	if err := e.Shutdown(shutdownCtx); err != nil {
 		sugar.Fatalw("failed to gracefully shut down server", "error", err)
 	}
+	// A relay flush may still be writing to the outbox file closed on return.
+	loops.Wait()
+
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		sugar.Warnw("failed to flush traces", "error", err)
+	}
+
+	if lyricsCache != nil {
+		sugar.Infow("lyrics cache stats", "stats", lyricsCache.Stats())
+	}
 
 	sugar.Infow("server gracefully stopped")
 }
+
+func migrateUp(storageDB *sqlx.DB, logger *zap.SugaredLogger) error {
+	ctx := context.Background()
+
+	migrator, err := db.NewStorageMigrator(ctx, storageDB)
+	if err != nil {
+		return err
+	}
+	defer func(migrator *db.Migrator) {
+		if err := migrator.Close(); err != nil {
+			logger.Warnw("failed to close migrator", "error", err)
+		}
+	}(migrator)
+
+	if err := migrator.Up(ctx); err != nil {
+		return err
+	}
+
+	version, _, err := migrator.Version()
+	if err != nil {
+		return err
+	}
+	logger.Infow("database schema is up to date", "version", version)
+	return nil
+}
+
+// passThrough stands in for the rate limit, idempotency and replica pinning
+// middlewares when they are turned off.
+func passThrough(next echo.HandlerFunc) echo.HandlerFunc {
+	return next
+}
+
+// ipExtractor takes the client IP from X-Forwarded-For as far back as the
+// trusted proxies go, or from the connection when there are none.
+func ipExtractor(trustedProxies []string) echo.IPExtractor {
+	if len(trustedProxies) == 0 {
+		return echo.ExtractIPDirect()
+	}
+
+	// Only the configured ranges, not the private networks echo trusts by
+	// default.
+	options := []echo.TrustOption{echo.TrustLoopback(false), echo.TrustLinkLocal(false), echo.TrustPrivateNet(false)}
+	for _, cidr := range trustedProxies {
+		_, ipRange, _ := net.ParseCIDR(cidr) // checked by config.Validate
+		options = append(options, echo.TrustIPRange(ipRange))
+	}
+	return echo.ExtractIPFromXFFHeader(options...)
+}
+
+func newTokenVerifier(cfg config.JWTConfig) (auth.TokenVerifier, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	var keys auth.MultiKeySet
+	if cfg.JWKSURL != "" {
+		keys = append(keys, auth.NewRemoteKeySet(cfg.JWKSURL, cfg.JWKSRefresh))
+	}
+	if cfg.JWKSFile != "" {
+		fileKeys, err := auth.LoadJWKSFile(cfg.JWKSFile)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, fileKeys)
+	}
+	if cfg.LocalKeyFile != "" {
+		signer, err := auth.LoadSigningKey(cfg.LocalKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		localKeys, err := auth.LocalKeySet(signer)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, localKeys)
+	}
+
+	return auth.NewJWTVerifier(keys, auth.JWTOptions{
+		Issuer:      cfg.Issuer,
+		Audience:    cfg.Audience,
+		Leeway:      cfg.Leeway,
+		RolesClaim:  cfg.RolesClaim,
+		RoleMapping: cfg.RoleMapping,
+	}), nil
+}
+
+// loops tracks the goroutines started by runEvery.
+var loops sync.WaitGroup
+
+// runEvery calls fn every interval until ctx is cancelled. A call in progress
+// gets the same ctx and is waited for by loops.Wait.
+func runEvery(ctx context.Context, interval time.Duration, fn func(ctx context.Context)) {
+	loops.Add(1)
+	go func() {
+		defer loops.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				fn(ctx)
+			}
+		}
+	}()
+}
+
+func purgeExpired(ctx context.Context, store *cache.Postgres, logger *zap.SugaredLogger) {
+	deleted, err := store.DeleteExpired(ctx)
+	if err != nil {
+		logger.Warnw("failed to purge expired lyrics cache entries", "error", err)
+		return
+	}
+	logger.Debugw("purged expired lyrics cache entries", "deleted", deleted)
+}
+
+func purgeAuditEvents(ctx context.Context, auditUseCase *usecase.AuditUseCase, retention time.Duration, logger *zap.SugaredLogger) {
+	deleted, err := auditUseCase.PurgeExpired(ctx, retention)
+	if err != nil {
+		logger.Warnw("failed to purge expired audit events", "error", err)
+		return
+	}
+	logger.Debugw("purged expired audit events", "deleted", deleted)
+}
+
+func purgeWebhookDeliveries(ctx context.Context, webhookUseCase *usecase.WebhookUseCase, retention time.Duration, logger *zap.SugaredLogger) {
+	deleted, err := webhookUseCase.PurgeDeliveries(ctx, retention)
+	if err != nil {
+		logger.Warnw("failed to purge old webhook deliveries", "error", err)
+		return
+	}
+	logger.Debugw("purged old webhook deliveries", "deleted", deleted)
+}
+
+func purgeIdleBuckets(ctx context.Context, store *ratelimit.Postgres, idle time.Duration, logger *zap.SugaredLogger) {
+	deleted, err := store.DeleteIdle(ctx, idle)
+	if err != nil {
+		logger.Warnw("failed to purge idle rate limit buckets", "error", err)
+		return
+	}
+	logger.Debugw("purged idle rate limit buckets", "deleted", deleted)
+}
+
+func purgeIdempotencyKeys(ctx context.Context, store *idempotency.Postgres, logger *zap.SugaredLogger) {
+	deleted, err := store.DeleteExpired(ctx)
+	if err != nil {
+		logger.Warnw("failed to purge expired idempotency keys", "error", err)
+		return
+	}
+	logger.Debugw("purged expired idempotency keys", "deleted", deleted)
+}
+
+func watchReplicas(ctx context.Context, replicas *db.ReplicaSet, logger *zap.SugaredLogger) {
+	for _, status := range replicas.Check(ctx) {
+		if status.Healthy {
+			logger.Infow("read replica is back", "replica", status.Name)
+			continue
+		}
+		logger.Warnw("read replica is down, reading from the others", "replica", status.Name, "error", status.Error)
+	}
+}
+
+func relayOutbox(ctx context.Context, relay *outbox.Relay, logger *zap.SugaredLogger) {
+	published, err := relay.Flush(ctx)
+	if err != nil {
+		logger.Warnw("failed to relay outbox events", "error", err)
+		return
+	}
+	if published > 0 {
+		logger.Debugw("relayed outbox events", "published", published)
+	}
+}
+
+func deliverWebhooks(ctx context.Context, dispatcher *webhook.Dispatcher, logger *zap.SugaredLogger) {
+	delivered, err := dispatcher.Deliver(ctx)
+	if err != nil {
+		logger.Warnw("failed to deliver webhooks", "error", err)
+		return
+	}
+	if delivered > 0 {
+		logger.Debugw("delivered webhooks", "delivered", delivered)
+	}
+}
+
+func streamSongEvents(ctx context.Context, hub *stream.Hub, logger *zap.SugaredLogger) {
+	published, err := hub.Poll(ctx)
+	if err != nil {
+		logger.Warnw("failed to read song events", "error", err)
+		return
+	}
+	if published > 0 {
+		logger.Debugw("streamed song events", "published", published)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"go.uber.org/zap"
+	"os"
+	"song-lib/internal/config"
+	"song-lib/internal/db"
+	"song-lib/internal/repository/postgres"
+	"song-lib/internal/repository/sqlite"
+	"song-lib/internal/usecase"
+	"song-lib/internal/usecase/apikey"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+func runKeys(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("expected one of create, list, revoke")
+	}
+
+	ctx := context.Background()
+
+	storageDB, err := db.Open()
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer storageDB.Close()
+
+	var repo apikey.Repository = postgres.NewAPIKeyRepo(storageDB, zap.NewNop().Sugar())
+	if config.AppConfig.Storage == "sqlite" {
+		repo = sqlite.NewAPIKeyRepo(storageDB, zap.NewNop().Sugar())
+	}
+	keys := usecase.NewAPIKeyInstance(repo, zap.NewNop().Sugar())
+
+	switch args[0] {
+	case "create":
+		flags := flag.NewFlagSet("keys create", flag.ContinueOnError)
+		name := flags.String("name", "", "human readable key name")
+		scopes := flags.String("scopes", "", "comma-separated scopes: songs:read, songs:write, songs:delete, admin")
+		if err := flags.Parse(args[1:]); err != nil {
+			return err
+		}
+		if *name == "" {
+			return fmt.Errorf("--name is required")
+		}
+
+		plain, key, err := keys.CreateKey(ctx, *name, splitList(*scopes))
+		if err != nil {
+			return err
+		}
+		fmt.Printf("id: %d\nname: %s\nscopes: %s\nkey: %s\n\nStore the key now, it cannot be shown again.\n",
+			key.ID, key.Name, strings.Join(key.Scopes, ","), plain)
+		return nil
+	case "list":
+		list, err := keys.ListKeys(ctx)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tNAME\tPREFIX\tSCOPES\tCREATED\tLAST USED\tREVOKED")
+		for _, key := range list {
+			fmt.Fprintf(w, "%d\t%s\tsl_%s\t%s\t%s\t%s\t%s\n",
+				key.ID, key.Name, key.Prefix, strings.Join(key.Scopes, ","),
+				key.CreatedAt.Format(time.RFC3339), formatTime(key.LastUsedAt), formatTime(key.RevokedAt))
+		}
+		return w.Flush()
+	case "revoke":
+		if len(args) < 2 {
+			return fmt.Errorf("revoke requires a key id")
+		}
+		keyID, err := strconv.Atoi(args[1])
+		if err != nil {
+			return fmt.Errorf("invalid key id %q", args[1])
+		}
+		if err := keys.RevokeKey(ctx, keyID); err != nil {
+			return err
+		}
+		fmt.Printf("key %d revoked\n", keyID)
+		return nil
+	default:
+		return fmt.Errorf("unknown keys command %q", args[0])
+	}
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return t.Format(time.RFC3339)
+}
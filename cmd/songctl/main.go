@@ -0,0 +1,73 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"song-lib/internal/config"
+)
+
+const usage = `Usage: songctl [--config path] [--profile name] <command> [args]
+
+Commands:
+  migrate up           apply all pending migrations
+  migrate down [N]     roll back N migrations (default 1)
+  migrate goto N       migrate up or down to version N
+  migrate version      print the current schema version
+  migrate force N      set the schema version without running migrations
+
+  keys create --name NAME --scopes S1,S2
+                       create an API key; scopes: songs:read, songs:write, songs:delete, admin
+  keys list            list API keys
+  keys revoke ID       revoke an API key
+
+  users list           list users seen by the server
+  users set-role SUBJECT ROLE
+                       set the role used when a token carries none;
+                       roles: viewer, contributor, editor, admin
+
+  token keygen [--out PATH]
+                       generate an Ed25519 key for auth.jwt.local_key_file
+  token issue --sub SUBJECT [--roles R1,R2] [--ttl 1h]
+                       sign a JWT with the local key; roles: viewer, contributor, editor, admin
+`
+
+var commands = map[string]func(args []string) error{
+	"migrate": runMigrate,
+	"keys":    runKeys,
+	"users":   runUsers,
+	"token":   runToken,
+}
+
+func main() {
+	flags := flag.NewFlagSet("songctl", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+	}
+	configPath := flags.String("config", "", "path to the config file (default ./internal/config/config.yaml)")
+	profile := flags.String("profile", "", "config profile merged on top of the config file")
+	_ = flags.Parse(os.Args[1:])
+
+	args := flags.Args()
+	if len(args) == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	command, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", args[0])
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	if err := config.SetUp(*configPath, *profile); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to fetch config: %v\n", err)
+		os.Exit(1)
+	}
+
+	if err := command(args[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", args[0], err)
+		os.Exit(1)
+	}
+}
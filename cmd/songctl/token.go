@@ -0,0 +1,83 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"song-lib/internal/auth"
+	"song-lib/internal/config"
+	"time"
+)
+
+func runToken(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("expected one of keygen, issue")
+	}
+
+	jwtCfg := config.AppConfig.Auth.JWT
+
+	switch args[0] {
+	case "keygen":
+		flags := flag.NewFlagSet("token keygen", flag.ContinueOnError)
+		out := flags.String("out", jwtCfg.LocalKeyFile, "where to write the PEM encoded Ed25519 key")
+		if err := flags.Parse(args[1:]); err != nil {
+			return err
+		}
+		if *out == "" {
+			return fmt.Errorf("--out is required when auth.jwt.local_key_file is not set")
+		}
+
+		key, err := auth.GenerateSigningKey()
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(*out, key, 0o600); err != nil {
+			return err
+		}
+		fmt.Printf("signing key written to %s\n", *out)
+		return nil
+	case "issue":
+		flags := flag.NewFlagSet("token issue", flag.ContinueOnError)
+		subject := flags.String("sub", "", "token subject")
+		name := flags.String("name", "", "display name (default the subject)")
+		roles := flags.String("roles", auth.RoleViewer, "comma-separated roles: viewer, contributor, editor, admin")
+		ttl := flags.Duration("ttl", time.Hour, "token lifetime")
+		if err := flags.Parse(args[1:]); err != nil {
+			return err
+		}
+		if *subject == "" {
+			return fmt.Errorf("--sub is required")
+		}
+		if jwtCfg.LocalKeyFile == "" {
+			return fmt.Errorf("auth.jwt.local_key_file is not set")
+		}
+		for _, role := range splitList(*roles) {
+			if !auth.IsRole(role) {
+				return fmt.Errorf("unknown role %q", role)
+			}
+		}
+		if *name == "" {
+			*name = *subject
+		}
+
+		signer, err := auth.LoadSigningKey(jwtCfg.LocalKeyFile)
+		if err != nil {
+			return err
+		}
+		token, err := auth.SignToken(signer, auth.TokenClaims{
+			Subject:  *subject,
+			Name:     *name,
+			Roles:    splitList(*roles),
+			Issuer:   jwtCfg.Issuer,
+			Audience: jwtCfg.Audience,
+			TTL:      *ttl,
+		})
+		if err != nil {
+			return err
+		}
+		fmt.Println(token)
+		return nil
+	default:
+		return fmt.Errorf("unknown token command %q", args[0])
+	}
+}
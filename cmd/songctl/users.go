@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"go.uber.org/zap"
+	"os"
+	"song-lib/internal/config"
+	"song-lib/internal/db"
+	"song-lib/internal/repository/postgres"
+	"song-lib/internal/repository/sqlite"
+	"song-lib/internal/usecase"
+	"song-lib/internal/usecase/user"
+	"text/tabwriter"
+	"time"
+)
+
+func runUsers(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("expected one of list, set-role")
+	}
+
+	ctx := context.Background()
+
+	storageDB, err := db.Open()
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer storageDB.Close()
+
+	var repo user.Repository = postgres.NewUserRepo(storageDB, zap.NewNop().Sugar())
+	if config.AppConfig.Storage == "sqlite" {
+		repo = sqlite.NewUserRepo(storageDB, zap.NewNop().Sugar())
+	}
+	users := usecase.NewUserInstance(repo, zap.NewNop().Sugar())
+
+	switch args[0] {
+	case "list":
+		list, err := users.ListUsers(ctx)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tSUBJECT\tNAME\tROLE\tCREATED\tLAST SEEN")
+		for _, user := range list {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\n",
+				user.ID, user.Subject, user.Name, user.Role,
+				user.CreatedAt.Format(time.RFC3339), user.LastSeenAt.Format(time.RFC3339))
+		}
+		return w.Flush()
+	case "set-role":
+		if len(args) < 3 {
+			return fmt.Errorf("set-role requires a subject and a role")
+		}
+		if err := users.SetRole(ctx, args[1], args[2]); err != nil {
+			return err
+		}
+		fmt.Printf("user %s is now %s\n", args[1], args[2])
+		return nil
+	default:
+		return fmt.Errorf("unknown users command %q", args[0])
+	}
+}
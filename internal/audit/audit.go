@@ -0,0 +1,66 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/labstack/echo/v4"
+	"song-lib/internal/auth"
+	"song-lib/internal/logging"
+	"song-lib/internal/models"
+)
+
+type clientIPKey struct{}
+
+func WithClientIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, clientIPKey{}, ip)
+}
+
+func ClientIP(ctx context.Context) string {
+	ip, _ := ctx.Value(clientIPKey{}).(string)
+	return ip
+}
+
+// Middleware stores the client IP in the request context so repositories
+// can attribute audit events without depending on echo. The IP is
+// auth.ClientIP, which only takes X-Forwarded-For from trusted proxies.
+func Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			req := ctx.Request()
+			ctx.SetRequest(req.WithContext(WithClientIP(req.Context(), auth.ClientIP(ctx))))
+			return next(ctx)
+		}
+	}
+}
+
+// NewEvent describes a song mutation made on behalf of the principal, request
+// and client found in ctx. Requests without a principal are attributed to
+// "system".
+func NewEvent(ctx context.Context, action string, songID int, before, after *models.Song) (models.AuditEvent, error) {
+	event := models.AuditEvent{
+		Action:    action,
+		SongID:    songID,
+		Actor:     "system",
+		RequestID: logging.RequestID(ctx),
+		ClientIP:  ClientIP(ctx),
+	}
+	if principal, ok := auth.PrincipalFrom(ctx); ok {
+		event.Actor = principal.Subject
+		if principal.UserID != 0 {
+			event.ActorID = &principal.UserID
+		}
+	}
+
+	var err error
+	if before != nil {
+		if event.Before, err = json.Marshal(before); err != nil {
+			return models.AuditEvent{}, err
+		}
+	}
+	if after != nil {
+		if event.After, err = json.Marshal(after); err != nil {
+			return models.AuditEvent{}, err
+		}
+	}
+	return event, nil
+}
@@ -0,0 +1,46 @@
+package audit_test
+
+import (
+	"github.com/labstack/echo/v4"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"song-lib/internal/audit"
+	"testing"
+)
+
+func TestMiddlewareClientIP(t *testing.T) {
+	_, proxies, _ := net.ParseCIDR("10.0.0.0/8")
+
+	for name, tc := range map[string]struct {
+		extractor  echo.IPExtractor
+		remoteAddr string
+		want       string
+	}{
+		"NoExtractor":    {remoteAddr: "198.51.100.7:4000", want: "198.51.100.7"},
+		"Direct":         {extractor: echo.ExtractIPDirect(), remoteAddr: "198.51.100.7:4000", want: "198.51.100.7"},
+		"UntrustedProxy": {extractor: echo.ExtractIPFromXFFHeader(echo.TrustIPRange(proxies)), remoteAddr: "198.51.100.7:4000", want: "198.51.100.7"},
+		"TrustedProxy":   {extractor: echo.ExtractIPFromXFFHeader(echo.TrustIPRange(proxies)), remoteAddr: "10.1.2.3:4000", want: "203.0.113.9"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			e := echo.New()
+			e.IPExtractor = tc.extractor
+
+			var got string
+			e.GET("/", func(ctx echo.Context) error {
+				got = audit.ClientIP(ctx.Request().Context())
+				return ctx.NoContent(http.StatusNoContent)
+			}, audit.Middleware())
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tc.remoteAddr
+			req.Header.Set(echo.HeaderXForwardedFor, "203.0.113.9")
+			req.Header.Set(echo.HeaderXRealIP, "203.0.113.9")
+			e.ServeHTTP(httptest.NewRecorder(), req)
+
+			if got != tc.want {
+				t.Errorf("client IP = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,7 @@
+package auth
+
+import "time"
+
+func SetMinRefetch(r *RemoteKeySet, d time.Duration) {
+	r.minRefetch = d
+}
@@ -0,0 +1,278 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"golang.org/x/sync/singleflight"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+var ErrUnknownKey = errors.New("unknown signing key")
+
+type KeySet interface {
+	PublicKey(ctx context.Context, kid string) (crypto.PublicKey, error)
+}
+
+type jsonWebKey struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// ParseJWKS decodes the RSA, EC and Ed25519 signing keys of a JSON Web Key Set.
+func ParseJWKS(data []byte) (map[string]crypto.PublicKey, error) {
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("failed to decode JWKS: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("JWKS key %q: %w", jwk.Kid, err)
+		}
+		keys[jwk.Kid] = key
+	}
+	return keys, nil
+}
+
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	decode := base64.RawURLEncoding.DecodeString
+	switch k.Kty {
+	case "RSA":
+		n, err := decode(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, err
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+// StaticKeySet serves a fixed set of keys. A token without kid is accepted
+// when the set holds exactly one key.
+type StaticKeySet map[string]crypto.PublicKey
+
+func (s StaticKeySet) PublicKey(_ context.Context, kid string) (crypto.PublicKey, error) {
+	if key, ok := s[kid]; ok {
+		return key, nil
+	}
+	if kid == "" && len(s) == 1 {
+		for _, key := range s {
+			return key, nil
+		}
+	}
+	return nil, ErrUnknownKey
+}
+
+func LoadJWKSFile(path string) (StaticKeySet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := ParseJWKS(data)
+	if err != nil {
+		return nil, err
+	}
+	return StaticKeySet(keys), nil
+}
+
+// RemoteKeySet fetches a JWKS document over HTTP and refreshes it every
+// refresh interval, or sooner when a token names a kid it has not seen yet
+// (rotation), but never tries more than once a minute, failed attempts
+// included. A periodic refresh runs in the background while the
+// cached keys keep being served, and stays on them when it fails.
+type RemoteKeySet struct {
+	url        string
+	refresh    time.Duration
+	minRefetch time.Duration
+	client     *http.Client
+	group      singleflight.Group
+
+	mu          sync.Mutex
+	keys        map[string]crypto.PublicKey
+	fetchedAt   time.Time
+	attemptedAt time.Time
+	err         error
+}
+
+func NewRemoteKeySet(url string, refresh time.Duration) *RemoteKeySet {
+	return &RemoteKeySet{url: url, refresh: refresh, minRefetch: time.Minute, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (r *RemoteKeySet) PublicKey(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	r.mu.Lock()
+	keys, lastErr := r.keys, r.err
+	stale := time.Since(r.fetchedAt) > r.refresh
+	canFetch := time.Since(r.attemptedAt) > r.minRefetch
+	r.mu.Unlock()
+
+	if keys == nil {
+		if !canFetch {
+			return nil, lastErr
+		}
+		if err := r.refetch(ctx); err != nil {
+			return nil, err
+		}
+		return r.lookup(ctx, kid)
+	}
+
+	if key, err := StaticKeySet(keys).PublicKey(ctx, kid); err == nil {
+		if stale && canFetch {
+			go func() { _ = r.refetch(context.WithoutCancel(ctx)) }()
+		}
+		return key, nil
+	}
+	if !canFetch {
+		return nil, ErrUnknownKey
+	}
+	if err := r.refetch(ctx); err != nil {
+		return nil, err
+	}
+	return r.lookup(ctx, kid)
+}
+
+func (r *RemoteKeySet) lookup(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return StaticKeySet(r.keys).PublicKey(ctx, kid)
+}
+
+// refetch fetches the keys once for all concurrent callers. The fetch is
+// shared, so a caller giving up does not cancel it for the others.
+func (r *RemoteKeySet) refetch(ctx context.Context) error {
+	done := r.group.DoChan("jwks", func() (interface{}, error) {
+		r.mu.Lock()
+		attemptedAt, lastErr := r.attemptedAt, r.err
+		r.mu.Unlock()
+		// Another caller got here first.
+		if time.Since(attemptedAt) <= r.minRefetch {
+			return nil, lastErr
+		}
+
+		keys, err := r.fetch(context.WithoutCancel(ctx))
+
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.attemptedAt, r.err = time.Now(), err
+		if err == nil {
+			r.keys, r.fetchedAt = keys, r.attemptedAt
+		}
+		return nil, err
+	})
+
+	select {
+	case res := <-done:
+		return res.Err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (r *RemoteKeySet) fetch(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch JWKS: status %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	return ParseJWKS(data)
+}
+
+// MultiKeySet looks a kid up in each set in turn.
+type MultiKeySet []KeySet
+
+func (m MultiKeySet) PublicKey(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	var lastErr error = ErrUnknownKey
+	for _, set := range m {
+		key, err := set.PublicKey(ctx, kid)
+		if err == nil {
+			return key, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// KeyID derives a stable kid from the SHA-256 of the public key.
+func KeyID(key crypto.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:8]), nil
+}
@@ -0,0 +1,113 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"strings"
+	"time"
+)
+
+var ErrInvalidToken = errors.New("invalid token")
+
+// signingMethods excludes HMAC and "none" so a public key can never be
+// reused as a shared secret.
+var signingMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}
+
+type JWTOptions struct {
+	Issuer     string
+	Audience   string
+	Leeway     time.Duration
+	RolesClaim string
+	// RoleMapping translates identity provider roles to song-lib roles.
+	// Unmapped roles are taken as is.
+	RoleMapping map[string]string
+}
+
+type JWTVerifier struct {
+	keys   KeySet
+	opts   JWTOptions
+	parser *jwt.Parser
+}
+
+func NewJWTVerifier(keys KeySet, opts JWTOptions) *JWTVerifier {
+	return &JWTVerifier{
+		keys: keys,
+		opts: opts,
+		parser: jwt.NewParser(
+			jwt.WithValidMethods(signingMethods),
+			jwt.WithIssuer(opts.Issuer),
+			jwt.WithAudience(opts.Audience),
+			jwt.WithLeeway(opts.Leeway),
+			jwt.WithExpirationRequired(),
+		),
+	}
+}
+
+func (v *JWTVerifier) Verify(ctx context.Context, raw string) (Principal, error) {
+	claims := jwt.MapClaims{}
+	_, err := v.parser.ParseWithClaims(raw, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return v.keys.PublicKey(ctx, kid)
+	})
+	if err != nil {
+		return Principal{}, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+
+	subject, err := claims.GetSubject()
+	if err != nil || subject == "" {
+		return Principal{}, fmt.Errorf("%w: missing sub claim", ErrInvalidToken)
+	}
+
+	roles := v.roles(claims)
+	name, _ := claims["name"].(string)
+	if name == "" {
+		name, _ = claims["preferred_username"].(string)
+	}
+	if name == "" {
+		name = subject
+	}
+
+	return Principal{
+		Subject: subject,
+		Name:    name,
+		Roles:   roles,
+		Scopes:  ScopesForRoles(roles),
+	}, nil
+}
+
+func (v *JWTVerifier) roles(claims jwt.MapClaims) []string {
+	var value interface{} = map[string]interface{}(claims)
+	for _, part := range strings.Split(v.opts.RolesClaim, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = object[part]
+	}
+
+	var raw []string
+	switch typed := value.(type) {
+	case string:
+		raw = strings.Fields(typed)
+	case []interface{}:
+		for _, item := range typed {
+			if s, ok := item.(string); ok {
+				raw = append(raw, s)
+			}
+		}
+	}
+
+	var roles []string
+	for _, role := range raw {
+		role = strings.ToLower(role)
+		if mapped, ok := v.opts.RoleMapping[role]; ok {
+			role = mapped
+		}
+		if IsRole(role) {
+			roles = append(roles, role)
+		}
+	}
+	return roles
+}
@@ -0,0 +1,261 @@
+package auth_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"song-lib/internal/auth"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const (
+	issuer   = "https://id.example.com"
+	audience = "song-lib"
+)
+
+// newSigner generates a key the way songctl token keygen does and loads it
+// back.
+func newSigner(t *testing.T) crypto.Signer {
+	t.Helper()
+
+	pem, err := auth.GenerateSigningKey()
+	if err != nil {
+		t.Fatalf("GenerateSigningKey: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "jwt.pem")
+	if err := os.WriteFile(path, pem, 0o600); err != nil {
+		t.Fatalf("write key: %v", err)
+	}
+	signer, err := auth.LoadSigningKey(path)
+	if err != nil {
+		t.Fatalf("LoadSigningKey: %v", err)
+	}
+	return signer
+}
+
+func newVerifier(t *testing.T, signer crypto.Signer, opts auth.JWTOptions) *auth.JWTVerifier {
+	t.Helper()
+
+	keys, err := auth.LocalKeySet(signer)
+	if err != nil {
+		t.Fatalf("LocalKeySet: %v", err)
+	}
+	opts.Issuer, opts.Audience = issuer, audience
+	if opts.RolesClaim == "" {
+		opts.RolesClaim = "roles"
+	}
+	return auth.NewJWTVerifier(keys, opts)
+}
+
+func signToken(t *testing.T, signer crypto.Signer, claims auth.TokenClaims) string {
+	t.Helper()
+
+	if claims.Issuer == "" {
+		claims.Issuer = issuer
+	}
+	if claims.Audience == "" {
+		claims.Audience = audience
+	}
+	if claims.TTL == 0 {
+		claims.TTL = time.Hour
+	}
+	token, err := auth.SignToken(signer, claims)
+	if err != nil {
+		t.Fatalf("SignToken: %v", err)
+	}
+	return token
+}
+
+// signClaims signs claims as they are, unlike auth.SignToken.
+func signClaims(t *testing.T, method jwt.SigningMethod, key interface{}, kid string, claims jwt.MapClaims) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("sign %s token: %v", method.Alg(), err)
+	}
+	return signed
+}
+
+func keyID(t *testing.T, signer crypto.Signer) string {
+	t.Helper()
+
+	kid, err := auth.KeyID(signer.Public())
+	if err != nil {
+		t.Fatalf("KeyID: %v", err)
+	}
+	return kid
+}
+
+func TestVerify(t *testing.T) {
+	signer := newSigner(t)
+	verifier := newVerifier(t, signer, auth.JWTOptions{})
+
+	principal, err := verifier.Verify(context.Background(), signToken(t, signer, auth.TokenClaims{
+		Subject: "alice", Name: "Alice", Roles: []string{"Editor", "unknown"},
+	}))
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if principal.Subject != "alice" || principal.Name != "Alice" || !slices.Equal(principal.Roles, []string{auth.RoleEditor}) ||
+		!principal.HasScope(auth.ScopeSongsWrite) || principal.HasScope(auth.ScopeAdmin) {
+		t.Errorf("Verify = %+v, want alice with the editor role and its scopes", principal)
+	}
+}
+
+func TestVerifyRejects(t *testing.T) {
+	signer := newSigner(t)
+	verifier := newVerifier(t, signer, auth.JWTOptions{})
+	kid := keyID(t, signer)
+	now := time.Now()
+	valid := func() jwt.MapClaims {
+		return jwt.MapClaims{"sub": "alice", "iss": issuer, "aud": audience, "exp": now.Add(time.Hour).Unix()}
+	}
+
+	for name, tc := range map[string]struct {
+		token string
+		want  error
+	}{
+		"Expired": {
+			token: signToken(t, signer, auth.TokenClaims{Subject: "alice", TTL: -time.Hour}),
+			want:  jwt.ErrTokenExpired,
+		},
+		"MissingExp": {
+			token: signClaims(t, jwt.SigningMethodEdDSA, signer, kid, jwt.MapClaims{"sub": "alice", "iss": issuer, "aud": audience}),
+			want:  jwt.ErrTokenRequiredClaimMissing,
+		},
+		"WrongIssuer": {
+			token: signToken(t, signer, auth.TokenClaims{Subject: "alice", Issuer: "https://evil.example.com"}),
+			want:  jwt.ErrTokenInvalidIssuer,
+		},
+		"WrongAudience": {
+			token: signToken(t, signer, auth.TokenClaims{Subject: "alice", Audience: "other-api"}),
+			want:  jwt.ErrTokenInvalidAudience,
+		},
+		"MissingSubject": {
+			token: signClaims(t, jwt.SigningMethodEdDSA, signer, kid, func() jwt.MapClaims { c := valid(); delete(c, "sub"); return c }()),
+		},
+		// The public key used as an HMAC secret.
+		"HS256": {
+			token: signClaims(t, jwt.SigningMethodHS256, []byte(signer.Public().(ed25519.PublicKey)), kid, valid()),
+			want:  jwt.ErrTokenSignatureInvalid,
+		},
+		"None": {
+			token: signClaims(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, kid, valid()),
+			want:  jwt.ErrTokenSignatureInvalid,
+		},
+		"UnknownKid": {
+			token: signToken(t, newSigner(t), auth.TokenClaims{Subject: "alice"}),
+			want:  auth.ErrUnknownKey,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := verifier.Verify(context.Background(), tc.token)
+			if !errors.Is(err, auth.ErrInvalidToken) || (tc.want != nil && !errors.Is(err, tc.want)) {
+				t.Errorf("Verify error = %v, want ErrInvalidToken wrapping %v", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestVerifyRolesClaim(t *testing.T) {
+	signer := newSigner(t)
+	verifier := newVerifier(t, signer, auth.JWTOptions{
+		RolesClaim:  "realm_access.roles",
+		RoleMapping: map[string]string{"songs-admin": auth.RoleAdmin},
+	})
+	kid := keyID(t, signer)
+	claims := func(roles interface{}) jwt.MapClaims {
+		return jwt.MapClaims{
+			"sub": "alice", "iss": issuer, "aud": audience, "exp": time.Now().Add(time.Hour).Unix(),
+			"realm_access": map[string]interface{}{"roles": roles},
+		}
+	}
+
+	for _, tc := range []struct {
+		claims jwt.MapClaims
+		want   []string
+	}{
+		{claims: claims([]string{"offline_access", "Songs-Admin"}), want: []string{auth.RoleAdmin}},
+		{claims: claims("viewer contributor"), want: []string{auth.RoleViewer, auth.RoleContributor}},
+		{claims: claims([]string{"offline_access"})},
+		{claims: jwt.MapClaims{"sub": "alice", "iss": issuer, "aud": audience, "exp": time.Now().Add(time.Hour).Unix(), "realm_access": "admin"}},
+	} {
+		principal, err := verifier.Verify(context.Background(), signClaims(t, jwt.SigningMethodEdDSA, signer, kid, tc.claims))
+		if err != nil {
+			t.Fatalf("Verify: %v", err)
+		}
+		if !slices.Equal(principal.Roles, tc.want) {
+			t.Errorf("roles of %v = %v, want %v", tc.claims["realm_access"], principal.Roles, tc.want)
+		}
+	}
+}
+
+func TestRemoteKeySet(t *testing.T) {
+	signer := newSigner(t)
+	kid := keyID(t, signer)
+	jwks := fmt.Sprintf(`{"keys":[{"kid":%q,"kty":"OKP","crv":"Ed25519","x":%q}]}`,
+		kid, base64.RawURLEncoding.EncodeToString(signer.Public().(ed25519.PublicKey)))
+
+	var fetches, down atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		fetches.Add(1)
+		if down.Load() != 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(jwks))
+	}))
+	t.Cleanup(server.Close)
+
+	keys := auth.NewRemoteKeySet(server.URL, time.Millisecond)
+	auth.SetMinRefetch(keys, 200*time.Millisecond)
+	if _, err := keys.PublicKey(context.Background(), kid); err != nil {
+		t.Fatalf("PublicKey: %v", err)
+	}
+
+	// The provider goes down once the keys are due for a refresh.
+	down.Store(1)
+	time.Sleep(250 * time.Millisecond)
+	for range 10 {
+		if _, err := keys.PublicKey(context.Background(), kid); err != nil {
+			t.Fatalf("PublicKey during the outage: %v, want the cached key", err)
+		}
+	}
+	deadline := time.Now().Add(time.Second)
+	for fetches.Load() < 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if _, err := keys.PublicKey(context.Background(), "rotated"); !errors.Is(err, auth.ErrUnknownKey) {
+		t.Errorf("PublicKey of an unknown kid = %v, want ErrUnknownKey", err)
+	}
+	if n := fetches.Load(); n != 2 {
+		t.Errorf("JWKS fetched %d times, want a single refresh attempt during the outage", n)
+	}
+
+	t.Run("NeverFetched", func(t *testing.T) {
+		keys := auth.NewRemoteKeySet(server.URL, time.Hour)
+		before := fetches.Load()
+		for range 3 {
+			if _, err := keys.PublicKey(context.Background(), kid); err == nil {
+				t.Fatal("PublicKey without keys succeeded")
+			}
+		}
+		if n := fetches.Load() - before; n != 1 {
+			t.Errorf("JWKS fetched %d times, want 1", n)
+		}
+	})
+}
@@ -0,0 +1,34 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// KeyPrefix starts every API key so that keys are easy to recognise in
+// configs and secret scanners.
+const KeyPrefix = "sl_"
+
+// GenerateKey returns a new plaintext key of the form sl_<prefix>_<secret>,
+// its public prefix and the hash that is stored instead of the key itself.
+func GenerateKey() (key, prefix, hash string, err error) {
+	raw := make([]byte, 24)
+	if _, err := rand.Read(raw); err != nil {
+		return "", "", "", err
+	}
+	encoded := hex.EncodeToString(raw)
+	prefix = encoded[:8]
+	key = KeyPrefix + prefix + "_" + encoded[8:]
+	return key, prefix, HashKey(key), nil
+}
+
+func HashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, KeyPrefix)
+}
@@ -0,0 +1,148 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+	"net/http"
+	"song-lib/internal/logging"
+	"song-lib/internal/models"
+	"strings"
+)
+
+const (
+	HeaderAPIKey     = "X-API-Key"
+	AnonymousSubject = "anonymous"
+)
+
+type KeyAuthenticator interface {
+	Authenticate(ctx context.Context, key string) (models.APIKey, error)
+}
+
+type TokenVerifier interface {
+	Verify(ctx context.Context, token string) (Principal, error)
+}
+
+type UserResolver interface {
+	Resolve(ctx context.Context, principal Principal) (Principal, error)
+}
+
+// Middleware authenticates the request with an API key passed either in
+// X-API-Key or as an Authorization bearer token and stores the resulting
+// Principal in the request context. Bearer tokens that are not API keys are
+// verified as JWTs when tokens is not nil. The principal is then registered
+// as a user by users, which also settles its role.
+func Middleware(keys KeyAuthenticator, tokens TokenVerifier, users UserResolver, fallback *zap.SugaredLogger) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			req := ctx.Request()
+			logger := logging.FromContext(req.Context(), fallback)
+
+			token := credentials(req)
+			if token == "" {
+				ctx.Response().Header().Set(echo.HeaderWWWAuthenticate, "Bearer")
+				return echo.NewHTTPError(http.StatusUnauthorized, "missing credentials")
+			}
+
+			var principal Principal
+			if tokens != nil && !IsAPIKey(token) {
+				var err error
+				principal, err = tokens.Verify(req.Context(), token)
+				if err != nil {
+					logger.Warnw("rejected invalid bearer token", "error", err)
+					ctx.Response().Header().Set(echo.HeaderWWWAuthenticate, `Bearer error="invalid_token"`)
+					return echo.NewHTTPError(http.StatusUnauthorized, "invalid token")
+				}
+			} else {
+				key, err := keys.Authenticate(req.Context(), token)
+				if errors.Is(err, models.ErrAPIKeyNotFound) {
+					logger.Warnw("rejected invalid api key")
+					ctx.Response().Header().Set(echo.HeaderWWWAuthenticate, `Bearer error="invalid_token"`)
+					return echo.NewHTTPError(http.StatusUnauthorized, "invalid api key")
+				}
+				if err != nil {
+					logger.Errorw("failed to authenticate api key", "error", err)
+					return echo.NewHTTPError(http.StatusInternalServerError, "failed to authenticate")
+				}
+
+				principal = Principal{
+					Subject: fmt.Sprintf("apikey:%d", key.ID),
+					Name:    key.Name,
+					KeyID:   key.ID,
+					Scopes:  key.Scopes,
+				}
+			}
+
+			resolved, err := users.Resolve(req.Context(), principal)
+			if err != nil {
+				logger.Errorw("failed to resolve user", "subject", principal.Subject, "error", err)
+				return echo.NewHTTPError(http.StatusInternalServerError, "failed to authenticate")
+			}
+			principal = resolved
+
+			reqCtx := WithPrincipal(req.Context(), principal)
+			reqCtx = logging.WithLogger(reqCtx, logger.With("principal", principal.Subject))
+			ctx.SetRequest(req.WithContext(reqCtx))
+			return next(ctx)
+		}
+	}
+}
+
+func RequireScope(scope string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			principal, ok := PrincipalFrom(ctx.Request().Context())
+			if !ok {
+				return echo.NewHTTPError(http.StatusUnauthorized, "missing credentials")
+			}
+			if !principal.HasScope(scope) {
+				return echo.NewHTTPError(http.StatusForbidden, fmt.Sprintf("missing scope %s", scope))
+			}
+			return next(ctx)
+		}
+	}
+}
+
+func credentials(req *http.Request) string {
+	if key := req.Header.Get(HeaderAPIKey); key != "" {
+		return key
+	}
+	scheme, token, ok := strings.Cut(req.Header.Get(echo.HeaderAuthorization), " ")
+	if ok && strings.EqualFold(scheme, "Bearer") {
+		return strings.TrimSpace(token)
+	}
+	return ""
+}
+
+// ClientIP is the IP of the client as the server's IPExtractor sees it. Echo
+// believes X-Forwarded-For and X-Real-IP from anybody when no extractor is
+// set, so the connection address is used then.
+func ClientIP(ctx echo.Context) string {
+	if ctx.Echo().IPExtractor == nil {
+		return echo.ExtractIPDirect()(ctx.Request())
+	}
+	return ctx.RealIP()
+}
+
+// ClientKey identifies the client of a request for per-client state such as
+// rate limit buckets: by principal when authenticated, by IP otherwise.
+func ClientKey(ctx echo.Context) string {
+	if principal, ok := PrincipalFrom(ctx.Request().Context()); ok && principal.Subject != AnonymousSubject {
+		return principal.Subject
+	}
+	return "ip:" + ClientIP(ctx)
+}
+
+// Anonymous stands in for Middleware when authentication is disabled and
+// grants every request full access.
+func Anonymous() echo.MiddlewareFunc {
+	principal := Principal{Subject: AnonymousSubject, Name: AnonymousSubject, Scopes: []string{ScopeAdmin}}
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			ctx.SetRequest(ctx.Request().WithContext(WithPrincipal(ctx.Request().Context(), principal)))
+			return next(ctx)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package auth
+
+import (
+	"context"
+	"slices"
+)
+
+type Principal struct {
+	Subject string   `json:"subject"`
+	Name    string   `json:"name"`
+	UserID  int      `json:"user_id,omitempty"`
+	KeyID   int      `json:"key_id,omitempty"`
+	Roles   []string `json:"roles,omitempty"`
+	Scopes  []string `json:"scopes"`
+}
+
+// HasScope reports whether the principal was granted scope; admin implies
+// every other scope.
+func (p Principal) HasScope(scope string) bool {
+	return slices.Contains(p.Scopes, ScopeAdmin) || slices.Contains(p.Scopes, scope)
+}
+
+// HasRole reports whether the principal holds role; admin implies every
+// other role.
+func (p Principal) HasRole(role string) bool {
+	return slices.Contains(p.Roles, RoleAdmin) || slices.Contains(p.Roles, role)
+}
+
+type principalKey struct{}
+
+func WithPrincipal(ctx context.Context, principal Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+func PrincipalFrom(ctx context.Context) (Principal, bool) {
+	principal, ok := ctx.Value(principalKey{}).(Principal)
+	return principal, ok
+}
@@ -0,0 +1,62 @@
+package auth
+
+import "slices"
+
+const (
+	RoleViewer      = "viewer"
+	RoleContributor = "contributor"
+	RoleEditor      = "editor"
+	RoleAdmin       = "admin"
+)
+
+// Roles is ordered from least to most privileged. Contributors and editors
+// share scopes; SongUseCase limits contributors to the songs they created.
+var Roles = []string{RoleViewer, RoleContributor, RoleEditor, RoleAdmin}
+
+var roleScopes = map[string][]string{
+	RoleViewer:      {ScopeSongsRead},
+	RoleContributor: {ScopeSongsRead, ScopeSongsWrite, ScopeSongsDelete},
+	RoleEditor:      {ScopeSongsRead, ScopeSongsWrite, ScopeSongsDelete},
+	RoleAdmin:       {ScopeAdmin},
+}
+
+func IsRole(role string) bool {
+	_, ok := roleScopes[role]
+	return ok
+}
+
+func ScopesForRoles(roles []string) []string {
+	var scopes []string
+	for _, role := range roles {
+		for _, scope := range roleScopes[role] {
+			if !slices.Contains(scopes, scope) {
+				scopes = append(scopes, scope)
+			}
+		}
+	}
+	return scopes
+}
+
+// HighestRole returns the most privileged of roles, or "" if none is known.
+func HighestRole(roles []string) string {
+	highest := ""
+	for _, role := range roles {
+		if slices.Index(Roles, role) > slices.Index(Roles, highest) {
+			highest = role
+		}
+	}
+	return highest
+}
+
+// RoleForScopes maps API key scopes onto a role so keys keep editing every
+// song, as they did before ownership existed.
+func RoleForScopes(scopes []string) string {
+	switch {
+	case slices.Contains(scopes, ScopeAdmin):
+		return RoleAdmin
+	case slices.Contains(scopes, ScopeSongsWrite), slices.Contains(scopes, ScopeSongsDelete):
+		return RoleEditor
+	default:
+		return RoleViewer
+	}
+}
@@ -0,0 +1,27 @@
+package auth
+
+import (
+	"fmt"
+	"slices"
+)
+
+const (
+	ScopeSongsRead   = "songs:read"
+	ScopeSongsWrite  = "songs:write"
+	ScopeSongsDelete = "songs:delete"
+	ScopeAdmin       = "admin"
+)
+
+var Scopes = []string{ScopeSongsRead, ScopeSongsWrite, ScopeSongsDelete, ScopeAdmin}
+
+func ValidateScopes(scopes []string) error {
+	if len(scopes) == 0 {
+		return fmt.Errorf("at least one scope is required")
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(Scopes, scope) {
+			return fmt.Errorf("unknown scope %q, expected one of %v", scope, Scopes)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// WebhookSecretPrefix starts every webhook signing secret, like KeyPrefix
+// does for API keys.
+const WebhookSecretPrefix = "whsec_"
+
+var ErrInvalidSignature = errors.New("invalid webhook signature")
+
+func GenerateWebhookSecret() (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return WebhookSecretPrefix + hex.EncodeToString(raw), nil
+}
+
+// SignWebhook returns the X-Songlib-Signature header of a delivery of body
+// sent at t: "t=<unix seconds>,v1=<hex HMAC-SHA256 of "<t>.<body>">". The
+// timestamp is signed too, so a captured delivery cannot be replayed later
+// with a fresh one.
+func SignWebhook(secret string, t time.Time, body []byte) string {
+	timestamp := strconv.FormatInt(t.Unix(), 10)
+	return "t=" + timestamp + ",v1=" + webhookMAC(secret, timestamp, body)
+}
+
+// VerifyWebhook checks a signature made by SignWebhook and rejects it when
+// its timestamp is further than tolerance from now.
+func VerifyWebhook(secret, signature string, body []byte, tolerance time.Duration) error {
+	var timestamp string
+	var macs []string
+	for _, part := range strings.Split(signature, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			macs = append(macs, value)
+		}
+	}
+
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || len(macs) == 0 {
+		return ErrInvalidSignature
+	}
+	if age := time.Since(time.Unix(unix, 0)); age > tolerance || age < -tolerance {
+		return ErrInvalidSignature
+	}
+
+	expected := webhookMAC(secret, timestamp, body)
+	for _, mac := range macs {
+		if hmac.Equal([]byte(mac), []byte(expected)) {
+			return nil
+		}
+	}
+	return ErrInvalidSignature
+}
+
+func webhookMAC(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,90 @@
+package cache
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jmoiron/sqlx"
+	"time"
+)
+
+// Postgres keeps entries in a table with (key TEXT PRIMARY KEY, value BYTEA, expires_at TIMESTAMPTZ).
+type Postgres struct {
+	db    *sqlx.DB
+	table string
+}
+
+func NewPostgres(db *sqlx.DB, table string) *Postgres {
+	return &Postgres{db: db, table: table}
+}
+
+func (p *Postgres) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	query, args, err := sq.Select("value").
+		From(p.table).
+		Where(sq.Eq{"key": key}).
+		Where("expires_at > now()").
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return nil, false, err
+	}
+
+	var value []byte
+	err = p.db.QueryRowContext(ctx, query, args...).Scan(&value)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+func (p *Postgres) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	query, args, err := sq.Insert(p.table).
+		Columns("key", "value", "expires_at").
+		Values(key, value, time.Now().Add(ttl)).
+		Suffix("ON CONFLICT (key) DO UPDATE SET value = EXCLUDED.value, expires_at = EXCLUDED.expires_at").
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	_, err = p.db.ExecContext(ctx, query, args...)
+	return err
+}
+
+func (p *Postgres) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	query, args, err := sq.Delete(p.table).
+		Where(sq.Eq{"key": keys}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	_, err = p.db.ExecContext(ctx, query, args...)
+	return err
+}
+
+func (p *Postgres) DeleteExpired(ctx context.Context) (int64, error) {
+	query, args, err := sq.Delete(p.table).
+		Where("expires_at <= now()").
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return 0, err
+	}
+
+	res, err := p.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -1,36 +1,719 @@
 package config
 
 import (
+	"errors"
+	"fmt"
 	"github.com/spf13/viper"
+	"go.uber.org/zap/zapcore"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 )
 
-type Config struct {
-	Server struct {
-		Host string `mapstructure:"host"`
-		Port string `mapstructure:"port"`
+const EnvPrefix = "SONGLIB"
+
+type TLSConfig struct {
+	Enabled  bool   `mapstructure:"enabled"`
+	CertFile string `mapstructure:"cert_file"`
+	KeyFile  string `mapstructure:"key_file"`
+}
+
+type ServerConfig struct {
+	Host            string        `mapstructure:"host"`
+	Port            string        `mapstructure:"port"`
+	ReadTimeout     time.Duration `mapstructure:"read_timeout"`
+	WriteTimeout    time.Duration `mapstructure:"write_timeout"`
+	IdleTimeout     time.Duration `mapstructure:"idle_timeout"`
+	ShutdownTimeout time.Duration `mapstructure:"shutdown_timeout"`
+	TLS             TLSConfig     `mapstructure:"tls"`
+	// TrustedProxies are the CIDR ranges of the proxies whose
+	// X-Forwarded-For is believed. Without them the client IP is the
+	// address of the connection.
+	TrustedProxies []string `mapstructure:"trusted_proxies"`
+}
+
+func (s ServerConfig) Addr() string {
+	return net.JoinHostPort(s.Host, s.Port)
+}
+
+type DBConfig struct {
+	Host        string `mapstructure:"host"`
+	Port        string `mapstructure:"port"`
+	User        string `mapstructure:"user"`
+	Pass        Secret `mapstructure:"pass"`
+	Name        string `mapstructure:"name"`
+	SSLMode     string `mapstructure:"sslmode"`
+	SSLRootCert string `mapstructure:"sslrootcert"`
+	SSLCert     string `mapstructure:"sslcert"`
+	SSLKey      string `mapstructure:"sslkey"`
+	AutoMigrate bool   `mapstructure:"auto_migrate"`
+	// Isolation applies to units of work run through WithTx; TxRetries is how
+	// many times one is re-run after a serialization failure or deadlock.
+	Isolation string `mapstructure:"isolation"`
+	TxRetries int    `mapstructure:"tx_retries"`
+	// MaxOpenConns of 0 leaves the pool unbounded.
+	MaxOpenConns    int           `mapstructure:"max_open_conns"`
+	MaxIdleConns    int           `mapstructure:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `mapstructure:"conn_max_lifetime"`
+	ConnMaxIdleTime time.Duration `mapstructure:"conn_max_idle_time"`
+	// QueryTimeout is the deadline of each repository call; StatementTimeout
+	// is set on every session so the server also gives up on a statement
+	// whose client went away. 0 disables either.
+	QueryTimeout     time.Duration `mapstructure:"query_timeout"`
+	StatementTimeout time.Duration `mapstructure:"statement_timeout"`
+	// ConnectTimeout is how long startup keeps retrying the first
+	// connection, e.g. while the database container is starting.
+	ConnectTimeout time.Duration  `mapstructure:"connect_timeout"`
+	Replicas       ReplicasConfig `mapstructure:"replicas"`
+}
+
+// ReplicasConfig lists read replicas that song lookups and searches are
+// spread across. ReadYourWrites is how long a client that just wrote reads
+// from the primary; 0 disables the pinning.
+type ReplicasConfig struct {
+	DSNs           []Secret      `mapstructure:"dsns"`
+	HealthInterval time.Duration `mapstructure:"health_interval"`
+	ReadYourWrites time.Duration `mapstructure:"read_your_writes"`
+}
+
+// SQLiteConfig is used when storage is sqlite; migrations follow
+// db.auto_migrate.
+type SQLiteConfig struct {
+	Path string `mapstructure:"path"`
+}
+
+// DSN enables foreign keys and WAL, waits on locks instead of failing with
+// SQLITE_BUSY, starts transactions as writers so they never deadlock on
+// upgrading a read lock, and stores times in a format that sorts as text.
+func (s SQLiteConfig) DSN() string {
+	return "file:" + s.Path + "?_pragma=foreign_keys(1)&_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)" +
+		"&_txlock=immediate&_time_format=sqlite"
+}
+
+// params are the settings besides the address and credentials; lib/pq
+// passes statement_timeout on to the server as a session parameter.
+func (d DBConfig) params() [][2]string {
+	params := [][2]string{{"sslmode", d.SSLMode}}
+	for _, p := range [][2]string{{"sslrootcert", d.SSLRootCert}, {"sslcert", d.SSLCert}, {"sslkey", d.SSLKey}} {
+		if p[1] != "" {
+			params = append(params, p)
+		}
 	}
-	DB struct {
-		Host string `mapstructure:"host"`
-		Port string `mapstructure:"port"`
-		User string `mapstructure:"user"`
-		Pass string `mapstructure:"pass"`
-		Name string `mapstructure:"name"`
+	if d.StatementTimeout > 0 {
+		params = append(params, [2]string{"statement_timeout", strconv.FormatInt(d.StatementTimeout.Milliseconds(), 10)})
 	}
+	return params
+}
+
+// DSN returns a lib/pq key=value connection string.
+func (d DBConfig) DSN() string {
+	params := append([][2]string{
+		{"host", d.Host},
+		{"port", d.Port},
+		{"user", d.User},
+		{"password", string(d.Pass)},
+		{"dbname", d.Name},
+	}, d.params()...)
+
+	parts := make([]string, 0, len(params))
+	for _, p := range params {
+		parts = append(parts, dsnParam(p))
+	}
+	return strings.Join(parts, " ")
+}
+
+// ReplicaDSN adds params to a replica's connection string, either a URL or
+// key=value, so replicas get the TLS settings and statement_timeout of the
+// primary. Settings the string has itself are kept.
+func (d DBConfig) ReplicaDSN(dsn string) (string, error) {
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		u, err := url.Parse(dsn)
+		if err != nil {
+			return "", err
+		}
+		query := u.Query()
+		for _, p := range d.params() {
+			if !query.Has(p[0]) {
+				query.Set(p[0], p[1])
+			}
+		}
+		u.RawQuery = query.Encode()
+		return u.String(), nil
+	}
+
+	parts := []string{dsn}
+	for _, p := range d.params() {
+		if !regexp.MustCompile(`(^|\s)` + p[0] + `\s*=`).MatchString(dsn) {
+			parts = append(parts, dsnParam(p))
+		}
+	}
+	return strings.Join(parts, " "), nil
+}
+
+func dsnParam(p [2]string) string {
+	value := strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(p[1])
+	return fmt.Sprintf("%s='%s'", p[0], value)
+}
+
+// URL returns the same connection settings as a postgres:// URL.
+func (d DBConfig) URL() string {
+	query := url.Values{}
+	for _, p := range d.params() {
+		query.Set(p[0], p[1])
+	}
+	u := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(d.User, string(d.Pass)),
+		Host:     net.JoinHostPort(d.Host, d.Port),
+		Path:     "/" + d.Name,
+		RawQuery: query.Encode(),
+	}
+	return u.String()
+}
+
+type BreakerConfig struct {
+	FailureThreshold int           `mapstructure:"failure_threshold"`
+	OpenTimeout      time.Duration `mapstructure:"open_timeout"`
+}
+
+type ExternalAPIConfig struct {
+	URL     string        `mapstructure:"url"`
+	Breaker BreakerConfig `mapstructure:"breaker"`
+}
+
+type LyricsCacheConfig struct {
+	Enabled     bool          `mapstructure:"enabled"`
+	Store       string        `mapstructure:"store"`
+	Size        int           `mapstructure:"size"`
+	TTL         time.Duration `mapstructure:"ttl"`
+	NegativeTTL time.Duration `mapstructure:"negative_ttl"`
+}
+
+// SongCacheConfig caches song reads in front of the repository. MaxAge is
+// the Cache-Control max-age of read responses, sent even with the cache
+// disabled; 0 sends no-cache.
+type SongCacheConfig struct {
+	Enabled bool          `mapstructure:"enabled"`
+	Store   string        `mapstructure:"store"`
+	Size    int           `mapstructure:"size"`
+	TTL     time.Duration `mapstructure:"ttl"`
+	ListTTL time.Duration `mapstructure:"list_ttl"`
+	MaxAge  time.Duration `mapstructure:"max_age"`
+}
+
+// RedisConfig is the server behind redis stores; anything speaking the
+// Redis protocol works, e.g. cmd/mockredis.
+type RedisConfig struct {
+	Addr      string `mapstructure:"addr"`
+	Password  Secret `mapstructure:"password"`
+	DB        int    `mapstructure:"db"`
+	KeyPrefix string `mapstructure:"key_prefix"`
+}
+
+type JWTConfig struct {
+	Enabled      bool          `mapstructure:"enabled"`
+	JWKSURL      string        `mapstructure:"jwks_url"`
+	JWKSFile     string        `mapstructure:"jwks_file"`
+	LocalKeyFile string        `mapstructure:"local_key_file"`
+	JWKSRefresh  time.Duration `mapstructure:"jwks_refresh"`
+	Issuer       string        `mapstructure:"issuer"`
+	Audience     string        `mapstructure:"audience"`
+	Leeway       time.Duration `mapstructure:"leeway"`
+	RolesClaim   string        `mapstructure:"roles_claim"`
+	// RoleMapping keys are lowercased by viper; token roles are matched
+	// case-insensitively.
+	RoleMapping map[string]string `mapstructure:"role_mapping"`
+}
+
+type AuthConfig struct {
+	Enabled bool      `mapstructure:"enabled"`
+	JWT     JWTConfig `mapstructure:"jwt"`
+}
+
+type RateLimitBudget struct {
+	Requests int           `mapstructure:"requests"`
+	Period   time.Duration `mapstructure:"period"`
+	Burst    int           `mapstructure:"burst"`
+}
+
+type RateLimitConfig struct {
+	Enabled    bool            `mapstructure:"enabled"`
+	Store      string          `mapstructure:"store"`
+	Read       RateLimitBudget `mapstructure:"read"`
+	Write      RateLimitBudget `mapstructure:"write"`
+	Enrichment RateLimitBudget `mapstructure:"enrichment"`
+	// Auth is taken per client IP before authentication, so it also counts
+	// requests with a wrong API key or token.
+	Auth RateLimitBudget `mapstructure:"auth"`
+}
+
+type IdempotencyConfig struct {
+	Enabled bool          `mapstructure:"enabled"`
+	Store   string        `mapstructure:"store"`
+	TTL     time.Duration `mapstructure:"ttl"`
+}
+
+type AuditConfig struct {
+	// Retention of audit events; 0 keeps them forever.
+	Retention time.Duration `mapstructure:"retention"`
+}
+
+type OutboxWebhookConfig struct {
+	URL     string        `mapstructure:"url"`
+	Timeout time.Duration `mapstructure:"timeout"`
+}
+
+// OutboxConfig sets up the relay of song changes; the events are written to
+// the outbox even while it is disabled and are delivered once it is enabled.
+type OutboxConfig struct {
+	Enabled        bool                `mapstructure:"enabled"`
+	Sink           string              `mapstructure:"sink"`
+	Interval       time.Duration       `mapstructure:"interval"`
+	BatchSize      int                 `mapstructure:"batch_size"`
+	MaxAttempts    int                 `mapstructure:"max_attempts"`
+	InitialBackoff time.Duration       `mapstructure:"initial_backoff"`
+	MaxBackoff     time.Duration       `mapstructure:"max_backoff"`
+	File           string              `mapstructure:"file"`
+	Webhook        OutboxWebhookConfig `mapstructure:"webhook"`
+}
+
+// WebhooksConfig sets up deliveries to the webhooks subscribed through
+// /api/webhooks, which the outbox relay queues.
+type WebhooksConfig struct {
+	Enabled        bool          `mapstructure:"enabled"`
+	Interval       time.Duration `mapstructure:"interval"`
+	BatchSize      int           `mapstructure:"batch_size"`
+	Workers        int           `mapstructure:"workers"`
+	Timeout        time.Duration `mapstructure:"timeout"`
+	MaxAttempts    int           `mapstructure:"max_attempts"`
+	InitialBackoff time.Duration `mapstructure:"initial_backoff"`
+	MaxBackoff     time.Duration `mapstructure:"max_backoff"`
+	// Retention of delivered and dead deliveries; 0 keeps them forever.
+	Retention time.Duration `mapstructure:"retention"`
+	// AllowInternal lets webhooks reach loopback and private addresses, which
+	// are refused by default so that subscribers cannot probe the internal
+	// network or a cloud metadata service.
+	AllowInternal bool `mapstructure:"allow_internal"`
+}
+
+// SongEventsConfig sets up GET /api/songs/events, which streams the changes
+// read from the audit log.
+type SongEventsConfig struct {
+	Enabled      bool          `mapstructure:"enabled"`
+	PollInterval time.Duration `mapstructure:"poll_interval"`
+	LogSize      int           `mapstructure:"log_size"`
+	Buffer       int           `mapstructure:"buffer"`
+	Heartbeat    time.Duration `mapstructure:"heartbeat"`
+	GapTimeout   time.Duration `mapstructure:"gap_timeout"`
+}
+
+type TracingConfig struct {
+	Exporter    string  `mapstructure:"exporter"`
+	Endpoint    string  `mapstructure:"endpoint"`
+	Insecure    bool    `mapstructure:"insecure"`
+	SampleRatio float64 `mapstructure:"sample_ratio"`
+	ServiceName string  `mapstructure:"service_name"`
+}
+
+type LogConfig struct {
+	Level  string `mapstructure:"level"`
+	Format string `mapstructure:"format"`
+}
+
+type Config struct {
+	// Storage is postgres, sqlite or memory; memory keeps everything in
+	// process and needs no database.
+	Storage     string            `mapstructure:"storage"`
+	Server      ServerConfig      `mapstructure:"server"`
+	DB          DBConfig          `mapstructure:"db"`
+	SQLite      SQLiteConfig      `mapstructure:"sqlite"`
+	ExternalAPI ExternalAPIConfig `mapstructure:"external_api"`
+	LyricsCache LyricsCacheConfig `mapstructure:"lyrics_cache"`
+	SongCache   SongCacheConfig   `mapstructure:"song_cache"`
+	Redis       RedisConfig       `mapstructure:"redis"`
+	Auth        AuthConfig        `mapstructure:"auth"`
+	RateLimit   RateLimitConfig   `mapstructure:"rate_limit"`
+	Idempotency IdempotencyConfig `mapstructure:"idempotency"`
+	Audit       AuditConfig       `mapstructure:"audit"`
+	Outbox      OutboxConfig      `mapstructure:"outbox"`
+	Webhooks    WebhooksConfig    `mapstructure:"webhooks"`
+	SongEvents  SongEventsConfig  `mapstructure:"song_events"`
+	Tracing     TracingConfig     `mapstructure:"tracing"`
+	Log         LogConfig         `mapstructure:"log"`
 }
 
 var AppConfig Config
 
-func SetUp() error {
-	viper.SetConfigName("config")
-	viper.SetConfigType("yaml")
-	viper.AddConfigPath("./internal/config/")
+// legacyEnv lists the unprefixed variables passed by Docker-compose.yml.
+var legacyEnv = map[string]string{
+	"server.port": "SERVER_PORT",
+	"db.host":     "DATABASE_HOST",
+	"db.port":     "DATABASE_PORT",
+	"db.user":     "DATABASE_USER",
+	"db.pass":     "DATABASE_PASSWORD",
+	"db.name":     "DATABASE_NAME",
+}
 
-	if err := viper.ReadInConfig(); err != nil {
-		return err
+func setDefaults(v *viper.Viper) {
+	v.SetDefault("storage", "postgres")
+
+	v.SetDefault("server.host", "0.0.0.0")
+	v.SetDefault("server.port", "8080")
+	v.SetDefault("server.read_timeout", 15*time.Second)
+	v.SetDefault("server.write_timeout", 30*time.Second)
+	v.SetDefault("server.idle_timeout", 2*time.Minute)
+	v.SetDefault("server.shutdown_timeout", 10*time.Second)
+	v.SetDefault("server.tls.enabled", false)
+	v.SetDefault("server.tls.cert_file", "")
+	v.SetDefault("server.tls.key_file", "")
+	v.SetDefault("server.trusted_proxies", []string{})
+
+	v.SetDefault("db.host", "localhost")
+	v.SetDefault("db.port", "5432")
+	v.SetDefault("db.user", "postgres")
+	v.SetDefault("db.pass", "")
+	v.SetDefault("db.name", "songDB")
+	v.SetDefault("db.sslmode", "disable")
+	v.SetDefault("db.sslrootcert", "")
+	v.SetDefault("db.sslcert", "")
+	v.SetDefault("db.sslkey", "")
+	v.SetDefault("db.auto_migrate", true)
+	v.SetDefault("db.isolation", "read_committed")
+	v.SetDefault("db.tx_retries", 3)
+	v.SetDefault("db.max_open_conns", 25)
+	v.SetDefault("db.max_idle_conns", 10)
+	v.SetDefault("db.conn_max_lifetime", 30*time.Minute)
+	v.SetDefault("db.conn_max_idle_time", 5*time.Minute)
+	v.SetDefault("db.query_timeout", 10*time.Second)
+	v.SetDefault("db.statement_timeout", 30*time.Second)
+	v.SetDefault("db.connect_timeout", 30*time.Second)
+	v.SetDefault("db.replicas.dsns", []string{})
+	v.SetDefault("db.replicas.health_interval", 5*time.Second)
+	v.SetDefault("db.replicas.read_your_writes", 5*time.Second)
+
+	v.SetDefault("sqlite.path", "song-lib.db")
+
+	v.SetDefault("external_api.url", "http://localhost:8081")
+	v.SetDefault("external_api.breaker.failure_threshold", 5)
+	v.SetDefault("external_api.breaker.open_timeout", 30*time.Second)
+
+	v.SetDefault("lyrics_cache.enabled", true)
+	v.SetDefault("lyrics_cache.store", "lru")
+	v.SetDefault("lyrics_cache.size", 1000)
+	v.SetDefault("lyrics_cache.ttl", 24*time.Hour)
+	v.SetDefault("lyrics_cache.negative_ttl", 10*time.Minute)
+
+	v.SetDefault("song_cache.enabled", false)
+	v.SetDefault("song_cache.store", "memory")
+	v.SetDefault("song_cache.size", 10000)
+	v.SetDefault("song_cache.ttl", 5*time.Minute)
+	v.SetDefault("song_cache.list_ttl", 30*time.Second)
+	v.SetDefault("song_cache.max_age", 10*time.Second)
+
+	v.SetDefault("redis.addr", "localhost:6379")
+	v.SetDefault("redis.password", "")
+	v.SetDefault("redis.db", 0)
+	v.SetDefault("redis.key_prefix", "songlib:")
+
+	v.SetDefault("auth.enabled", true)
+	v.SetDefault("auth.jwt.enabled", false)
+	v.SetDefault("auth.jwt.jwks_url", "")
+	v.SetDefault("auth.jwt.jwks_file", "")
+	v.SetDefault("auth.jwt.local_key_file", "")
+	v.SetDefault("auth.jwt.jwks_refresh", 15*time.Minute)
+	v.SetDefault("auth.jwt.issuer", "")
+	v.SetDefault("auth.jwt.audience", "song-lib")
+	v.SetDefault("auth.jwt.leeway", 30*time.Second)
+	v.SetDefault("auth.jwt.roles_claim", "roles")
+
+	v.SetDefault("rate_limit.enabled", true)
+	v.SetDefault("rate_limit.store", "memory")
+	v.SetDefault("rate_limit.read.requests", 600)
+	v.SetDefault("rate_limit.read.period", time.Minute)
+	v.SetDefault("rate_limit.read.burst", 100)
+	v.SetDefault("rate_limit.write.requests", 60)
+	v.SetDefault("rate_limit.write.period", time.Minute)
+	v.SetDefault("rate_limit.write.burst", 20)
+	v.SetDefault("rate_limit.enrichment.requests", 10)
+	v.SetDefault("rate_limit.enrichment.period", time.Minute)
+	v.SetDefault("rate_limit.enrichment.burst", 5)
+	v.SetDefault("rate_limit.auth.requests", 1200)
+	v.SetDefault("rate_limit.auth.period", time.Minute)
+	v.SetDefault("rate_limit.auth.burst", 200)
+
+	v.SetDefault("idempotency.enabled", true)
+	v.SetDefault("idempotency.store", "memory")
+	v.SetDefault("idempotency.ttl", 24*time.Hour)
+
+	v.SetDefault("audit.retention", 90*24*time.Hour)
+
+	v.SetDefault("outbox.enabled", true)
+	v.SetDefault("outbox.sink", "log")
+	v.SetDefault("outbox.interval", time.Second)
+	v.SetDefault("outbox.batch_size", 100)
+	v.SetDefault("outbox.max_attempts", 10)
+	v.SetDefault("outbox.initial_backoff", time.Second)
+	v.SetDefault("outbox.max_backoff", 10*time.Minute)
+	v.SetDefault("outbox.file", "song-events.jsonl")
+	v.SetDefault("outbox.webhook.url", "")
+	v.SetDefault("outbox.webhook.timeout", 5*time.Second)
+
+	v.SetDefault("webhooks.enabled", true)
+	v.SetDefault("webhooks.interval", time.Second)
+	v.SetDefault("webhooks.batch_size", 100)
+	v.SetDefault("webhooks.workers", 4)
+	v.SetDefault("webhooks.timeout", 5*time.Second)
+	v.SetDefault("webhooks.max_attempts", 8)
+	v.SetDefault("webhooks.initial_backoff", 10*time.Second)
+	v.SetDefault("webhooks.max_backoff", time.Hour)
+	v.SetDefault("webhooks.retention", 30*24*time.Hour)
+	v.SetDefault("webhooks.allow_internal", false)
+
+	v.SetDefault("song_events.enabled", true)
+	v.SetDefault("song_events.poll_interval", time.Second)
+	v.SetDefault("song_events.log_size", 1000)
+	v.SetDefault("song_events.buffer", 64)
+	v.SetDefault("song_events.heartbeat", 15*time.Second)
+	v.SetDefault("song_events.gap_timeout", 5*time.Second)
+
+	v.SetDefault("tracing.exporter", "none")
+	v.SetDefault("tracing.endpoint", "localhost:4318")
+	v.SetDefault("tracing.insecure", true)
+	v.SetDefault("tracing.sample_ratio", 1.0)
+	v.SetDefault("tracing.service_name", "song-lib")
+
+	v.SetDefault("log.level", "info")
+	v.SetDefault("log.format", "json")
+}
+
+// SetUp loads the config file (./internal/config/config.yaml unless path is
+// set), merges config.<profile>.yaml from the same directory on top of it and
+// applies SONGLIB_* environment overrides, e.g. SONGLIB_DB_HOST for db.host.
+// An empty profile falls back to SONGLIB_PROFILE.
+func SetUp(path, profile string) error {
+	v := viper.New()
+	setDefaults(v)
+
+	if path == "" {
+		path = filepath.Join("internal", "config", "config.yaml")
+	}
+	ext := filepath.Ext(path)
+	v.SetConfigFile(path)
+	v.SetConfigType(strings.TrimPrefix(ext, "."))
+	if err := v.ReadInConfig(); err != nil {
+		return fmt.Errorf("failed to read config %s: %w", path, err)
+	}
+
+	if profile == "" {
+		profile = os.Getenv(EnvPrefix + "_PROFILE")
+	}
+	if profile != "" {
+		profilePath := strings.TrimSuffix(path, ext) + "." + profile + ext
+		v.SetConfigFile(profilePath)
+		if err := v.MergeInConfig(); err != nil {
+			return fmt.Errorf("failed to read %q profile %s: %w", profile, profilePath, err)
+		}
+	}
+
+	for _, key := range v.AllKeys() {
+		envs := []string{EnvPrefix + "_" + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))}
+		if legacy, ok := legacyEnv[key]; ok {
+			envs = append(envs, legacy)
+		}
+		if err := v.BindEnv(append([]string{key}, envs...)...); err != nil {
+			return err
+		}
 	}
 
-	if err := viper.Unmarshal(&AppConfig); err != nil {
+	var cfg Config
+	if err := v.Unmarshal(&cfg); err != nil {
+		return fmt.Errorf("failed to decode config: %w", err)
+	}
+	if err := cfg.Validate(); err != nil {
 		return err
 	}
+
+	AppConfig = cfg
+	return nil
+}
+
+func (c Config) Validate() error {
+	var errs []error
+	check := func(ok bool, field, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: "+format, append([]any{field}, args...)...))
+		}
+	}
+
+	check(c.Storage == "postgres" || c.Storage == "sqlite" || c.Storage == "memory", "storage",
+		"must be one of postgres, sqlite, memory, got %q", c.Storage)
+	if c.Storage != "postgres" {
+		check(!c.LyricsCache.Enabled || c.LyricsCache.Store != "postgres", "lyrics_cache.store", "must not be postgres with %s storage", c.Storage)
+		check(!c.RateLimit.Enabled || c.RateLimit.Store != "postgres", "rate_limit.store", "must not be postgres with %s storage", c.Storage)
+		check(!c.Idempotency.Enabled || c.Idempotency.Store != "postgres", "idempotency.store", "must not be postgres with %s storage", c.Storage)
+	}
+	check(c.Storage != "sqlite" || c.SQLite.Path != "", "sqlite.path", "must not be empty")
+
+	check(validPort(c.Server.Port), "server.port", "must be a number between 1 and 65535, got %q", c.Server.Port)
+	check(c.Server.ReadTimeout >= 0, "server.read_timeout", "must not be negative")
+	check(c.Server.WriteTimeout >= 0, "server.write_timeout", "must not be negative")
+	check(c.Server.IdleTimeout >= 0, "server.idle_timeout", "must not be negative")
+	check(c.Server.ShutdownTimeout > 0, "server.shutdown_timeout", "must be positive")
+	if c.Server.TLS.Enabled {
+		check(c.Server.TLS.CertFile != "", "server.tls.cert_file", "is required when TLS is enabled")
+		check(c.Server.TLS.KeyFile != "", "server.tls.key_file", "is required when TLS is enabled")
+	}
+	for _, cidr := range c.Server.TrustedProxies {
+		_, _, err := net.ParseCIDR(cidr)
+		check(err == nil, "server.trusted_proxies", "must be CIDR ranges like 10.0.0.0/8, got %q", cidr)
+	}
+
+	check(c.DB.Host != "", "db.host", "must not be empty")
+	check(validPort(c.DB.Port), "db.port", "must be a number between 1 and 65535, got %q", c.DB.Port)
+	check(c.DB.User != "", "db.user", "must not be empty")
+	check(c.DB.Name != "", "db.name", "must not be empty")
+	check(slices.Contains([]string{"disable", "require", "verify-ca", "verify-full"}, c.DB.SSLMode),
+		"db.sslmode", "must be one of disable, require, verify-ca, verify-full, got %q", c.DB.SSLMode)
+	check((c.DB.SSLCert == "") == (c.DB.SSLKey == ""), "db.sslcert", "must be set together with db.sslkey")
+	check(c.DB.Isolation == "read_committed" || c.DB.Isolation == "repeatable_read" || c.DB.Isolation == "serializable",
+		"db.isolation", "must be one of read_committed, repeatable_read, serializable, got %q", c.DB.Isolation)
+	check(c.DB.TxRetries >= 0, "db.tx_retries", "must not be negative, got %d", c.DB.TxRetries)
+	check(c.DB.MaxOpenConns >= 0, "db.max_open_conns", "must not be negative, got %d", c.DB.MaxOpenConns)
+	check(c.DB.MaxIdleConns >= 0, "db.max_idle_conns", "must not be negative, got %d", c.DB.MaxIdleConns)
+	check(c.DB.MaxOpenConns == 0 || c.DB.MaxIdleConns <= c.DB.MaxOpenConns, "db.max_idle_conns",
+		"must not exceed db.max_open_conns (%d), got %d", c.DB.MaxOpenConns, c.DB.MaxIdleConns)
+	check(c.DB.ConnMaxLifetime >= 0, "db.conn_max_lifetime", "must not be negative")
+	check(c.DB.ConnMaxIdleTime >= 0, "db.conn_max_idle_time", "must not be negative")
+	check(c.DB.QueryTimeout >= 0, "db.query_timeout", "must not be negative")
+	check(c.DB.StatementTimeout >= 0, "db.statement_timeout", "must not be negative")
+	check(c.DB.ConnectTimeout >= 0, "db.connect_timeout", "must not be negative")
+	if replicas := c.DB.Replicas; len(replicas.DSNs) > 0 {
+		check(c.Storage == "postgres", "db.replicas.dsns", "are only supported with postgres storage")
+		check(!slices.Contains(replicas.DSNs, ""), "db.replicas.dsns", "must not contain empty entries")
+		check(replicas.HealthInterval > 0, "db.replicas.health_interval", "must be positive")
+		check(replicas.ReadYourWrites >= 0, "db.replicas.read_your_writes", "must not be negative")
+	}
+
+	apiURL, err := url.Parse(c.ExternalAPI.URL)
+	check(err == nil && (apiURL.Scheme == "http" || apiURL.Scheme == "https") && apiURL.Host != "",
+		"external_api.url", "must be an absolute http(s) URL, got %q", c.ExternalAPI.URL)
+	check(c.ExternalAPI.Breaker.FailureThreshold > 0, "external_api.breaker.failure_threshold", "must be positive")
+	check(c.ExternalAPI.Breaker.OpenTimeout > 0, "external_api.breaker.open_timeout", "must be positive")
+
+	if c.LyricsCache.Enabled {
+		check(c.LyricsCache.Store == "lru" || c.LyricsCache.Store == "postgres",
+			"lyrics_cache.store", "must be one of lru, postgres, got %q", c.LyricsCache.Store)
+		check(c.LyricsCache.Store != "lru" || c.LyricsCache.Size > 0, "lyrics_cache.size", "must be positive")
+		check(c.LyricsCache.TTL > 0, "lyrics_cache.ttl", "must be positive")
+		check(c.LyricsCache.NegativeTTL >= 0, "lyrics_cache.negative_ttl", "must not be negative")
+	}
+
+	if c.SongCache.Enabled {
+		check(c.SongCache.Store == "memory" || c.SongCache.Store == "redis",
+			"song_cache.store", "must be one of memory, redis, got %q", c.SongCache.Store)
+		check(c.SongCache.Store != "memory" || c.SongCache.Size > 0, "song_cache.size", "must be positive")
+		check(c.SongCache.TTL > 0, "song_cache.ttl", "must be positive")
+		check(c.SongCache.ListTTL >= 0, "song_cache.list_ttl", "must not be negative")
+		check(c.SongCache.Store != "redis" || c.Redis.Addr != "", "redis.addr", "is required for the redis song cache store")
+		// Misses go to the primary, and with a cache per process every
+		// instance pulls its own copy of each song off the replicas.
+		check(c.SongCache.Store != "memory" || len(c.DB.Replicas.DSNs) == 0,
+			"song_cache.store", "must be redis when db.replicas.dsns are configured")
+	}
+	check(c.SongCache.MaxAge >= 0, "song_cache.max_age", "must not be negative")
+	check(c.Redis.DB >= 0, "redis.db", "must not be negative")
+
+	if jwt := c.Auth.JWT; jwt.Enabled {
+		check(jwt.JWKSURL != "" || jwt.JWKSFile != "" || jwt.LocalKeyFile != "",
+			"auth.jwt", "one of jwks_url, jwks_file, local_key_file is required when JWT is enabled")
+		check(jwt.Issuer != "", "auth.jwt.issuer", "is required when JWT is enabled")
+		check(jwt.Audience != "", "auth.jwt.audience", "is required when JWT is enabled")
+		check(jwt.Leeway >= 0, "auth.jwt.leeway", "must not be negative")
+		check(jwt.RolesClaim != "", "auth.jwt.roles_claim", "must not be empty")
+		check(jwt.JWKSURL == "" || jwt.JWKSRefresh > 0, "auth.jwt.jwks_refresh", "must be positive")
+	}
+
+	if c.RateLimit.Enabled {
+		check(c.RateLimit.Store == "memory" || c.RateLimit.Store == "postgres",
+			"rate_limit.store", "must be one of memory, postgres, got %q", c.RateLimit.Store)
+		budgets := []struct {
+			name   string
+			budget RateLimitBudget
+		}{{"read", c.RateLimit.Read}, {"write", c.RateLimit.Write}, {"enrichment", c.RateLimit.Enrichment}, {"auth", c.RateLimit.Auth}}
+		for _, b := range budgets {
+			check(b.budget.Requests > 0, "rate_limit."+b.name+".requests", "must be positive")
+			check(b.budget.Period > 0, "rate_limit."+b.name+".period", "must be positive")
+			check(b.budget.Burst > 0, "rate_limit."+b.name+".burst", "must be positive")
+		}
+	}
+
+	if c.Idempotency.Enabled {
+		check(c.Idempotency.Store == "memory" || c.Idempotency.Store == "postgres",
+			"idempotency.store", "must be one of memory, postgres, got %q", c.Idempotency.Store)
+		check(c.Idempotency.TTL > 0, "idempotency.ttl", "must be positive")
+	}
+
+	check(c.Audit.Retention >= 0, "audit.retention", "must not be negative")
+
+	if c.Outbox.Enabled {
+		check(slices.Contains([]string{"log", "file", "webhook"}, c.Outbox.Sink),
+			"outbox.sink", "must be one of log, file, webhook, got %q", c.Outbox.Sink)
+		check(c.Outbox.Interval > 0, "outbox.interval", "must be positive")
+		check(c.Outbox.BatchSize > 0, "outbox.batch_size", "must be positive")
+		check(c.Outbox.MaxAttempts > 0, "outbox.max_attempts", "must be positive")
+		check(c.Outbox.InitialBackoff > 0, "outbox.initial_backoff", "must be positive")
+		check(c.Outbox.MaxBackoff >= c.Outbox.InitialBackoff, "outbox.max_backoff", "must not be less than outbox.initial_backoff")
+		check(c.Outbox.Sink != "file" || c.Outbox.File != "", "outbox.file", "is required for the file sink")
+		if c.Outbox.Sink == "webhook" {
+			webhookURL, err := url.Parse(c.Outbox.Webhook.URL)
+			check(err == nil && (webhookURL.Scheme == "http" || webhookURL.Scheme == "https") && webhookURL.Host != "",
+				"outbox.webhook.url", "must be an absolute http(s) URL, got %q", c.Outbox.Webhook.URL)
+			check(c.Outbox.Webhook.Timeout > 0, "outbox.webhook.timeout", "must be positive")
+		}
+	}
+
+	if c.Webhooks.Enabled {
+		check(c.Outbox.Enabled, "webhooks.enabled", "needs outbox.enabled, the outbox relay queues the deliveries")
+		check(c.Webhooks.Interval > 0, "webhooks.interval", "must be positive")
+		check(c.Webhooks.BatchSize > 0, "webhooks.batch_size", "must be positive")
+		check(c.Webhooks.Workers > 0, "webhooks.workers", "must be positive")
+		check(c.Webhooks.Timeout > 0, "webhooks.timeout", "must be positive")
+		check(c.Webhooks.MaxAttempts > 0, "webhooks.max_attempts", "must be positive")
+		check(c.Webhooks.InitialBackoff > 0, "webhooks.initial_backoff", "must be positive")
+		check(c.Webhooks.MaxBackoff >= c.Webhooks.InitialBackoff, "webhooks.max_backoff", "must not be less than webhooks.initial_backoff")
+		check(c.Webhooks.Retention >= 0, "webhooks.retention", "must not be negative")
+	}
+
+	if c.SongEvents.Enabled {
+		check(c.SongEvents.PollInterval > 0, "song_events.poll_interval", "must be positive")
+		check(c.SongEvents.LogSize > 0, "song_events.log_size", "must be positive")
+		check(c.SongEvents.Buffer > 0, "song_events.buffer", "must be positive")
+		check(c.SongEvents.Heartbeat > 0, "song_events.heartbeat", "must be positive")
+		check(c.SongEvents.GapTimeout >= 0, "song_events.gap_timeout", "must not be negative")
+	}
+
+	check(slices.Contains([]string{"none", "stdout", "otlp"}, c.Tracing.Exporter),
+		"tracing.exporter", "must be one of none, stdout, otlp, got %q", c.Tracing.Exporter)
+	check(c.Tracing.Exporter != "otlp" || c.Tracing.Endpoint != "", "tracing.endpoint", "is required for the otlp exporter")
+	check(c.Tracing.SampleRatio >= 0 && c.Tracing.SampleRatio <= 1, "tracing.sample_ratio", "must be between 0 and 1")
+
+	_, err = zapcore.ParseLevel(c.Log.Level)
+	check(err == nil, "log.level", "must be one of debug, info, warn, error, got %q", c.Log.Level)
+	check(c.Log.Format == "json" || c.Log.Format == "console", "log.format", "must be one of json, console, got %q", c.Log.Format)
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid config: %w", errors.Join(errs...))
+	}
 	return nil
 }
+
+func validPort(port string) bool {
+	n, err := strconv.Atoi(port)
+	return err == nil && n > 0 && n <= 65535
+}
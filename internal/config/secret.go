@@ -0,0 +1,25 @@
+package config
+
+import "encoding/json"
+
+// Secret is a string that never shows up in logs: fmt and JSON (which zap
+// uses for structured fields) only ever see a placeholder. Use string(s) to
+// get the real value.
+type Secret string
+
+const redacted = "[REDACTED]"
+
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return redacted
+}
+
+func (s Secret) GoString() string {
+	return `"` + s.String() + `"`
+}
+
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
@@ -0,0 +1,8 @@
+package db
+
+// MarkUp marks every replica healthy, as if it had passed a health check.
+func MarkUp(s *ReplicaSet) {
+	for _, r := range s.replicas {
+		r.healthy.Store(true)
+	}
+}
@@ -0,0 +1,191 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database/postgres"
+	sqlitemigrate "github.com/golang-migrate/migrate/v4/database/sqlite"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"github.com/jmoiron/sqlx"
+	"io/fs"
+	"song-lib/migrations"
+)
+
+// migrationLockID keys the session-level advisory lock that serializes
+// migrations between replicas sharing one database.
+const migrationLockID int64 = 0x736f6e67 // "song"
+
+type Migrator struct {
+	// conn holds the advisory lock; it is nil for SQLite, where the database
+	// file is not shared between replicas.
+	conn *sql.Conn
+	m    *migrate.Migrate
+}
+
+func NewMigrator(ctx context.Context, db *sqlx.DB) (*Migrator, error) {
+	source, err := iofs.New(migrations.FS, ".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open embedded migrations: %w", err)
+	}
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// Building an index on a large table may well outlast db.statement_timeout.
+	if _, err := conn.ExecContext(ctx, "SET statement_timeout = 0"); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	driver, err := postgres.WithConnection(ctx, conn, &postgres.Config{})
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	m, err := migrate.NewWithInstance("iofs", source, "postgres", driver)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return &Migrator{conn: conn, m: m}, nil
+}
+
+// NewSQLiteMigrator applies migrations/sqlite. It opens its own handle,
+// since closing the migrate driver closes the database it was given.
+func NewSQLiteMigrator(dsn string) (*Migrator, error) {
+	source, err := iofs.New(migrations.SQLite, "sqlite")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open embedded migrations: %w", err)
+	}
+
+	sqliteDB, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	driver, err := sqlitemigrate.WithInstance(sqliteDB, &sqlitemigrate.Config{})
+	if err != nil {
+		_ = sqliteDB.Close()
+		return nil, err
+	}
+
+	m, err := migrate.NewWithInstance("iofs", source, "sqlite", driver)
+	if err != nil {
+		_ = sqliteDB.Close()
+		return nil, err
+	}
+	return &Migrator{m: m}, nil
+}
+
+func (m *Migrator) Up(ctx context.Context) error {
+	return m.withLock(ctx, m.m.Up)
+}
+
+func (m *Migrator) Down(ctx context.Context, steps int) error {
+	if steps <= 0 {
+		return fmt.Errorf("steps must be positive, got %d", steps)
+	}
+	return m.withLock(ctx, func() error {
+		return m.m.Steps(-steps)
+	})
+}
+
+func (m *Migrator) Goto(ctx context.Context, version uint) error {
+	return m.withLock(ctx, func() error {
+		return m.m.Migrate(version)
+	})
+}
+
+func (m *Migrator) Force(ctx context.Context, version int) error {
+	return m.withLock(ctx, func() error {
+		return m.m.Force(version)
+	})
+}
+
+// Version reports the applied schema version; version 0 means no migrations
+// have been applied yet.
+func (m *Migrator) Version() (uint, bool, error) {
+	version, dirty, err := m.m.Version()
+	if errors.Is(err, migrate.ErrNilVersion) {
+		return 0, false, nil
+	}
+	return version, dirty, err
+}
+
+func (m *Migrator) Close() error {
+	sourceErr, dbErr := m.m.Close()
+	return errors.Join(sourceErr, dbErr)
+}
+
+func (m *Migrator) withLock(ctx context.Context, fn func() error) error {
+	if m.conn == nil {
+		return ignoreNoChange(fn())
+	}
+
+	if _, err := m.conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationLockID); err != nil {
+		return fmt.Errorf("failed to acquire migration lock: %w", err)
+	}
+	defer func() {
+		_, _ = m.conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", migrationLockID)
+	}()
+
+	return ignoreNoChange(fn())
+}
+
+func ignoreNoChange(err error) error {
+	if errors.Is(err, migrate.ErrNoChange) {
+		return nil
+	}
+	return err
+}
+
+// LatestVersion returns the highest Postgres migration version embedded in
+// the binary.
+func LatestVersion() (uint, error) {
+	return latestVersion(migrations.FS, ".")
+}
+
+// LatestSQLiteVersion is LatestVersion for migrations/sqlite.
+func LatestSQLiteVersion() (uint, error) {
+	return latestVersion(migrations.SQLite, "sqlite")
+}
+
+func latestVersion(fsys fs.FS, dir string) (uint, error) {
+	source, err := iofs.New(fsys, dir)
+	if err != nil {
+		return 0, err
+	}
+	defer source.Close()
+
+	version, err := source.First()
+	if err != nil {
+		return 0, err
+	}
+	for {
+		next, err := source.Next(version)
+		if errors.Is(err, fs.ErrNotExist) {
+			return version, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		version = next
+	}
+}
+
+// SchemaVersion reads the applied version straight from the migrate table
+// without taking the migration lock.
+func SchemaVersion(ctx context.Context, db *sqlx.DB) (uint, bool, error) {
+	var version uint
+	var dirty bool
+	err := db.QueryRowContext(ctx, "SELECT version, dirty FROM schema_migrations LIMIT 1").Scan(&version, &dirty)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, nil
+	}
+	return version, dirty, err
+}
@@ -1,59 +1,59 @@
 package db
 
 import (
-	"errors"
+	"context"
 	"fmt"
-	"github.com/golang-migrate/migrate/v4"
-	_ "github.com/golang-migrate/migrate/v4/database/postgres"
-	_ "github.com/golang-migrate/migrate/v4/source/file"
 	"github.com/jmoiron/sqlx"
 	_ "github.com/lib/pq"
-	"log/slog"
 	"song-lib/internal/config"
+	"time"
 )
 
+// InitDB connects to Postgres, retrying with backoff for up to
+// db.connect_timeout so the app can start alongside the database.
 func InitDB() (*sqlx.DB, error) {
-	dbInfo := fmt.Sprintf(
-		"host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
-		config.AppConfig.DB.Host,
-		config.AppConfig.DB.Port,
-		config.AppConfig.DB.User,
-		config.AppConfig.DB.Pass,
-		config.AppConfig.DB.Name,
-	)
-	db, err := sqlx.Connect("postgres", dbInfo)
+	cfg := config.AppConfig.DB
+
+	db, err := sqlx.Open("postgres", cfg.DSN())
 	if err != nil {
 		return nil, err
 	}
-	return db, nil
-}
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
 
-func MakeMigrations(up bool) error {
-	dbLine := fmt.Sprintf("postgres://%s:%s@db:%s/%s?sslmode=disable",
-		config.AppConfig.DB.User,
-		config.AppConfig.DB.Pass,
-		config.AppConfig.DB.Port,
-		config.AppConfig.DB.Name,
-	)
-	m, err := migrate.New("file://migrations", dbLine)
-	if err != nil {
-		return err
+	if err := waitFor(db, cfg.ConnectTimeout); err != nil {
+		_ = db.Close()
+		return nil, err
 	}
+	return db, nil
+}
 
-	if up {
-		err = m.Up()
-		if err != nil {
-			if errors.Is(err, migrate.ErrNoChange) {
-				slog.Info("No new migrations to apply")
-				return nil
-			}
-			return err
+// waitFor pings db with backoff until it answers or timeout has passed.
+func waitFor(db *sqlx.DB, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	backoff := 500 * time.Millisecond
+	for attempt := 1; ; attempt++ {
+		err := db.Ping()
+		if err == nil {
+			return nil
 		}
-	} else {
-		err = m.Down()
-		if err != nil {
-			return err
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return fmt.Errorf("gave up after %d attempts: %w", attempt, err)
 		}
+
+		time.Sleep(min(backoff, remaining))
+		backoff = min(2*backoff, 5*time.Second)
+	}
+}
+
+// WithQueryTimeout bounds a repository call by db.query_timeout. Callers
+// defer the returned cancel.
+func WithQueryTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if timeout := config.AppConfig.DB.QueryTimeout; timeout > 0 {
+		return context.WithTimeout(ctx, timeout)
 	}
-	return nil
+	return ctx, func() {}
 }
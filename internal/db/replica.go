@@ -0,0 +1,298 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"io"
+	"net"
+	"song-lib/internal/config"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// ReplicaSet spreads reads across the read replicas that passed their last
+// health check. A nil *ReplicaSet has no replicas.
+type ReplicaSet struct {
+	replicas []*replica
+	next     atomic.Uint64
+}
+
+type replica struct {
+	name    string
+	db      *sqlx.DB
+	healthy atomic.Bool
+	lastErr atomic.Pointer[string]
+}
+
+// ReplicaStatus is a replica's state as of its last health check.
+type ReplicaStatus struct {
+	Name    string `json:"name"`
+	Healthy bool   `json:"healthy"`
+	Error   string `json:"error,omitempty"`
+}
+
+// InitReplicas opens db.replicas.dsns with the primary's pool and session
+// settings and, like InitDB, waits up to db.connect_timeout for them to
+// answer. A replica that is still down then is only marked unhealthy, so it
+// does not keep the app from starting.
+func InitReplicas(ctx context.Context) (*ReplicaSet, error) {
+	cfg := config.AppConfig.DB
+	if len(cfg.Replicas.DSNs) == 0 {
+		return nil, nil
+	}
+
+	set := &ReplicaSet{}
+	for i, rawDSN := range cfg.Replicas.DSNs {
+		dsn, err := cfg.ReplicaDSN(string(rawDSN))
+		if err != nil {
+			_ = set.Close()
+			return nil, fmt.Errorf("replica %d: %w", i+1, err)
+		}
+		replicaDB, err := sqlx.Open("postgres", dsn)
+		if err != nil {
+			_ = set.Close()
+			return nil, fmt.Errorf("replica %d: %w", i+1, err)
+		}
+		replicaDB.SetMaxOpenConns(cfg.MaxOpenConns)
+		replicaDB.SetMaxIdleConns(cfg.MaxIdleConns)
+		replicaDB.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+		replicaDB.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+
+		set.replicas = append(set.replicas, &replica{name: fmt.Sprintf("replica-%d", i+1), db: replicaDB})
+	}
+
+	var wg sync.WaitGroup
+	for _, r := range set.replicas {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = waitFor(r.db, cfg.ConnectTimeout)
+		}()
+	}
+	wg.Wait()
+	set.Check(ctx)
+	return set, nil
+}
+
+// Check pings every replica and returns the statuses of those whose health
+// changed.
+func (s *ReplicaSet) Check(ctx context.Context) []ReplicaStatus {
+	if s == nil {
+		return nil
+	}
+
+	var changed []ReplicaStatus
+	for _, r := range s.replicas {
+		pingCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
+		err := r.db.PingContext(pingCtx)
+		cancel()
+
+		if err != nil {
+			msg := err.Error()
+			r.lastErr.Store(&msg)
+		} else {
+			r.lastErr.Store(nil)
+		}
+		if r.healthy.Swap(err == nil) != (err == nil) {
+			changed = append(changed, r.status())
+		}
+	}
+	return changed
+}
+
+// Status reports every replica, for /status.
+func (s *ReplicaSet) Status() []ReplicaStatus {
+	if s == nil {
+		return nil
+	}
+
+	statuses := make([]ReplicaStatus, 0, len(s.replicas))
+	for _, r := range s.replicas {
+		statuses = append(statuses, r.status())
+	}
+	return statuses
+}
+
+// markDown takes the replica out of rotation until its next health check
+// succeeds.
+func (r *replica) markDown(err error) {
+	msg := err.Error()
+	r.lastErr.Store(&msg)
+	r.healthy.Store(false)
+}
+
+func (r *replica) status() ReplicaStatus {
+	status := ReplicaStatus{Name: r.name, Healthy: r.healthy.Load()}
+	if msg := r.lastErr.Load(); msg != nil {
+		status.Error = *msg
+	}
+	return status
+}
+
+// DBs returns the replica handles by name, e.g. to export pool metrics.
+func (s *ReplicaSet) DBs() map[string]*sqlx.DB {
+	if s == nil {
+		return nil
+	}
+
+	dbs := make(map[string]*sqlx.DB, len(s.replicas))
+	for _, r := range s.replicas {
+		dbs[r.name] = r.db
+	}
+	return dbs
+}
+
+func (s *ReplicaSet) Close() error {
+	if s == nil {
+		return nil
+	}
+
+	var firstErr error
+	for _, r := range s.replicas {
+		if err := r.db.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// pick returns the next healthy replica in turn, or nil when there is none.
+func (s *ReplicaSet) pick() *replica {
+	if s == nil {
+		return nil
+	}
+
+	n := uint64(len(s.replicas))
+	start := s.next.Add(1)
+	for i := uint64(0); i < n; i++ {
+		if r := s.replicas[(start+i)%n]; r.healthy.Load() {
+			return r
+		}
+	}
+	return nil
+}
+
+type primaryKey struct{}
+
+// WithPrimary makes reads under ctx go to the primary, e.g. right after the
+// client wrote and replicas may still lag behind.
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey{}, true)
+}
+
+// Pinned reports whether reads under ctx go to the primary.
+func Pinned(ctx context.Context) bool {
+	pinned, _ := ctx.Value(primaryKey{}).(bool)
+	return pinned
+}
+
+// ReadConn is Conn for read-only queries: outside a transaction and unless
+// ctx asks for the primary, they go to a healthy replica when there is one.
+// A query the replica cannot be reached for is run on the primary instead.
+func ReadConn(ctx context.Context, primary *sqlx.DB, replicas *ReplicaSet) Queryer {
+	if tx, ok := TxFromContext(ctx); ok {
+		return tx
+	}
+	if Pinned(ctx) {
+		return primary
+	}
+	if r := replicas.pick(); r != nil {
+		return &replicaConn{DB: r.db, replica: r, primary: primary}
+	}
+	return primary
+}
+
+// replicaConn queries a replica and falls back to the primary on connection
+// errors, marking the replica down so the next reads skip it.
+type replicaConn struct {
+	*sqlx.DB
+	replica *replica
+	primary *sqlx.DB
+}
+
+func (c *replicaConn) failed(err error) bool {
+	if !isConnError(err) {
+		return false
+	}
+	c.replica.markDown(err)
+	return true
+}
+
+func (c *replicaConn) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	rows, err := c.DB.QueryContext(ctx, query, args...)
+	if c.failed(err) {
+		return c.primary.QueryContext(ctx, query, args...)
+	}
+	return rows, err
+}
+
+func (c *replicaConn) QueryxContext(ctx context.Context, query string, args ...interface{}) (*sqlx.Rows, error) {
+	rows, err := c.DB.QueryxContext(ctx, query, args...)
+	if c.failed(err) {
+		return c.primary.QueryxContext(ctx, query, args...)
+	}
+	return rows, err
+}
+
+func (c *replicaConn) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	row := c.DB.QueryRowContext(ctx, query, args...)
+	if c.failed(row.Err()) {
+		return c.primary.QueryRowContext(ctx, query, args...)
+	}
+	return row
+}
+
+func (c *replicaConn) QueryRowxContext(ctx context.Context, query string, args ...interface{}) *sqlx.Row {
+	row := c.DB.QueryRowxContext(ctx, query, args...)
+	if c.failed(row.Err()) {
+		return c.primary.QueryRowxContext(ctx, query, args...)
+	}
+	return row
+}
+
+func (c *replicaConn) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	res, err := c.DB.ExecContext(ctx, query, args...)
+	if c.failed(err) {
+		return c.primary.ExecContext(ctx, query, args...)
+	}
+	return res, err
+}
+
+func (c *replicaConn) GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	err := c.DB.GetContext(ctx, dest, query, args...)
+	if c.failed(err) {
+		return c.primary.GetContext(ctx, dest, query, args...)
+	}
+	return err
+}
+
+func (c *replicaConn) SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	err := c.DB.SelectContext(ctx, dest, query, args...)
+	if c.failed(err) {
+		return c.primary.SelectContext(ctx, dest, query, args...)
+	}
+	return err
+}
+
+// isConnError reports whether err means the server could not be reached or
+// went away, as opposed to a failed query or a cancelled ctx.
+func isConnError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		// connection_exception and the server shutting down or starting up.
+		return pqErr.Code.Class() == "08" || pqErr.Code == "57P01" || pqErr.Code == "57P02" || pqErr.Code == "57P03"
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNREFUSED)
+}
@@ -0,0 +1,66 @@
+package db_test
+
+import (
+	"context"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"net"
+	"song-lib/internal/config"
+	"song-lib/internal/db"
+	"testing"
+)
+
+// closedPort returns a local port nothing listens on.
+func closedPort(t *testing.T) int {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	_ = listener.Close()
+	return port
+}
+
+func TestReadConnFallsBackToPrimary(t *testing.T) {
+	saved := config.AppConfig
+	t.Cleanup(func() { config.AppConfig = saved })
+	config.AppConfig.DB = config.DBConfig{
+		SSLMode: "disable",
+		Replicas: config.ReplicasConfig{DSNs: []config.Secret{
+			config.Secret(fmt.Sprintf("host=127.0.0.1 port=%d user=songs dbname=songs", closedPort(t))),
+		}},
+	}
+
+	replicas, err := db.InitReplicas(context.Background())
+	if err != nil {
+		t.Fatalf("InitReplicas: %v", err)
+	}
+	t.Cleanup(func() { _ = replicas.Close() })
+	if status := replicas.Status(); len(status) != 1 || status[0].Healthy {
+		t.Fatalf("Status = %+v, want the replica down after startup", status)
+	}
+
+	primary, err := sqlx.Connect("sqlite", ":memory:")
+	if err != nil {
+		t.Fatalf("open primary: %v", err)
+	}
+	t.Cleanup(func() { _ = primary.Close() })
+
+	// The replica went away after its last health check.
+	db.MarkUp(replicas)
+	var answer int
+	if err := db.ReadConn(context.Background(), primary, replicas).QueryRowContext(context.Background(), "SELECT 42").Scan(&answer); err != nil || answer != 42 {
+		t.Fatalf("read = %d, %v; want 42 from the primary", answer, err)
+	}
+	if status := replicas.Status(); status[0].Healthy || status[0].Error == "" {
+		t.Errorf("Status = %+v, want the replica marked down with its error", status)
+	}
+
+	db.MarkUp(replicas)
+	var answers []int
+	if err := db.ReadConn(context.Background(), primary, replicas).SelectContext(context.Background(), &answers, "SELECT 7"); err != nil || len(answers) != 1 || answers[0] != 7 {
+		t.Errorf("select = %v, %v; want [7] from the primary", answers, err)
+	}
+}
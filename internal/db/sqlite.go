@@ -0,0 +1,46 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	_ "modernc.org/sqlite"
+	"song-lib/internal/config"
+)
+
+func InitSQLite() (*sqlx.DB, error) {
+	db, err := sqlx.Connect("sqlite", config.AppConfig.SQLite.DSN())
+	if err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// Open connects to the database behind the configured storage.
+func Open() (*sqlx.DB, error) {
+	switch config.AppConfig.Storage {
+	case "postgres":
+		return InitDB()
+	case "sqlite":
+		return InitSQLite()
+	}
+	return nil, fmt.Errorf("%s storage has no database", config.AppConfig.Storage)
+}
+
+// NewStorageMigrator returns the migrator for the configured storage; db is
+// only used for Postgres.
+func NewStorageMigrator(ctx context.Context, db *sqlx.DB) (*Migrator, error) {
+	if config.AppConfig.Storage == "sqlite" {
+		return NewSQLiteMigrator(config.AppConfig.SQLite.DSN())
+	}
+	return NewMigrator(ctx, db)
+}
+
+// LatestStorageVersion is the schema version the configured storage is
+// expected to be at.
+func LatestStorageVersion() (uint, error) {
+	if config.AppConfig.Storage == "sqlite" {
+		return LatestSQLiteVersion()
+	}
+	return LatestVersion()
+}
@@ -0,0 +1,104 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"github.com/jmoiron/sqlx"
+	"time"
+)
+
+// Queryer is the part of *sqlx.DB and *sqlx.Tx the repositories use, so a
+// query runs the same way inside and outside a transaction.
+type Queryer interface {
+	sqlx.ExtContext
+	GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+	SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+type txKey struct{}
+
+// ContextWithTx carries tx to the repositories called with the returned
+// context.
+func ContextWithTx(ctx context.Context, tx *sqlx.Tx) context.Context {
+	return context.WithValue(ctx, txKey{}, tx)
+}
+
+func TxFromContext(ctx context.Context) (*sqlx.Tx, bool) {
+	tx, ok := ctx.Value(txKey{}).(*sqlx.Tx)
+	return tx, ok
+}
+
+// Conn returns the transaction carried by ctx, or db when there is none.
+func Conn(ctx context.Context, db *sqlx.DB) Queryer {
+	if tx, ok := TxFromContext(ctx); ok {
+		return tx
+	}
+	return db
+}
+
+// TxOptions configure RunTx. Retryable reports errors after which the whole
+// transaction may succeed when run again, such as serialization failures.
+type TxOptions struct {
+	Isolation sql.IsolationLevel
+	Retries   int
+	Retryable func(err error) bool
+}
+
+// RunTx runs fn in a transaction and commits it, rolling back when fn fails.
+// fn runs again, up to opts.Retries more times, while the error is
+// retryable, so it must not have side effects outside the database. A ctx
+// that already carries a transaction joins it instead; retries are then left
+// to the outermost call.
+func RunTx(ctx context.Context, db *sqlx.DB, opts TxOptions, fn func(ctx context.Context) error) error {
+	if _, ok := TxFromContext(ctx); ok {
+		return fn(ctx)
+	}
+
+	backoff := 10 * time.Millisecond
+	for attempt := 0; ; attempt++ {
+		err := runTx(ctx, db, opts, fn)
+		if err == nil || attempt >= opts.Retries || opts.Retryable == nil || !opts.Retryable(err) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func runTx(ctx context.Context, db *sqlx.DB, opts TxOptions, fn func(ctx context.Context) error) error {
+	var txOpts *sql.TxOptions
+	if opts.Isolation != sql.LevelDefault {
+		txOpts = &sql.TxOptions{Isolation: opts.Isolation}
+	}
+
+	tx, err := db.BeginTxx(ctx, txOpts)
+	if err != nil {
+		return err
+	}
+	if err := fn(ContextWithTx(ctx, tx)); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// ParseIsolation maps the db.isolation config value to a level.
+func ParseIsolation(level string) (sql.IsolationLevel, bool) {
+	switch level {
+	case "":
+		return sql.LevelDefault, true
+	case "read_committed":
+		return sql.LevelReadCommitted, true
+	case "repeatable_read":
+		return sql.LevelRepeatableRead, true
+	case "serializable":
+		return sql.LevelSerializable, true
+	}
+	return sql.LevelDefault, false
+}
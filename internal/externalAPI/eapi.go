@@ -3,18 +3,28 @@ package externalAPI
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
 	"io"
 	"net/http"
+	"net/url"
+	"song-lib/internal/tracing"
+	"sync/atomic"
 	"time"
 )
 
+var ErrNotFound = errors.New("song details not found")
+
 type Client struct {
-	BaseURL string
+	BaseURL     string
+	breaker     *Breaker
+	lastLatency atomic.Int64
 }
 
-func NewClient(baseURL string) *Client {
-	return &Client{BaseURL: baseURL}
+func NewClient(baseURL string, breaker *Breaker) *Client {
+	return &Client{BaseURL: baseURL, breaker: breaker}
 }
 
 type SongDetails struct {
@@ -24,15 +34,56 @@ type SongDetails struct {
 }
 
 func (c *Client) GetSongDetails(ctx context.Context, artist, title string) (*SongDetails, error) {
-	url := fmt.Sprintf("%s/info?group=%s&song=%s", c.BaseURL, artist, title)
+	if c.breaker != nil {
+		if err := c.breaker.Allow(); err != nil {
+			return nil, err
+		}
+	}
+
+	ctx, span := tracing.Start(ctx, "externalAPI.GetSongDetails",
+		attribute.String("song.artist", artist),
+		attribute.String("song.title", title),
+	)
+	defer span.End()
+
+	start := time.Now()
+	details, err := c.getSongDetails(ctx, artist, title)
+	c.lastLatency.Store(int64(time.Since(start)))
+	if !errors.Is(err, ErrNotFound) {
+		tracing.RecordError(span, err)
+	}
+
+	if c.breaker != nil {
+		c.breaker.Record(err == nil || errors.Is(err, ErrNotFound) || errors.Is(err, context.Canceled))
+	}
+	return details, err
+}
+
+func (c *Client) BreakerState() BreakerState {
+	if c.breaker == nil {
+		return StateClosed
+	}
+	return c.breaker.State()
+}
 
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+func (c *Client) LastLatency() time.Duration {
+	return time.Duration(c.lastLatency.Load())
+}
+
+func (c *Client) getSongDetails(ctx context.Context, artist, title string) (*SongDetails, error) {
+	query := url.Values{}
+	query.Set("group", artist)
+	query.Set("song", title)
+	reqURL := fmt.Sprintf("%s/info?%s", c.BaseURL, query.Encode())
+
+	req, err := http.NewRequestWithContext(ctx, "GET", reqURL, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	client := &http.Client{
-		Timeout: 10 * time.Second,
+		Timeout:   10 * time.Second,
+		Transport: otelhttp.NewTransport(http.DefaultTransport),
 	}
 	resp, err := client.Do(req)
 	if err != nil {
@@ -45,6 +96,9 @@ func (c *Client) GetSongDetails(ctx context.Context, artist, title string) (*Son
 		}
 	}(resp.Body)
 
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrNotFound
+	}
 	if resp.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("received non-200 response: %d", resp.StatusCode)
 	}
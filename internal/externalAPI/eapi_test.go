@@ -0,0 +1,116 @@
+package externalAPI_test
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"song-lib/internal/externalAPI"
+	"song-lib/internal/mockinfo"
+	"testing"
+	"time"
+)
+
+// newMockinfo serves the fixtures of cmd/mockinfo.
+func newMockinfo(t *testing.T, faults mockinfo.Faults) *httptest.Server {
+	t.Helper()
+
+	fixtures, err := mockinfo.LoadFixtures("../../cmd/mockinfo/fixtures")
+	if err != nil {
+		t.Fatalf("LoadFixtures: %v", err)
+	}
+	server := httptest.NewServer(mockinfo.NewServer(fixtures, faults).Handler())
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestGetSongDetails(t *testing.T) {
+	server := newMockinfo(t, mockinfo.Faults{})
+	client := externalAPI.NewClient(server.URL, nil)
+	ctx := context.Background()
+
+	t.Run("Found", func(t *testing.T) {
+		details, err := client.GetSongDetails(ctx, "muse", "  Hysteria ")
+		if err != nil {
+			t.Fatalf("GetSongDetails: %v", err)
+		}
+		if details.ReleaseDate != "01.12.2003" || details.Link != "https://www.youtube.com/watch?v=3dm_5qWWDV8" || details.Text == "" {
+			t.Errorf("GetSongDetails = %+v", details)
+		}
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		if _, err := client.GetSongDetails(ctx, "Muse", "Unknown Song"); !errors.Is(err, externalAPI.ErrNotFound) {
+			t.Errorf("GetSongDetails error = %v, want ErrNotFound", err)
+		}
+	})
+
+	t.Run("ServerError", func(t *testing.T) {
+		_, err := client.GetSongDetails(ctx, "Mock", "Server Error")
+		if err == nil || errors.Is(err, externalAPI.ErrNotFound) {
+			t.Errorf("GetSongDetails error = %v, want a non-200 error", err)
+		}
+	})
+
+	t.Run("MalformedJSON", func(t *testing.T) {
+		details, err := client.GetSongDetails(ctx, "Mock", "Broken JSON")
+		if err == nil {
+			t.Errorf("GetSongDetails = %+v, want a decoding error", details)
+		}
+	})
+
+	t.Run("Timeout", func(t *testing.T) {
+		// The fixture takes 3s to answer.
+		ctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+		defer cancel()
+
+		start := time.Now()
+		_, err := client.GetSongDetails(ctx, "Mock", "Slow Song")
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("GetSongDetails error = %v, want context.DeadlineExceeded", err)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("GetSongDetails returned after %v, want it to give up at the deadline", elapsed)
+		}
+	})
+}
+
+func TestGetSongDetailsLatency(t *testing.T) {
+	server := newMockinfo(t, mockinfo.Faults{Latency: 50 * time.Millisecond})
+	client := externalAPI.NewClient(server.URL, nil)
+
+	if _, err := client.GetSongDetails(context.Background(), "Muse", "Hysteria"); err != nil {
+		t.Fatalf("GetSongDetails: %v", err)
+	}
+	if latency := client.LastLatency(); latency < 50*time.Millisecond {
+		t.Errorf("LastLatency = %v, want at least the 50ms the server waited", latency)
+	}
+}
+
+func TestGetSongDetailsBreaker(t *testing.T) {
+	server := newMockinfo(t, mockinfo.Faults{})
+	client := externalAPI.NewClient(server.URL, externalAPI.NewBreaker(externalAPI.BreakerOptions{
+		FailureThreshold: 2,
+		OpenTimeout:      time.Minute,
+	}))
+	ctx := context.Background()
+
+	// Not found is an answer, not a failure.
+	for range 3 {
+		_, _ = client.GetSongDetails(ctx, "Muse", "Unknown Song")
+	}
+	if state := client.BreakerState(); state != externalAPI.StateClosed {
+		t.Fatalf("BreakerState after 404s = %v, want closed", state)
+	}
+
+	for range 2 {
+		_, _ = client.GetSongDetails(ctx, "Mock", "Server Error")
+	}
+	_, err := client.GetSongDetails(ctx, "Muse", "Hysteria")
+	if !errors.Is(err, externalAPI.ErrCircuitOpen) {
+		t.Fatalf("GetSongDetails after 2 failures error = %v, want ErrCircuitOpen", err)
+	}
+	var circuitOpen *externalAPI.CircuitOpenError
+	if !errors.As(err, &circuitOpen) || circuitOpen.RetryAfter <= 0 || circuitOpen.RetryAfter > time.Minute {
+		t.Errorf("GetSongDetails error = %#v, want the time left of the open timeout", err)
+	}
+}
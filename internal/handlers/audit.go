@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+	"net/http"
+	"song-lib/internal/logging"
+	"song-lib/internal/models"
+	"song-lib/internal/usecase"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+type AuditHandler struct {
+	auditUseCase *usecase.AuditUseCase
+	logger       *zap.SugaredLogger
+}
+
+func NewAuditHandler(auditUseCase *usecase.AuditUseCase, logger *zap.SugaredLogger) *AuditHandler {
+	return &AuditHandler{auditUseCase: auditUseCase, logger: logger}
+}
+
+// List godoc
+// @Summary List audit events
+// @Description Returns song create, update, delete and restore events, newest first.
+// @Tags audit
+// @Produce json
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Param song_id query int false "Song ID"
+// @Param actor query string false "Actor subject, e.g. apikey:3"
+// @Param from query string false "Start of the time range (RFC 3339, inclusive)"
+// @Param to query string false "End of the time range (RFC 3339, exclusive)"
+// @Param limit query int false "Limit of results (default 100, max 1000)"
+// @Param offset query int false "Offset for pagination"
+// @Success 200 {array} models.AuditEvent "Audit events"
+// @Failure 400 {object} Response "Invalid query parameters"
+// @Failure 401 {object} Response "Missing or invalid credentials"
+// @Failure 429 {object} Response "Rate limit exceeded"
+// @Failure 403 {object} Response "Missing admin scope"
+// @Failure 500 {object} Response "Failed to fetch audit events"
+// @Router /api/audit [get]
+func (h *AuditHandler) List(ctx echo.Context) error {
+	reqCtx := ctx.Request().Context()
+	logger := logging.FromContext(reqCtx, h.logger)
+
+	filter := models.AuditFilter{
+		Actor: ctx.QueryParam("actor"),
+		Limit: defaultAuditLimit,
+	}
+
+	if songID := ctx.QueryParam("song_id"); songID != "" {
+		id, err := strconv.Atoi(songID)
+		if err != nil {
+			return ctx.JSON(http.StatusBadRequest, Response{Code: 400, Message: "invalid song_id value"})
+		}
+		filter.SongID = id
+	}
+	for name, target := range map[string]*time.Time{"from": &filter.From, "to": &filter.To} {
+		if value := ctx.QueryParam(name); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return ctx.JSON(http.StatusBadRequest, Response{Code: 400, Message: "invalid " + name + " value, expected RFC 3339"})
+			}
+			*target = t
+		}
+	}
+	if limit := ctx.QueryParam("limit"); limit != "" {
+		n, err := strconv.ParseUint(limit, 10, 64)
+		if err != nil || n == 0 || n > maxAuditLimit {
+			return ctx.JSON(http.StatusBadRequest, Response{Code: 400, Message: "invalid limit value"})
+		}
+		filter.Limit = n
+	}
+	if offset := ctx.QueryParam("offset"); offset != "" {
+		n, err := strconv.ParseUint(offset, 10, 64)
+		if err != nil {
+			return ctx.JSON(http.StatusBadRequest, Response{Code: 400, Message: "invalid offset value"})
+		}
+		filter.Offset = n
+	}
+
+	events, err := h.auditUseCase.ListEvents(reqCtx, filter)
+	if err != nil {
+		logger.Errorw("failed to fetch audit events", "error", err)
+		return ctx.JSON(http.StatusInternalServerError, Response{Code: 500, Message: "failed to fetch audit events"})
+	}
+	return ctx.JSON(http.StatusOK, events)
+}
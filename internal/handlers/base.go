@@ -43,4 +43,6 @@ type SongResponse struct {
 	ReleaseDate string `json:"release_date"`
 	Text        string ` json:"text"`
 	SourceLink  string `json:"source_link"`
+	CreatedBy   *int   `json:"created_by,omitempty"`
+	UpdatedBy   *int   `json:"updated_by,omitempty"`
 }
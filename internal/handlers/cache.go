@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// CacheControl lets clients reuse successful read responses for maxAge. The
+// responses depend on the caller's credentials, so they are private to the
+// client; errors are never marked cacheable.
+func CacheControl(maxAge time.Duration) echo.MiddlewareFunc {
+	value := "private, no-cache"
+	if seconds := int(maxAge.Seconds()); seconds > 0 {
+		value = "private, max-age=" + strconv.Itoa(seconds)
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			res := ctx.Response()
+			res.Before(func() {
+				if res.Status < http.StatusMultipleChoices && res.Header().Get(echo.HeaderCacheControl) == "" {
+					res.Header().Set(echo.HeaderCacheControl, value)
+				}
+			})
+			return next(ctx)
+		}
+	}
+}
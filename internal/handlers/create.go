@@ -1,8 +1,15 @@
 package handlers
 
 import (
+	"errors"
 	"github.com/labstack/echo/v4"
+	"math"
 	"net/http"
+	"song-lib/internal/externalAPI"
+	"song-lib/internal/logging"
+	"song-lib/internal/models"
+	"song-lib/internal/tracing"
+	"strconv"
 )
 
 // Create godoc
@@ -11,30 +18,66 @@ import (
 // @Tags songs
 // @Accept json
 // @Produce json
+// @Security ApiKeyAuth
+// @Security BearerAuth
 // @Param song body Request true "Song data"
+// @Param Idempotency-Key header string false "Key that makes retries of this request safe"
 // @Success 200 {object} Response "Song was created successfully"
 // @Failure 400 {object} Response "Invalid request body"
 // @Failure 500 {object} Response "Failed to create song"
+// @Failure 401 {object} Response "Missing or invalid credentials"
+// @Failure 409 {object} Response "Song with this group and title already exists, or a request with this idempotency key is in progress"
+// @Failure 422 {object} Response "External API has no details for this song, or idempotency key was used for a different request"
+// @Failure 429 {object} Response "Rate limit exceeded"
+// @Failure 403 {object} Response "Missing songs:write scope"
+// @Failure 503 {object} Response "External API is unavailable, retry after Retry-After seconds"
+// @Header 503 {integer} Retry-After "Seconds until the external API is tried again"
 // @Router /api/songs [post]
 func (s *SongHandler) Create(ctx echo.Context) error {
+	reqCtx, span := tracing.Start(ctx.Request().Context(), "SongHandler.Create")
+	defer span.End()
+
+	logger := logging.FromContext(reqCtx, s.logger)
 	var req Request
 	if err := ctx.Bind(&req); err != nil {
-		s.logger.Warnw("invalid request body", "error", err)
+		logger.Warnw("invalid request body", "error", err)
 		return ctx.JSON(http.StatusBadRequest, Response{
 			Code:    400,
 			Message: "invalid request body",
 		})
 	}
 
-	if err := s.songUseCase.AddSong(ctx.Request().Context(), req.Group, req.Song); err != nil {
-		s.logger.Errorw("failed to create song", "error", err)
+	if err := s.songUseCase.AddSong(reqCtx, req.Group, req.Song); err != nil {
+		if errors.Is(err, models.ErrSongExists) {
+			return ctx.JSON(http.StatusConflict, Response{
+				Code:    409,
+				Message: "song with this group and title already exists",
+			})
+		}
+		if errors.Is(err, externalAPI.ErrNotFound) {
+			return ctx.JSON(http.StatusUnprocessableEntity, Response{
+				Code:    422,
+				Message: "external API has no details for this song",
+			})
+		}
+		var circuitOpen *externalAPI.CircuitOpenError
+		if errors.As(err, &circuitOpen) {
+			// A probe in flight settles within a second or so.
+			retryAfter := max(int(math.Ceil(circuitOpen.RetryAfter.Seconds())), 1)
+			ctx.Response().Header().Set(echo.HeaderRetryAfter, strconv.Itoa(retryAfter))
+			return ctx.JSON(http.StatusServiceUnavailable, Response{
+				Code:    503,
+				Message: "external API is unavailable, try again later",
+			})
+		}
+		logger.Errorw("failed to create song", "error", err)
 		return ctx.JSON(http.StatusInternalServerError, Response{
 			Code:    500,
 			Message: "failed to create song",
 		})
 	}
 
-	s.logger.Infow("song created successfully", "group", req.Group, "song", req.Song)
+	logger.Infow("song created successfully", "group", req.Group, "song", req.Song)
 	return ctx.JSON(http.StatusOK, Response{
 		Code:    200,
 		Message: "song was created successfully",
@@ -1,8 +1,12 @@
 package handlers
 
 import (
+	"errors"
 	"github.com/labstack/echo/v4"
 	"net/http"
+	"song-lib/internal/logging"
+	"song-lib/internal/models"
+	"song-lib/internal/tracing"
 	"strconv"
 )
 
@@ -12,39 +16,53 @@ import (
 // @Tags songs
 // @Accept json
 // @Produce json
+// @Security ApiKeyAuth
+// @Security BearerAuth
 // @Param id path int true "Song ID"
 // @Success 200 {object} Response "Song was deleted successfully"
 // @Failure 400 {object} Response "Invalid song ID"
 // @Failure 404 {object} Response "Song with this ID isn't present"
 // @Failure 500 {object} Response "Failed to delete song"
+// @Failure 401 {object} Response "Missing or invalid credentials"
+// @Failure 429 {object} Response "Rate limit exceeded"
+// @Failure 403 {object} Response "Missing songs:delete scope or not the owner of the song"
 // @Router /api/songs/{id} [delete]
 func (s *SongHandler) Delete(ctx echo.Context) error {
+	reqCtx, span := tracing.Start(ctx.Request().Context(), "SongHandler.Delete")
+	defer span.End()
+
+	logger := logging.FromContext(reqCtx, s.logger)
 	songID, err := strconv.Atoi(ctx.Param("id"))
 	if err != nil {
-		s.logger.Warnw("invalid song id", "error", err, "input", ctx.Param("id"))
+		logger.Warnw("invalid song id", "error", err, "input", ctx.Param("id"))
 		return ctx.JSON(http.StatusBadRequest, Response{
 			Code:    400,
 			Message: "invalid song id",
 		})
 	}
 
-	if exist := s.songUseCase.Exist(ctx.Request().Context(), songID); !exist {
-		s.logger.Warnw("song not found", "song_id", songID)
-		return ctx.JSON(http.StatusNotFound, Response{
-			Code:    404,
-			Message: "song with this id isn't present",
-		})
-	}
-
-	if err = s.songUseCase.DeleteSong(ctx.Request().Context(), songID); err != nil {
-		s.logger.Errorw("failed to delete song", "song_id", songID, "error", err)
+	if err = s.songUseCase.DeleteSong(reqCtx, songID); err != nil {
+		switch {
+		case errors.Is(err, models.ErrSongNotFound):
+			logger.Warnw("song not found", "song_id", songID)
+			return ctx.JSON(http.StatusNotFound, Response{
+				Code:    404,
+				Message: "song with this id isn't present",
+			})
+		case errors.Is(err, models.ErrForbidden):
+			return ctx.JSON(http.StatusForbidden, Response{
+				Code:    403,
+				Message: "only editors can delete songs created by other users",
+			})
+		}
+		logger.Errorw("failed to delete song", "song_id", songID, "error", err)
 		return ctx.JSON(http.StatusInternalServerError, Response{
 			Code:    500,
 			Message: "failed to delete song",
 		})
 	}
 
-	s.logger.Infow("song deleted successfully", "song_id", songID)
+	logger.Infow("song deleted successfully", "song_id", songID)
 	return ctx.JSON(http.StatusOK, Response{
 		Code:    200,
 		Message: "song was deleted successfully",
@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"net/http"
+)
+
+// ErrorHandler renders errors returned by handlers and middleware in the same
+// Response shape the song handlers use.
+func ErrorHandler(err error, ctx echo.Context) {
+	if ctx.Response().Committed {
+		return
+	}
+
+	code := http.StatusInternalServerError
+	message := http.StatusText(code)
+	var httpErr *echo.HTTPError
+	if errors.As(err, &httpErr) {
+		code = httpErr.Code
+		message = fmt.Sprint(httpErr.Message)
+	}
+
+	if ctx.Request().Method == http.MethodHead {
+		_ = ctx.NoContent(code)
+		return
+	}
+	_ = ctx.JSON(code, Response{Code: code, Message: message})
+}
@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+	"slices"
+	"song-lib/internal/logging"
+	"song-lib/internal/models"
+	"song-lib/internal/stream"
+	"strconv"
+	"time"
+)
+
+// eventsRetry is the reconnect delay suggested to clients, also after they
+// are dropped for falling behind.
+const eventsRetry = 3 * time.Second
+
+type EventsHandler struct {
+	hub       *stream.Hub
+	heartbeat time.Duration
+	logger    *zap.SugaredLogger
+}
+
+func NewEventsHandler(hub *stream.Hub, heartbeat time.Duration, logger *zap.SugaredLogger) *EventsHandler {
+	return &EventsHandler{hub: hub, heartbeat: heartbeat, logger: logger}
+}
+
+// Stream godoc
+// @Summary Stream song changes
+// @Description Sends song.created, song.updated and song.deleted events as Server-Sent Events, with the event as data and its audit event ID as id. A client reconnecting with Last-Event-ID first gets the changes it missed that are still in the event log, after a reset event if some are not. Heartbeat comments keep idle streams open.
+// @Tags songs
+// @Produce text/event-stream
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Param Last-Event-ID header int false "ID of the last event received"
+// @Param last_event_id query int false "Same as Last-Event-ID, for clients that cannot set headers"
+// @Param artist query []string false "Only changes of songs by these artists" collectionFormat(multi)
+// @Success 200 {object} models.OutboxEvent "Stream of events"
+// @Failure 400 {object} Response "Invalid Last-Event-ID"
+// @Failure 401 {object} Response "Missing or invalid credentials"
+// @Failure 403 {object} Response "Missing songs:read scope"
+// @Failure 429 {object} Response "Rate limit exceeded"
+// @Failure 503 {object} Response "Event stream not available"
+// @Router /api/songs/events [get]
+func (h *EventsHandler) Stream(ctx echo.Context) error {
+	reqCtx := ctx.Request().Context()
+	logger := logging.FromContext(reqCtx, h.logger)
+
+	lastEventID := int64(-1)
+	value := ctx.Request().Header.Get("Last-Event-ID")
+	if value == "" {
+		value = ctx.QueryParam("last_event_id")
+	}
+	if value != "" {
+		id, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || id < 0 {
+			return ctx.JSON(http.StatusBadRequest, Response{Code: 400, Message: "invalid Last-Event-ID value"})
+		}
+		lastEventID = id
+	}
+	artists := slices.DeleteFunc(ctx.QueryParams()["artist"], func(artist string) bool { return artist == "" })
+
+	sub, err := h.hub.Subscribe(lastEventID, artists)
+	if err != nil {
+		if errors.Is(err, stream.ErrNotReady) || errors.Is(err, stream.ErrClosed) {
+			return ctx.JSON(http.StatusServiceUnavailable, Response{Code: 503, Message: err.Error()})
+		}
+		logger.Errorw("failed to subscribe to song events", "error", err)
+		return ctx.JSON(http.StatusInternalServerError, Response{Code: 500, Message: "failed to subscribe to song events"})
+	}
+	defer h.hub.Unsubscribe(sub)
+
+	res := ctx.Response()
+	// The server write timeout would otherwise cut the stream off.
+	if err := http.NewResponseController(res).SetWriteDeadline(time.Time{}); err != nil {
+		logger.Warnw("failed to clear write deadline of song event stream", "error", err)
+	}
+	res.Header().Set(echo.HeaderContentType, "text/event-stream")
+	res.Header().Set(echo.HeaderCacheControl, "no-cache")
+	res.Header().Set("X-Accel-Buffering", "no")
+	res.WriteHeader(http.StatusOK)
+
+	if _, err := fmt.Fprintf(res, "retry: %d\n\n", eventsRetry.Milliseconds()); err != nil {
+		return nil
+	}
+	if sub.Reset {
+		if _, err := io.WriteString(res, "event: reset\ndata: {}\n\n"); err != nil {
+			return nil
+		}
+	}
+	for _, event := range sub.Backlog {
+		if err := writeEvent(res, event); err != nil {
+			return nil
+		}
+	}
+	res.Flush()
+
+	heartbeat := time.NewTicker(h.heartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-reqCtx.Done():
+			return nil
+		case event, ok := <-sub.Events:
+			if !ok {
+				return nil
+			}
+			if err := writeEvent(res, event); err != nil {
+				return nil
+			}
+		case <-heartbeat.C:
+			if _, err := io.WriteString(res, ": heartbeat\n\n"); err != nil {
+				return nil
+			}
+		}
+		res.Flush()
+	}
+}
+
+func writeEvent(w io.Writer, event models.OutboxEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+	return err
+}
@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"github.com/jmoiron/sqlx"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+	"net/http"
+	"song-lib/internal/db"
+	"song-lib/internal/externalAPI"
+	"sync/atomic"
+	"time"
+)
+
+type HealthHandler struct {
+	db            *sqlx.DB
+	externalAPI   *externalAPI.Client
+	latestVersion uint
+	version       string
+	startedAt     time.Time
+	shuttingDown  atomic.Bool
+	extraStatus   map[string]func() any
+	logger        *zap.SugaredLogger
+}
+
+func NewHealthHandler(db *sqlx.DB, externalAPI *externalAPI.Client, latestVersion uint, version string, logger *zap.SugaredLogger) *HealthHandler {
+	return &HealthHandler{
+		db:            db,
+		externalAPI:   externalAPI,
+		latestVersion: latestVersion,
+		version:       version,
+		startedAt:     time.Now(),
+		extraStatus:   make(map[string]func() any),
+		logger:        logger,
+	}
+}
+
+// AddStatus registers an extra section of the /status report.
+func (h *HealthHandler) AddStatus(name string, fn func() any) {
+	h.extraStatus[name] = fn
+}
+
+// MarkShuttingDown makes /readyz fail so that no new traffic is routed here
+// while in-flight requests drain.
+func (h *HealthHandler) MarkShuttingDown() {
+	h.shuttingDown.Store(true)
+}
+
+type CheckResult struct {
+	Status    string  `json:"status"`
+	LatencyMS float64 `json:"latency_ms,omitempty"`
+	Version   uint    `json:"version,omitempty"`
+	Expected  uint    `json:"expected,omitempty"`
+	State     string  `json:"state,omitempty"`
+	Error     string  `json:"error,omitempty"`
+}
+
+type HealthResponse struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+type PoolStats struct {
+	MaxOpenConnections int     `json:"max_open_connections"`
+	OpenConnections    int     `json:"open_connections"`
+	InUse              int     `json:"in_use"`
+	Idle               int     `json:"idle"`
+	WaitCount          int64   `json:"wait_count"`
+	WaitDurationMS     float64 `json:"wait_duration_ms"`
+	MaxIdleClosed      int64   `json:"max_idle_closed"`
+	MaxLifetimeClosed  int64   `json:"max_lifetime_closed"`
+}
+
+type StatusResponse struct {
+	Version      string                 `json:"version"`
+	StartedAt    time.Time              `json:"started_at"`
+	Uptime       string                 `json:"uptime"`
+	Pool         PoolStats              `json:"pool"`
+	Dependencies map[string]CheckResult `json:"dependencies"`
+	Extra        map[string]any         `json:"extra,omitempty"`
+}
+
+// Live godoc
+// @Summary Liveness probe
+// @Description Returns 200 while the process is able to serve HTTP requests.
+// @Tags health
+// @Produce json
+// @Success 200 {object} HealthResponse "Process is alive"
+// @Router /healthz [get]
+func (h *HealthHandler) Live(ctx echo.Context) error {
+	return ctx.JSON(http.StatusOK, HealthResponse{Status: "ok"})
+}
+
+// Ready godoc
+// @Summary Readiness probe
+// @Description Checks the database connection and the applied migration version. An open external API circuit is reported as degraded but does not fail the probe, since reads keep working without it.
+// @Tags health
+// @Produce json
+// @Success 200 {object} HealthResponse "Ready to serve traffic"
+// @Failure 503 {object} HealthResponse "Not ready"
+// @Router /readyz [get]
+func (h *HealthHandler) Ready(ctx echo.Context) error {
+	checks := map[string]CheckResult{
+		"database":     h.checkDatabase(ctx.Request().Context()),
+		"migrations":   h.checkMigrations(ctx.Request().Context()),
+		"external_api": h.checkExternalAPI(),
+	}
+
+	resp := HealthResponse{Status: "ready", Checks: checks}
+	code := http.StatusOK
+	switch {
+	case h.shuttingDown.Load():
+		resp.Status = "shutting_down"
+		code = http.StatusServiceUnavailable
+	case checks["database"].Status != "ok" || checks["migrations"].Status != "ok":
+		resp.Status = "not_ready"
+		code = http.StatusServiceUnavailable
+	case checks["external_api"].Status != "ok":
+		resp.Status = "degraded"
+	}
+
+	if code != http.StatusOK {
+		h.logger.Warnw("readiness check failed", "checks", checks)
+	}
+	return ctx.JSON(code, resp)
+}
+
+// Status godoc
+// @Summary Service status
+// @Description Returns the build version, uptime, connection pool statistics and per-dependency latency.
+// @Tags health
+// @Produce json
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Success 200 {object} StatusResponse "Service status"
+// @Failure 401 {object} Response "Missing or invalid credentials"
+// @Failure 403 {object} Response "Missing admin scope"
+// @Router /status [get]
+func (h *HealthHandler) Status(ctx echo.Context) error {
+	resp := StatusResponse{
+		Version:   h.version,
+		StartedAt: h.startedAt,
+		Uptime:    time.Since(h.startedAt).Round(time.Second).String(),
+		Dependencies: map[string]CheckResult{
+			"database":     h.checkDatabase(ctx.Request().Context()),
+			"external_api": h.checkExternalAPI(),
+		},
+	}
+	if h.db != nil {
+		resp.Pool = poolStats(h.db.Stats())
+	}
+
+	if len(h.extraStatus) > 0 {
+		resp.Extra = make(map[string]any, len(h.extraStatus))
+		for name, fn := range h.extraStatus {
+			resp.Extra[name] = fn()
+		}
+	}
+	return ctx.JSON(http.StatusOK, resp)
+}
+
+func (h *HealthHandler) checkDatabase(ctx context.Context) CheckResult {
+	if h.db == nil {
+		return CheckResult{Status: "ok", State: "memory"}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	start := time.Now()
+	err := h.db.PingContext(ctx)
+	result := CheckResult{Status: "ok", LatencyMS: milliseconds(time.Since(start))}
+	if err != nil {
+		result.Status = "failing"
+		result.Error = err.Error()
+	}
+	return result
+}
+
+func (h *HealthHandler) checkMigrations(ctx context.Context) CheckResult {
+	if h.db == nil {
+		return CheckResult{Status: "ok", State: "memory"}
+	}
+
+	version, dirty, err := db.SchemaVersion(ctx, h.db)
+	result := CheckResult{Status: "ok", Version: version, Expected: h.latestVersion}
+	switch {
+	case err != nil:
+		result.Status = "failing"
+		result.Error = err.Error()
+	case dirty:
+		result.Status = "failing"
+		result.Error = "schema is dirty"
+	case version < h.latestVersion:
+		result.Status = "pending"
+	}
+	return result
+}
+
+func (h *HealthHandler) checkExternalAPI() CheckResult {
+	state := h.externalAPI.BreakerState()
+	result := CheckResult{
+		Status:    "ok",
+		State:     state.String(),
+		LatencyMS: milliseconds(h.externalAPI.LastLatency()),
+	}
+	if state == externalAPI.StateOpen {
+		result.Status = "degraded"
+	}
+	return result
+}
+
+func poolStats(stats sql.DBStats) PoolStats {
+	return PoolStats{
+		MaxOpenConnections: stats.MaxOpenConnections,
+		OpenConnections:    stats.OpenConnections,
+		InUse:              stats.InUse,
+		Idle:               stats.Idle,
+		WaitCount:          stats.WaitCount,
+		WaitDurationMS:     milliseconds(stats.WaitDuration),
+		MaxIdleClosed:      stats.MaxIdleClosed,
+		MaxLifetimeClosed:  stats.MaxLifetimeClosed,
+	}
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
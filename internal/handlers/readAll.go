@@ -2,9 +2,11 @@ package handlers
 
 import (
 	"github.com/labstack/echo/v4"
-	"go.uber.org/zap"
 	"net/http"
+	"song-lib/internal/auth"
+	"song-lib/internal/logging"
 	"song-lib/internal/models"
+	"song-lib/internal/tracing"
 	"strconv"
 )
 
@@ -14,20 +16,29 @@ import (
 // @Tags songs
 // @Accept json
 // @Produce json
+// @Security ApiKeyAuth
+// @Security BearerAuth
 // @Param artist query string false "Artist name"
 // @Param title query string false "Song title"
 // @Param release_date query string false "Release date"
 // @Param text query string false "Text content"
 // @Param source_link query string false "Source link"
+// @Param created_by query string false "ID of the user who created the song, or me"
 // @Param limit query int false "Limit of results"
 // @Param offset query int false "Offset for pagination"
 // @Success 200 {array} SongResponse "List of songs"
 // @Failure 400 {object} Response "Invalid query parameters"
 // @Failure 500 {object} Response "Failed to fetch songs"
+// @Failure 401 {object} Response "Missing or invalid credentials"
+// @Failure 429 {object} Response "Rate limit exceeded"
+// @Failure 403 {object} Response "Missing songs:read scope"
 // @Router /api/songs/filter [get]
 func (s *SongHandler) GetSongs(ctx echo.Context) error {
-	logger := zap.L()
-	logger.Debug("handling GetSongs request")
+	reqCtx, span := tracing.Start(ctx.Request().Context(), "SongHandler.GetSongs")
+	defer span.End()
+
+	logger := logging.FromContext(reqCtx, s.logger)
+	logger.Debugw("handling GetSongs request")
 
 	filter := models.SongFilter{
 		Artist:      ctx.QueryParam("artist"),
@@ -37,10 +48,30 @@ func (s *SongHandler) GetSongs(ctx echo.Context) error {
 		SourceLink:  ctx.QueryParam("source_link"),
 	}
 
+	if createdBy := ctx.QueryParam("created_by"); createdBy != "" {
+		if createdBy == "me" {
+			principal, _ := auth.PrincipalFrom(reqCtx)
+			filter.CreatedBy = principal.UserID
+		} else {
+			userID, err := strconv.Atoi(createdBy)
+			if err != nil {
+				logger.Warnw("invalid created_by value", "created_by", createdBy, "error", err)
+				return ctx.JSON(http.StatusBadRequest, Response{
+					Code:    400,
+					Message: "invalid created_by value",
+				})
+			}
+			filter.CreatedBy = userID
+		}
+		if filter.CreatedBy == 0 {
+			return ctx.JSON(http.StatusOK, []SongResponse{})
+		}
+	}
+
 	if limitStr := ctx.QueryParam("limit"); limitStr != "" {
 		limit, err := strconv.Atoi(limitStr)
 		if err != nil {
-			logger.Warn("invalid limit value", zap.String("limit", limitStr), zap.Error(err))
+			logger.Warnw("invalid limit value", "limit", limitStr, "error", err)
 			return ctx.JSON(http.StatusBadRequest, Response{
 				Code:    400,
 				Message: "invalid limit value",
@@ -52,7 +83,7 @@ func (s *SongHandler) GetSongs(ctx echo.Context) error {
 	if offsetStr := ctx.QueryParam("offset"); offsetStr != "" {
 		offset, err := strconv.Atoi(offsetStr)
 		if err != nil {
-			logger.Warn("invalid offset value", zap.String("offset", offsetStr), zap.Error(err))
+			logger.Warnw("invalid offset value", "offset", offsetStr, "error", err)
 			return ctx.JSON(http.StatusBadRequest, Response{
 				Code:    400,
 				Message: "invalid offset value",
@@ -61,11 +92,11 @@ func (s *SongHandler) GetSongs(ctx echo.Context) error {
 		filter.Offset = uint64(offset)
 	}
 
-	logger.Debug("Fetching songs with filter", zap.Any("filter", filter))
+	logger.Debugw("Fetching songs with filter", "filter", filter)
 
-	songs, err := s.songUseCase.GetSongs(ctx.Request().Context(), filter)
+	songs, err := s.songUseCase.GetSongs(reqCtx, filter)
 	if err != nil {
-		logger.Error("failed to fetch songs", zap.Error(err))
+		logger.Errorw("failed to fetch songs", "error", err)
 		return ctx.JSON(http.StatusInternalServerError, Response{
 			Code:    500,
 			Message: "failed to fetch songs",
@@ -81,10 +112,12 @@ func (s *SongHandler) GetSongs(ctx echo.Context) error {
 			ReleaseDate: song.ReleaseDate,
 			Text:        song.Text,
 			SourceLink:  song.SourceLink,
+			CreatedBy:   song.CreatedBy,
+			UpdatedBy:   song.UpdatedBy,
 		})
 	}
 
-	logger.Info("Successfully fetched songs", zap.Int("count", len(resp)))
+	logger.Infow("Successfully fetched songs", "count", len(resp))
 
 	return ctx.JSON(http.StatusOK, resp)
 }
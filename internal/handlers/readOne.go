@@ -2,8 +2,9 @@ package handlers
 
 import (
 	"github.com/labstack/echo/v4"
-	"go.uber.org/zap"
 	"net/http"
+	"song-lib/internal/logging"
+	"song-lib/internal/tracing"
 	"strconv"
 )
 
@@ -13,43 +14,51 @@ import (
 // @Tags songs
 // @Accept json
 // @Produce json
+// @Security ApiKeyAuth
+// @Security BearerAuth
 // @Param id path int true "Song ID"
 // @Success 200 {object} SongTextResponse "Song text retrieved successfully"
 // @Failure 400 {object} Response "Invalid song ID"
 // @Failure 404 {object} Response "Song not found"
 // @Failure 500 {object} Response "Internal server error"
+// @Failure 401 {object} Response "Missing or invalid credentials"
+// @Failure 429 {object} Response "Rate limit exceeded"
+// @Failure 403 {object} Response "Missing songs:read scope"
 // @Router /api/songs/{id} [get]
 func (s *SongHandler) Get(ctx echo.Context) error {
-	logger := zap.L()
+	reqCtx, span := tracing.Start(ctx.Request().Context(), "SongHandler.Get")
+	defer span.End()
+
+	logger := logging.FromContext(reqCtx, s.logger)
 	songID, err := strconv.Atoi(ctx.Param("id"))
 	if err != nil {
-		logger.Warn("Invalid song ID", zap.String("param", ctx.Param("id")), zap.Error(err))
+		logger.Warnw("Invalid song ID", "param", ctx.Param("id"), "error", err)
 		return ctx.JSON(http.StatusBadRequest, Response{
 			Code:    400,
 			Message: "invalid song id",
 		})
 	}
 
-	logger.Debug("Checking if song exists", zap.Int("songID", songID))
-	if exist := s.songUseCase.Exist(ctx.Request().Context(), songID); !exist {
-		logger.Warn("Song not found", zap.Int("songID", songID))
+	logger.Debugw("Checking if song exists", "songID", songID)
+	if exist := s.songUseCase.Exist(reqCtx, songID); !exist {
+		logger.Warnw("Song not found", "songID", songID)
 		return ctx.JSON(http.StatusNotFound, Response{
 			Code:    404,
 			Message: "song with this id isn't present",
 		})
 	}
 
-	logger.Debug("Fetching song text", zap.Int("songID", songID))
-	text, err := s.songUseCase.GetSongText(ctx.Request().Context(), songID)
+	logger.Debugw("Fetching song text", "songID", songID)
+	text, err := s.songUseCase.GetSongText(reqCtx, songID)
 	if err != nil {
-		logger.Error("Failed to fetch song text", zap.Int("songID", songID), zap.Error(err))
+		logger.Errorw("Failed to fetch song text", "songID", songID, "error", err)
 		return ctx.JSON(http.StatusInternalServerError, Response{
 			Code:    500,
 			Message: "failed to fetch song",
 		})
 	}
 
-	logger.Info("Successfully retrieved song text", zap.Int("songID", songID))
+	logger.Infow("Successfully retrieved song text", "songID", songID)
 	resp := SongTextResponse{
 		TextParts: text,
 	}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"errors"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"song-lib/internal/logging"
+	"song-lib/internal/models"
+	"song-lib/internal/tracing"
+	"strconv"
+)
+
+// Restore godoc
+// @Summary Restore a deleted song
+// @Description Restore a deleted song under its original ID from the snapshot recorded in the audit log.
+// @Tags songs
+// @Produce json
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Param id path int true "Song ID"
+// @Param Idempotency-Key header string false "Key that makes retries of this request safe"
+// @Success 200 {object} Response "Song was restored successfully"
+// @Failure 400 {object} Response "Invalid song ID"
+// @Failure 404 {object} Response "No deleted song with this ID"
+// @Failure 409 {object} Response "Song with this ID, or its artist and title, already exists"
+// @Failure 500 {object} Response "Failed to restore song"
+// @Failure 401 {object} Response "Missing or invalid credentials"
+// @Failure 422 {object} Response "Idempotency key was used for a different request"
+// @Failure 429 {object} Response "Rate limit exceeded"
+// @Failure 403 {object} Response "Missing songs:write scope or not the owner of the song"
+// @Router /api/songs/{id}/restore [post]
+func (s *SongHandler) Restore(ctx echo.Context) error {
+	reqCtx, span := tracing.Start(ctx.Request().Context(), "SongHandler.Restore")
+	defer span.End()
+
+	logger := logging.FromContext(reqCtx, s.logger)
+	songID, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		logger.Warnw("invalid song id", "error", err, "input", ctx.Param("id"))
+		return ctx.JSON(http.StatusBadRequest, Response{
+			Code:    400,
+			Message: "invalid song id",
+		})
+	}
+
+	if err = s.songUseCase.RestoreSong(reqCtx, songID); err != nil {
+		switch {
+		case errors.Is(err, models.ErrSongNotFound):
+			return ctx.JSON(http.StatusNotFound, Response{
+				Code:    404,
+				Message: "no deleted song with this id",
+			})
+		case errors.Is(err, models.ErrSongExists):
+			return ctx.JSON(http.StatusConflict, Response{
+				Code:    409,
+				Message: "song with this id, or its artist and title, already exists",
+			})
+		case errors.Is(err, models.ErrForbidden):
+			return ctx.JSON(http.StatusForbidden, Response{
+				Code:    403,
+				Message: "only editors can restore songs created by other users",
+			})
+		}
+		logger.Errorw("failed to restore song", "song_id", songID, "error", err)
+		return ctx.JSON(http.StatusInternalServerError, Response{
+			Code:    500,
+			Message: "failed to restore song",
+		})
+	}
+
+	logger.Infow("song restored successfully", "song_id", songID)
+	return ctx.JSON(http.StatusOK, Response{
+		Code:    200,
+		Message: "song was restored successfully",
+	})
+}
@@ -0,0 +1,228 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"song-lib/internal/auth"
+	"song-lib/internal/externalAPI"
+	"song-lib/internal/handlers"
+	"song-lib/internal/mockinfo"
+	"song-lib/internal/models"
+	"song-lib/internal/repository/memory"
+	"song-lib/internal/repository/repotest"
+	"song-lib/internal/repository/sqlite"
+	"song-lib/internal/usecase"
+	"song-lib/internal/usecase/song"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// racers is how many requests race for the same song.
+const racers = 16
+
+type storage struct {
+	repo song.Repository
+	tx   song.Transactor
+}
+
+// storages returns an empty memory and SQLite storage for each test.
+var storages = map[string]func(t *testing.T) storage{
+	"memory": func(t *testing.T) storage {
+		memoryDB := memory.NewDB()
+		return storage{repo: memory.NewSongRepo(memoryDB, zap.NewNop().Sugar()), tx: memory.NewTxManager(memoryDB)}
+	},
+	"sqlite": func(t *testing.T) storage {
+		sqliteDB := repotest.OpenSQLite(t)
+		return storage{repo: sqlite.NewSongRepo(sqliteDB, zap.NewNop().Sugar()), tx: sqlite.NewTxManager(sqliteDB, 3)}
+	},
+}
+
+// newServer serves the song routes the way cmd/server does, with every
+// request acting as admin.
+func newServer(t *testing.T, store storage, details song.DetailsProvider) *httptest.Server {
+	t.Helper()
+
+	songHandlers := handlers.NewSongHandler(usecase.NewSongInstance(store.repo, store.tx, details, zap.NewNop().Sugar()), zap.NewNop().Sugar())
+
+	e := echo.New()
+	e.HTTPErrorHandler = handlers.ErrorHandler
+	songGroup := e.Group("/api/songs", auth.Anonymous())
+	songGroup.POST("", songHandlers.Create)
+	songGroup.GET("/:id", songHandlers.Get)
+	songGroup.GET("/filter", songHandlers.GetSongs)
+	songGroup.DELETE("/:id", songHandlers.Delete)
+
+	server := httptest.NewServer(e)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func do(t *testing.T, method, url, body string) int {
+	t.Helper()
+
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Errorf("%s %s: %v", method, url, err)
+		return 0
+	}
+	_ = res.Body.Close()
+	return res.StatusCode
+}
+
+func getJSON(t *testing.T, url string, dest any) {
+	t.Helper()
+
+	res, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("GET %s: %v", url, err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("GET %s status = %d, want 200", url, res.StatusCode)
+	}
+	if err := json.NewDecoder(res.Body).Decode(dest); err != nil {
+		t.Fatalf("GET %s: decode: %v", url, err)
+	}
+}
+
+// raceRequests sends the same request from racers goroutines at once and
+// counts the response statuses.
+func raceRequests(t *testing.T, method, url, body string) map[int]int {
+	t.Helper()
+
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		statuses = make(map[int]int)
+	)
+	start := make(chan struct{})
+	for range racers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			status := do(t, method, url, body)
+			mu.Lock()
+			statuses[status]++
+			mu.Unlock()
+		}()
+	}
+	close(start)
+	wg.Wait()
+	return statuses
+}
+
+func TestConcurrentDelete(t *testing.T) {
+	for name, newStorage := range storages {
+		t.Run(name, func(t *testing.T) {
+			store := newStorage(t)
+			server := newServer(t, store, repotest.StubDetails{})
+
+			if err := store.repo.CreateSong(context.Background(), models.Song{Artist: "Muse", Title: "Hysteria"}); err != nil {
+				t.Fatalf("CreateSong: %v", err)
+			}
+			songs, err := store.repo.GetSongs(context.Background(), models.SongFilter{})
+			if err != nil || len(songs) != 1 {
+				t.Fatalf("GetSongs = %v, %v", songs, err)
+			}
+
+			statuses := raceRequests(t, http.MethodDelete, fmt.Sprintf("%s/api/songs/%d", server.URL, songs[0].ID), "")
+			if statuses[http.StatusOK] != 1 || statuses[http.StatusNotFound] != racers-1 {
+				t.Errorf("statuses of %d concurrent DELETEs = %v, want one 200 and the rest 404", racers, statuses)
+			}
+		})
+	}
+}
+
+func TestConcurrentCreate(t *testing.T) {
+	for name, newStorage := range storages {
+		t.Run(name, func(t *testing.T) {
+			server := newServer(t, newStorage(t), repotest.StubDetails{})
+
+			statuses := raceRequests(t, http.MethodPost, server.URL+"/api/songs", `{"group":"Muse","song":"Hysteria"}`)
+			if statuses[http.StatusOK] != 1 || statuses[http.StatusConflict] != racers-1 {
+				t.Errorf("statuses of %d concurrent POSTs = %v, want one 200 and the rest 409", racers, statuses)
+			}
+		})
+	}
+}
+
+// newMockinfo serves the fixtures of cmd/mockinfo.
+func newMockinfo(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	fixtures, err := mockinfo.LoadFixtures("../../cmd/mockinfo/fixtures")
+	if err != nil {
+		t.Fatalf("LoadFixtures: %v", err)
+	}
+	server := httptest.NewServer(mockinfo.NewServer(fixtures, mockinfo.Faults{}).Handler())
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestCreateEnrichesFromExternalAPI(t *testing.T) {
+	for name, newStorage := range storages {
+		t.Run(name, func(t *testing.T) {
+			info := newMockinfo(t)
+			server := newServer(t, newStorage(t), externalAPI.NewClient(info.URL, nil))
+
+			if status := do(t, http.MethodPost, server.URL+"/api/songs", `{"group":"Muse","song":"Hysteria"}`); status != http.StatusOK {
+				t.Fatalf("POST /api/songs status = %d, want 200", status)
+			}
+
+			var songs []handlers.SongResponse
+			getJSON(t, server.URL+"/api/songs/filter?artist=Muse", &songs)
+			if len(songs) != 1 || songs[0].ReleaseDate != "01.12.2003" || songs[0].SourceLink != "https://www.youtube.com/watch?v=3dm_5qWWDV8" {
+				t.Fatalf("GET /api/songs/filter = %+v, want the song with the details of the mockinfo fixture", songs)
+			}
+
+			var text handlers.SongTextResponse
+			getJSON(t, fmt.Sprintf("%s/api/songs/%d", server.URL, songs[0].ID), &text)
+			if len(text.TextParts) != 2 || !strings.HasPrefix(text.TextParts[0], "It's bugging me") {
+				t.Errorf("GET /api/songs/%d = %q, want the two verses of the mockinfo fixture", songs[0].ID, text.TextParts)
+			}
+		})
+	}
+}
+
+func TestCreateExternalAPIErrors(t *testing.T) {
+	info := newMockinfo(t)
+	client := externalAPI.NewClient(info.URL, externalAPI.NewBreaker(externalAPI.BreakerOptions{
+		FailureThreshold: 1,
+		OpenTimeout:      time.Minute,
+	}))
+	server := newServer(t, storages["memory"](t), client)
+
+	if status := do(t, http.MethodPost, server.URL+"/api/songs", `{"group":"Muse","song":"Unknown Song"}`); status != http.StatusUnprocessableEntity {
+		t.Errorf("POST of a song unknown upstream status = %d, want 422", status)
+	}
+	if status := do(t, http.MethodPost, server.URL+"/api/songs", `{"group":"Mock","song":"Server Error"}`); status != http.StatusInternalServerError {
+		t.Errorf("POST failing upstream status = %d, want 500", status)
+	}
+
+	res, err := http.Post(server.URL+"/api/songs", echo.MIMEApplicationJSON, strings.NewReader(`{"group":"Muse","song":"Hysteria"}`))
+	if err != nil {
+		t.Fatalf("POST /api/songs: %v", err)
+	}
+	_ = res.Body.Close()
+	if res.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("POST with the circuit open status = %d, want 503", res.StatusCode)
+	}
+	if retryAfter, err := strconv.Atoi(res.Header.Get(echo.HeaderRetryAfter)); err != nil || retryAfter < 1 || retryAfter > 60 {
+		t.Errorf("Retry-After = %q, want the seconds left of the 1m open timeout", res.Header.Get(echo.HeaderRetryAfter))
+	}
+}
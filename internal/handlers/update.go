@@ -1,10 +1,12 @@
 package handlers
 
 import (
+	"errors"
 	"github.com/labstack/echo/v4"
-	"go.uber.org/zap"
 	"net/http"
+	"song-lib/internal/logging"
 	"song-lib/internal/models"
+	"song-lib/internal/tracing"
 	"strconv"
 )
 
@@ -14,37 +16,37 @@ import (
 // @Tags songs
 // @Accept json
 // @Produce json
+// @Security ApiKeyAuth
+// @Security BearerAuth
 // @Param id path int true "Song ID"
 // @Param body body UpdateRequest true "Song data to update"
 // @Success 200 {object} Response "Song updated successfully"
 // @Failure 400 {object} Response "Invalid song ID or request body"
 // @Failure 404 {object} Response "Song not found"
+// @Failure 409 {object} Response "Another song has the same artist and title"
 // @Failure 500 {object} Response "Internal server error"
+// @Failure 401 {object} Response "Missing or invalid credentials"
+// @Failure 429 {object} Response "Rate limit exceeded"
+// @Failure 403 {object} Response "Missing songs:write scope or not the owner of the song"
 // @Router /api/songs/{id} [put]
 func (s *SongHandler) Update(ctx echo.Context) error {
-	logger := zap.L()
+	reqCtx, span := tracing.Start(ctx.Request().Context(), "SongHandler.Update")
+	defer span.End()
+
+	logger := logging.FromContext(reqCtx, s.logger)
 
 	songID, err := strconv.Atoi(ctx.Param("id"))
 	if err != nil {
-		logger.Warn("Invalid song ID", zap.String("param", ctx.Param("id")), zap.Error(err))
+		logger.Warnw("Invalid song ID", "param", ctx.Param("id"), "error", err)
 		return ctx.JSON(http.StatusBadRequest, Response{
 			Code:    400,
 			Message: "invalid song id",
 		})
 	}
 
-	logger.Debug("Checking if song exists", zap.Int("songID", songID))
-	if exist := s.songUseCase.Exist(ctx.Request().Context(), songID); !exist {
-		logger.Warn("Song not found", zap.Int("songID", songID))
-		return ctx.JSON(http.StatusNotFound, Response{
-			Code:    404,
-			Message: "song with this id isn't present",
-		})
-	}
-
 	var req UpdateRequest
 	if err := ctx.Bind(&req); err != nil {
-		logger.Warn("Invalid request body", zap.Int("songID", songID), zap.Error(err))
+		logger.Warnw("Invalid request body", "songID", songID, "error", err)
 		return ctx.JSON(http.StatusBadRequest, Response{
 			Code:    400,
 			Message: "invalid request body",
@@ -60,16 +62,34 @@ func (s *SongHandler) Update(ctx echo.Context) error {
 		SourceLink:  req.SourceLink,
 	}
 
-	logger.Info("Updating song", zap.Int("songID", songID), zap.Any("updateData", req))
-	if err = s.songUseCase.ChangeSong(ctx.Request().Context(), song); err != nil {
-		logger.Error("Failed to update song", zap.Int("songID", songID), zap.Error(err))
+	logger.Infow("Updating song", "songID", songID, "updateData", req)
+	if err = s.songUseCase.ChangeSong(reqCtx, song); err != nil {
+		switch {
+		case errors.Is(err, models.ErrSongNotFound):
+			logger.Warnw("Song not found", "songID", songID)
+			return ctx.JSON(http.StatusNotFound, Response{
+				Code:    404,
+				Message: "song with this id isn't present",
+			})
+		case errors.Is(err, models.ErrSongExists):
+			return ctx.JSON(http.StatusConflict, Response{
+				Code:    409,
+				Message: "song with this artist and title already exists",
+			})
+		case errors.Is(err, models.ErrForbidden):
+			return ctx.JSON(http.StatusForbidden, Response{
+				Code:    403,
+				Message: "only editors can change songs created by other users",
+			})
+		}
+		logger.Errorw("Failed to update song", "songID", songID, "error", err)
 		return ctx.JSON(http.StatusInternalServerError, Response{
 			Code:    500,
 			Message: "failed to update song",
 		})
 	}
 
-	logger.Info("Song updated successfully", zap.Int("songID", songID))
+	logger.Infow("Song updated successfully", "songID", songID)
 	return ctx.JSON(http.StatusOK, Response{
 		Code:    200,
 		Message: "song was updated successfully",
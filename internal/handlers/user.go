@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+	"net/http"
+	"song-lib/internal/auth"
+	"song-lib/internal/logging"
+	"song-lib/internal/usecase"
+	"time"
+)
+
+type UserHandler struct {
+	userUseCase *usecase.UserUseCase
+	logger      *zap.SugaredLogger
+}
+
+func NewUserHandler(userUseCase *usecase.UserUseCase, logger *zap.SugaredLogger) *UserHandler {
+	return &UserHandler{userUseCase: userUseCase, logger: logger}
+}
+
+type MeResponse struct {
+	ID        int        `json:"id,omitempty"`
+	Subject   string     `json:"subject"`
+	Name      string     `json:"name"`
+	Role      string     `json:"role,omitempty"`
+	Scopes    []string   `json:"scopes"`
+	KeyID     int        `json:"key_id,omitempty"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+}
+
+// Me godoc
+// @Summary Current user
+// @Description Returns the authenticated user with its role and effective scopes.
+// @Tags users
+// @Produce json
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Success 200 {object} MeResponse "Current user"
+// @Failure 401 {object} Response "Missing or invalid credentials"
+// @Failure 429 {object} Response "Rate limit exceeded"
+// @Failure 500 {object} Response "Failed to fetch user"
+// @Router /api/me [get]
+func (h *UserHandler) Me(ctx echo.Context) error {
+	reqCtx := ctx.Request().Context()
+	logger := logging.FromContext(reqCtx, h.logger)
+
+	principal, ok := auth.PrincipalFrom(reqCtx)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "missing credentials")
+	}
+
+	resp := MeResponse{
+		Subject: principal.Subject,
+		Name:    principal.Name,
+		Role:    auth.HighestRole(principal.Roles),
+		Scopes:  principal.Scopes,
+		KeyID:   principal.KeyID,
+	}
+	if principal.UserID != 0 {
+		user, err := h.userUseCase.GetUser(reqCtx, principal.UserID)
+		if err != nil {
+			logger.Errorw("failed to fetch user", "userID", principal.UserID, "error", err)
+			return ctx.JSON(http.StatusInternalServerError, Response{
+				Code:    500,
+				Message: "failed to fetch user",
+			})
+		}
+		resp.ID = user.ID
+		resp.CreatedAt = &user.CreatedAt
+	}
+
+	return ctx.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,331 @@
+package handlers
+
+import (
+	"errors"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+	"net/http"
+	"slices"
+	"song-lib/internal/logging"
+	"song-lib/internal/models"
+	"song-lib/internal/usecase"
+	"strconv"
+)
+
+const (
+	defaultDeliveryLimit = 50
+	maxDeliveryLimit     = 500
+)
+
+type WebhookHandler struct {
+	webhookUseCase *usecase.WebhookUseCase
+	logger         *zap.SugaredLogger
+}
+
+func NewWebhookHandler(webhookUseCase *usecase.WebhookUseCase, logger *zap.SugaredLogger) *WebhookHandler {
+	return &WebhookHandler{webhookUseCase: webhookUseCase, logger: logger}
+}
+
+type WebhookRequest struct {
+	Name    string   `json:"name"`
+	URL     string   `json:"url"`
+	Events  []string `json:"events" example:"song.created,song.updated,song.deleted"`
+	Artists []string `json:"artists"`
+	// Active defaults to true.
+	Active *bool `json:"active"`
+}
+
+func (r WebhookRequest) webhook(id int) models.Webhook {
+	active := r.Active == nil || *r.Active
+	return models.Webhook{ID: id, Name: r.Name, URL: r.URL, Events: r.Events, Artists: r.Artists, Active: active}
+}
+
+// WebhookCreatedResponse carries the signing secret, which is not shown
+// again.
+type WebhookCreatedResponse struct {
+	models.Webhook
+	Secret string `json:"secret"`
+}
+
+// Create godoc
+// @Summary Create a webhook
+// @Description Subscribes a URL to song changes. Deliveries are signed with the returned secret, which is not shown again.
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Param body body WebhookRequest true "Webhook"
+// @Success 201 {object} WebhookCreatedResponse "Created webhook with its secret"
+// @Failure 400 {object} Response "Invalid request body"
+// @Failure 401 {object} Response "Missing or invalid credentials"
+// @Failure 403 {object} Response "Missing admin scope"
+// @Failure 429 {object} Response "Rate limit exceeded"
+// @Failure 500 {object} Response "Failed to create webhook"
+// @Router /api/webhooks [post]
+func (h *WebhookHandler) Create(ctx echo.Context) error {
+	reqCtx := ctx.Request().Context()
+	logger := logging.FromContext(reqCtx, h.logger)
+
+	var req WebhookRequest
+	if err := ctx.Bind(&req); err != nil {
+		return ctx.JSON(http.StatusBadRequest, Response{Code: 400, Message: "invalid request body"})
+	}
+
+	webhook, err := h.webhookUseCase.CreateWebhook(reqCtx, req.webhook(0))
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidWebhook) {
+			return ctx.JSON(http.StatusBadRequest, Response{Code: 400, Message: err.Error()})
+		}
+		logger.Errorw("failed to create webhook", "error", err)
+		return ctx.JSON(http.StatusInternalServerError, Response{Code: 500, Message: "failed to create webhook"})
+	}
+
+	secret := webhook.Secret
+	webhook.Secret = ""
+	return ctx.JSON(http.StatusCreated, WebhookCreatedResponse{Webhook: webhook, Secret: secret})
+}
+
+// List godoc
+// @Summary List webhooks
+// @Tags webhooks
+// @Produce json
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Success 200 {array} models.Webhook "Webhooks"
+// @Failure 401 {object} Response "Missing or invalid credentials"
+// @Failure 403 {object} Response "Missing admin scope"
+// @Failure 429 {object} Response "Rate limit exceeded"
+// @Failure 500 {object} Response "Failed to fetch webhooks"
+// @Router /api/webhooks [get]
+func (h *WebhookHandler) List(ctx echo.Context) error {
+	reqCtx := ctx.Request().Context()
+	logger := logging.FromContext(reqCtx, h.logger)
+
+	webhooks, err := h.webhookUseCase.ListWebhooks(reqCtx)
+	if err != nil {
+		logger.Errorw("failed to fetch webhooks", "error", err)
+		return ctx.JSON(http.StatusInternalServerError, Response{Code: 500, Message: "failed to fetch webhooks"})
+	}
+	return ctx.JSON(http.StatusOK, webhooks)
+}
+
+// Get godoc
+// @Summary Get a webhook by ID
+// @Tags webhooks
+// @Produce json
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Param id path int true "Webhook ID"
+// @Success 200 {object} models.Webhook "Webhook"
+// @Failure 400 {object} Response "Invalid webhook ID"
+// @Failure 401 {object} Response "Missing or invalid credentials"
+// @Failure 403 {object} Response "Missing admin scope"
+// @Failure 404 {object} Response "Webhook not found"
+// @Failure 429 {object} Response "Rate limit exceeded"
+// @Failure 500 {object} Response "Failed to fetch webhook"
+// @Router /api/webhooks/{id} [get]
+func (h *WebhookHandler) Get(ctx echo.Context) error {
+	reqCtx := ctx.Request().Context()
+	logger := logging.FromContext(reqCtx, h.logger)
+
+	webhookID, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		return ctx.JSON(http.StatusBadRequest, Response{Code: 400, Message: "invalid webhook id"})
+	}
+
+	webhook, err := h.webhookUseCase.GetWebhook(reqCtx, webhookID)
+	if err != nil {
+		if errors.Is(err, models.ErrWebhookNotFound) {
+			return ctx.JSON(http.StatusNotFound, Response{Code: 404, Message: "webhook with this id isn't present"})
+		}
+		logger.Errorw("failed to fetch webhook", "webhookID", webhookID, "error", err)
+		return ctx.JSON(http.StatusInternalServerError, Response{Code: 500, Message: "failed to fetch webhook"})
+	}
+	return ctx.JSON(http.StatusOK, webhook)
+}
+
+// Update godoc
+// @Summary Update a webhook by ID
+// @Description Replaces the URL, events, artists and active flag of a webhook; the secret is kept.
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Param id path int true "Webhook ID"
+// @Param body body WebhookRequest true "Webhook"
+// @Success 200 {object} models.Webhook "Updated webhook"
+// @Failure 400 {object} Response "Invalid webhook ID or request body"
+// @Failure 401 {object} Response "Missing or invalid credentials"
+// @Failure 403 {object} Response "Missing admin scope"
+// @Failure 404 {object} Response "Webhook not found"
+// @Failure 429 {object} Response "Rate limit exceeded"
+// @Failure 500 {object} Response "Failed to update webhook"
+// @Router /api/webhooks/{id} [put]
+func (h *WebhookHandler) Update(ctx echo.Context) error {
+	reqCtx := ctx.Request().Context()
+	logger := logging.FromContext(reqCtx, h.logger)
+
+	webhookID, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		return ctx.JSON(http.StatusBadRequest, Response{Code: 400, Message: "invalid webhook id"})
+	}
+
+	var req WebhookRequest
+	if err := ctx.Bind(&req); err != nil {
+		return ctx.JSON(http.StatusBadRequest, Response{Code: 400, Message: "invalid request body"})
+	}
+
+	webhook, err := h.webhookUseCase.UpdateWebhook(reqCtx, req.webhook(webhookID))
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrInvalidWebhook):
+			return ctx.JSON(http.StatusBadRequest, Response{Code: 400, Message: err.Error()})
+		case errors.Is(err, models.ErrWebhookNotFound):
+			return ctx.JSON(http.StatusNotFound, Response{Code: 404, Message: "webhook with this id isn't present"})
+		}
+		logger.Errorw("failed to update webhook", "webhookID", webhookID, "error", err)
+		return ctx.JSON(http.StatusInternalServerError, Response{Code: 500, Message: "failed to update webhook"})
+	}
+	return ctx.JSON(http.StatusOK, webhook)
+}
+
+// Delete godoc
+// @Summary Delete a webhook by ID
+// @Description Deletes the webhook together with its delivery log; pending deliveries are dropped.
+// @Tags webhooks
+// @Produce json
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Param id path int true "Webhook ID"
+// @Success 200 {object} Response "Webhook deleted"
+// @Failure 400 {object} Response "Invalid webhook ID"
+// @Failure 401 {object} Response "Missing or invalid credentials"
+// @Failure 403 {object} Response "Missing admin scope"
+// @Failure 404 {object} Response "Webhook not found"
+// @Failure 429 {object} Response "Rate limit exceeded"
+// @Failure 500 {object} Response "Failed to delete webhook"
+// @Router /api/webhooks/{id} [delete]
+func (h *WebhookHandler) Delete(ctx echo.Context) error {
+	reqCtx := ctx.Request().Context()
+	logger := logging.FromContext(reqCtx, h.logger)
+
+	webhookID, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		return ctx.JSON(http.StatusBadRequest, Response{Code: 400, Message: "invalid webhook id"})
+	}
+
+	if err := h.webhookUseCase.DeleteWebhook(reqCtx, webhookID); err != nil {
+		if errors.Is(err, models.ErrWebhookNotFound) {
+			return ctx.JSON(http.StatusNotFound, Response{Code: 404, Message: "webhook with this id isn't present"})
+		}
+		logger.Errorw("failed to delete webhook", "webhookID", webhookID, "error", err)
+		return ctx.JSON(http.StatusInternalServerError, Response{Code: 500, Message: "failed to delete webhook"})
+	}
+	return ctx.JSON(http.StatusOK, Response{Code: 200, Message: "webhook was deleted successfully"})
+}
+
+// Deliveries godoc
+// @Summary List deliveries of a webhook
+// @Description Returns the delivery log of a webhook, newest first: the payload, status, attempts and the outcome of the last attempt.
+// @Tags webhooks
+// @Produce json
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Param id path int true "Webhook ID"
+// @Param status query string false "pending, delivered or dead"
+// @Param limit query int false "Limit of results (default 50, max 500)"
+// @Param offset query int false "Offset for pagination"
+// @Success 200 {array} models.WebhookDelivery "Deliveries"
+// @Failure 400 {object} Response "Invalid webhook ID or query parameters"
+// @Failure 401 {object} Response "Missing or invalid credentials"
+// @Failure 403 {object} Response "Missing admin scope"
+// @Failure 404 {object} Response "Webhook not found"
+// @Failure 429 {object} Response "Rate limit exceeded"
+// @Failure 500 {object} Response "Failed to fetch deliveries"
+// @Router /api/webhooks/{id}/deliveries [get]
+func (h *WebhookHandler) Deliveries(ctx echo.Context) error {
+	reqCtx := ctx.Request().Context()
+	logger := logging.FromContext(reqCtx, h.logger)
+
+	webhookID, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		return ctx.JSON(http.StatusBadRequest, Response{Code: 400, Message: "invalid webhook id"})
+	}
+
+	filter := models.DeliveryFilter{
+		WebhookID: webhookID,
+		Status:    ctx.QueryParam("status"),
+		Limit:     defaultDeliveryLimit,
+	}
+	statuses := []string{models.DeliveryPending, models.DeliveryDelivered, models.DeliveryDead}
+	if filter.Status != "" && !slices.Contains(statuses, filter.Status) {
+		return ctx.JSON(http.StatusBadRequest, Response{Code: 400, Message: "invalid status value"})
+	}
+	if limit := ctx.QueryParam("limit"); limit != "" {
+		n, err := strconv.ParseUint(limit, 10, 64)
+		if err != nil || n == 0 || n > maxDeliveryLimit {
+			return ctx.JSON(http.StatusBadRequest, Response{Code: 400, Message: "invalid limit value"})
+		}
+		filter.Limit = n
+	}
+	if offset := ctx.QueryParam("offset"); offset != "" {
+		n, err := strconv.ParseUint(offset, 10, 64)
+		if err != nil {
+			return ctx.JSON(http.StatusBadRequest, Response{Code: 400, Message: "invalid offset value"})
+		}
+		filter.Offset = n
+	}
+
+	deliveries, err := h.webhookUseCase.ListDeliveries(reqCtx, filter)
+	if err != nil {
+		if errors.Is(err, models.ErrWebhookNotFound) {
+			return ctx.JSON(http.StatusNotFound, Response{Code: 404, Message: "webhook with this id isn't present"})
+		}
+		logger.Errorw("failed to fetch webhook deliveries", "webhookID", webhookID, "error", err)
+		return ctx.JSON(http.StatusInternalServerError, Response{Code: 500, Message: "failed to fetch deliveries"})
+	}
+	return ctx.JSON(http.StatusOK, deliveries)
+}
+
+// Redeliver godoc
+// @Summary Redeliver a webhook delivery
+// @Description Queues a delivery for an immediate attempt with a fresh budget of retries, whether it is pending, delivered or dead.
+// @Tags webhooks
+// @Produce json
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Param id path int true "Webhook ID"
+// @Param deliveryID path int true "Delivery ID"
+// @Success 202 {object} models.WebhookDelivery "Queued delivery"
+// @Failure 400 {object} Response "Invalid webhook or delivery ID"
+// @Failure 401 {object} Response "Missing or invalid credentials"
+// @Failure 403 {object} Response "Missing admin scope"
+// @Failure 404 {object} Response "Delivery not found"
+// @Failure 429 {object} Response "Rate limit exceeded"
+// @Failure 500 {object} Response "Failed to redeliver"
+// @Router /api/webhooks/{id}/deliveries/{deliveryID}/redeliver [post]
+func (h *WebhookHandler) Redeliver(ctx echo.Context) error {
+	reqCtx := ctx.Request().Context()
+	logger := logging.FromContext(reqCtx, h.logger)
+
+	webhookID, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		return ctx.JSON(http.StatusBadRequest, Response{Code: 400, Message: "invalid webhook id"})
+	}
+	deliveryID, err := strconv.ParseInt(ctx.Param("deliveryID"), 10, 64)
+	if err != nil {
+		return ctx.JSON(http.StatusBadRequest, Response{Code: 400, Message: "invalid delivery id"})
+	}
+
+	delivery, err := h.webhookUseCase.Redeliver(reqCtx, webhookID, deliveryID)
+	if err != nil {
+		if errors.Is(err, models.ErrDeliveryNotFound) {
+			return ctx.JSON(http.StatusNotFound, Response{Code: 404, Message: "delivery with this id isn't present"})
+		}
+		logger.Errorw("failed to redeliver webhook delivery", "webhookID", webhookID, "deliveryID", deliveryID, "error", err)
+		return ctx.JSON(http.StatusInternalServerError, Response{Code: 500, Message: "failed to redeliver"})
+	}
+	return ctx.JSON(http.StatusAccepted, delivery)
+}
@@ -0,0 +1,30 @@
+package idempotency
+
+import (
+	"context"
+	"time"
+)
+
+// lockTimeout bounds how long an unfinished request holds its key, so a
+// crashed replica does not block retries until the key expires. It must
+// exceed the server write timeout.
+const lockTimeout = time.Minute
+
+type Record struct {
+	RequestHash string
+	// Completed is false while the first request is still being served.
+	Completed   bool
+	Status      int
+	ContentType string
+	Body        []byte
+}
+
+// Store keeps the first response per (subject, key).
+type Store interface {
+	// Reserve claims key for the request with hash. When the key is taken
+	// it returns the existing record and false.
+	Reserve(ctx context.Context, subject, key, hash string, ttl time.Duration) (Record, bool, error)
+	Complete(ctx context.Context, subject, key string, record Record) error
+	// Release frees a reserved key so the request can be retried.
+	Release(ctx context.Context, subject, key string) error
+}
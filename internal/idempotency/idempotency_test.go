@@ -0,0 +1,170 @@
+package idempotency_test
+
+import (
+	"context"
+	"errors"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"song-lib/internal/idempotency"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// server counts the calls of a POST /songs handler that answers with
+// respond.
+type server struct {
+	*echo.Echo
+	calls atomic.Int32
+}
+
+func newServer(respond func(ctx echo.Context, call int32) error) *server {
+	s := &server{Echo: echo.New()}
+	s.IPExtractor = echo.ExtractIPDirect()
+	s.POST("/songs", func(ctx echo.Context) error {
+		return respond(ctx, s.calls.Add(1))
+	}, idempotency.Middleware(idempotency.NewMemory(), time.Hour, zap.NewNop().Sugar()))
+	return s
+}
+
+func created(ctx echo.Context, call int32) error {
+	return ctx.JSON(http.StatusCreated, map[string]int32{"call": call})
+}
+
+func (s *server) post(key, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/songs", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	if key != "" {
+		req.Header.Set(idempotency.HeaderKey, key)
+	}
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestReplay(t *testing.T) {
+	s := newServer(created)
+
+	first := s.post("key-1", `{"song":"Hysteria"}`)
+	second := s.post("key-1", `{"song":"Hysteria"}`)
+	if first.Code != http.StatusCreated || second.Code != first.Code || second.Body.String() != first.Body.String() {
+		t.Errorf("replay = %d %s, want %d %s", second.Code, second.Body, first.Code, first.Body)
+	}
+	if first.Header().Get(idempotency.HeaderReplayed) != "" || second.Header().Get(idempotency.HeaderReplayed) != "true" {
+		t.Errorf("%s = %q then %q, want only the replay marked", idempotency.HeaderReplayed,
+			first.Header().Get(idempotency.HeaderReplayed), second.Header().Get(idempotency.HeaderReplayed))
+	}
+	if got := second.Header().Get(echo.HeaderContentType); got != first.Header().Get(echo.HeaderContentType) {
+		t.Errorf("replayed Content-Type = %q, want %q", got, first.Header().Get(echo.HeaderContentType))
+	}
+
+	// Without a key, or under another one, the request is served again.
+	s.post("", `{"song":"Hysteria"}`)
+	s.post("key-2", `{"song":"Hysteria"}`)
+	if n := s.calls.Load(); n != 3 {
+		t.Errorf("handler called %d times, want 3", n)
+	}
+}
+
+func TestReusedKey(t *testing.T) {
+	s := newServer(created)
+
+	s.post("key-1", `{"song":"Hysteria"}`)
+	if rec := s.post("key-1", `{"song":"Uprising"}`); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("reused key with another body = %d, want 422", rec.Code)
+	}
+	if n := s.calls.Load(); n != 1 {
+		t.Errorf("handler called %d times, want 1", n)
+	}
+}
+
+func TestInFlight(t *testing.T) {
+	entered, finish := make(chan struct{}), make(chan struct{})
+	s := newServer(func(ctx echo.Context, call int32) error {
+		close(entered)
+		<-finish
+		return created(ctx, call)
+	})
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- s.post("key-1", `{"song":"Hysteria"}`) }()
+	<-entered
+
+	if rec := s.post("key-1", `{"song":"Hysteria"}`); rec.Code != http.StatusConflict {
+		t.Errorf("retry while the first request is served = %d, want 409", rec.Code)
+	}
+	close(finish)
+	if rec := <-done; rec.Code != http.StatusCreated {
+		t.Errorf("first request = %d, want 201", rec.Code)
+	}
+	if rec := s.post("key-1", `{"song":"Hysteria"}`); rec.Code != http.StatusCreated || rec.Header().Get(idempotency.HeaderReplayed) != "true" {
+		t.Errorf("retry after the first request = %d, replayed %q; want the stored 201", rec.Code, rec.Header().Get(idempotency.HeaderReplayed))
+	}
+}
+
+func TestReleased(t *testing.T) {
+	for name, fail := range map[string]func(ctx echo.Context) error{
+		"ServerError": func(ctx echo.Context) error {
+			return ctx.JSON(http.StatusBadGateway, map[string]string{"message": "external API failed"})
+		},
+		"HandlerError": func(echo.Context) error {
+			return errors.New("database is down")
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			s := newServer(func(ctx echo.Context, call int32) error {
+				if call == 1 {
+					return fail(ctx)
+				}
+				return created(ctx, call)
+			})
+
+			if rec := s.post("key-1", `{"song":"Hysteria"}`); rec.Code < http.StatusInternalServerError {
+				t.Fatalf("first request = %d, want a 5xx", rec.Code)
+			}
+			rec := s.post("key-1", `{"song":"Hysteria"}`)
+			if rec.Code != http.StatusCreated || rec.Header().Get(idempotency.HeaderReplayed) != "" {
+				t.Errorf("retry = %d, replayed %q; want it served again", rec.Code, rec.Header().Get(idempotency.HeaderReplayed))
+			}
+		})
+	}
+}
+
+func TestBodyTooLarge(t *testing.T) {
+	s := newServer(created)
+
+	body := `{"text":"` + strings.Repeat("a", idempotency.MaxBodySize) + `"}`
+	if rec := s.post("key-1", body); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("oversized body = %d, want 413", rec.Code)
+	}
+	if n := s.calls.Load(); n != 0 {
+		t.Errorf("handler called %d times, want 0", n)
+	}
+}
+
+func TestMemoryExpiry(t *testing.T) {
+	ctx := context.Background()
+	store := idempotency.NewMemory()
+
+	if _, reserved, _ := store.Reserve(ctx, "key:1", "key-1", "hash", 20*time.Millisecond); !reserved {
+		t.Fatal("Reserve of a new key = false, want true")
+	}
+	if err := store.Complete(ctx, "key:1", "key-1", idempotency.Record{RequestHash: "hash", Status: http.StatusCreated}); err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	existing, reserved, _ := store.Reserve(ctx, "key:1", "key-1", "hash", 20*time.Millisecond)
+	if reserved || !existing.Completed || existing.Status != http.StatusCreated {
+		t.Fatalf("Reserve before the TTL = %+v, %v; want the stored record", existing, reserved)
+	}
+	if _, reserved, _ := store.Reserve(ctx, "key:2", "key-1", "hash", 20*time.Millisecond); !reserved {
+		t.Error("Reserve of the same key by another client = false, want true")
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if _, reserved, _ := store.Reserve(ctx, "key:1", "key-1", "other", 20*time.Millisecond); !reserved {
+		t.Error("Reserve after the TTL = false, want the key free again")
+	}
+}
@@ -0,0 +1,64 @@
+package idempotency
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type entry struct {
+	record    Record
+	createdAt time.Time
+	expiresAt time.Time
+}
+
+type Memory struct {
+	mu        sync.Mutex
+	entries   map[string]*entry
+	lastSweep time.Time
+}
+
+func NewMemory() *Memory {
+	return &Memory{entries: make(map[string]*entry), lastSweep: time.Now()}
+}
+
+func (m *Memory) Reserve(_ context.Context, subject, key, hash string, ttl time.Duration) (Record, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(m.lastSweep) > time.Minute {
+		for id, e := range m.entries {
+			if !now.Before(e.expiresAt) {
+				delete(m.entries, id)
+			}
+		}
+		m.lastSweep = now
+	}
+
+	id := subject + "\x00" + key
+	if e, ok := m.entries[id]; ok && now.Before(e.expiresAt) && (e.record.Completed || now.Sub(e.createdAt) < lockTimeout) {
+		return e.record, false, nil
+	}
+	m.entries[id] = &entry{record: Record{RequestHash: hash}, createdAt: now, expiresAt: now.Add(ttl)}
+	return Record{}, true, nil
+}
+
+func (m *Memory) Complete(_ context.Context, subject, key string, record Record) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if e, ok := m.entries[subject+"\x00"+key]; ok {
+		record.Completed = true
+		e.record = record
+	}
+	return nil
+}
+
+func (m *Memory) Release(_ context.Context, subject, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.entries, subject+"\x00"+key)
+	return nil
+}
@@ -0,0 +1,118 @@
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+	"song-lib/internal/auth"
+	"song-lib/internal/logging"
+	"time"
+)
+
+const (
+	HeaderKey      = "Idempotency-Key"
+	HeaderReplayed = "Idempotent-Replayed"
+	maxKeyLength   = 255
+	// MaxBodySize bounds the request body read to hash it.
+	MaxBodySize = 1 << 20
+)
+
+// Middleware makes requests carrying an Idempotency-Key header safe to
+// retry. The first response is stored per key and client and replayed for
+// retries with the same method, path and body; a different request under the
+// same key gets 422 and one racing the original gets 409. Server errors are
+// not stored, so the request can be retried.
+func Middleware(store Store, ttl time.Duration, fallback *zap.SugaredLogger) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			req := ctx.Request()
+			key := req.Header.Get(HeaderKey)
+			if key == "" {
+				return next(ctx)
+			}
+			if len(key) > maxKeyLength {
+				return echo.NewHTTPError(http.StatusBadRequest, "idempotency key is too long")
+			}
+
+			logger := logging.FromContext(req.Context(), fallback)
+
+			body, err := io.ReadAll(io.LimitReader(req.Body, MaxBodySize+1))
+			if err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, "failed to read request body")
+			}
+			if len(body) > MaxBodySize {
+				return echo.NewHTTPError(http.StatusRequestEntityTooLarge, "request body is too large")
+			}
+			req.Body = io.NopCloser(bytes.NewReader(body))
+
+			subject := auth.ClientKey(ctx)
+			hash := requestHash(req, body)
+
+			existing, reserved, err := store.Reserve(req.Context(), subject, key, hash, ttl)
+			if err != nil {
+				logger.Errorw("failed to reserve idempotency key", "error", err)
+				return echo.NewHTTPError(http.StatusInternalServerError, "failed to check idempotency key")
+			}
+			if !reserved {
+				switch {
+				case existing.RequestHash != hash:
+					return echo.NewHTTPError(http.StatusUnprocessableEntity, "idempotency key was used for a different request")
+				case !existing.Completed:
+					return echo.NewHTTPError(http.StatusConflict, "a request with this idempotency key is in progress")
+				}
+				logger.Infow("replaying stored response", "idempotency_key", key)
+				ctx.Response().Header().Set(HeaderReplayed, "true")
+				return ctx.Blob(existing.Status, existing.ContentType, existing.Body)
+			}
+
+			res := ctx.Response()
+			recorder := &recorder{ResponseWriter: res.Writer}
+			res.Writer = recorder
+
+			err = next(ctx)
+			res.Writer = recorder.ResponseWriter
+
+			// The client may have gone away; the outcome must still be saved.
+			storeCtx := context.WithoutCancel(req.Context())
+			if err != nil || res.Status >= http.StatusInternalServerError {
+				if err := store.Release(storeCtx, subject, key); err != nil {
+					logger.Warnw("failed to release idempotency key", "error", err)
+				}
+				return err
+			}
+
+			record := Record{
+				RequestHash: hash,
+				Status:      res.Status,
+				ContentType: res.Header().Get(echo.HeaderContentType),
+				Body:        recorder.body.Bytes(),
+			}
+			if err := store.Complete(storeCtx, subject, key, record); err != nil {
+				logger.Warnw("failed to store idempotent response", "error", err)
+			}
+			return nil
+		}
+	}
+}
+
+func requestHash(req *http.Request, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(req.Method + " " + req.URL.Path + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+type recorder struct {
+	http.ResponseWriter
+	body bytes.Buffer
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
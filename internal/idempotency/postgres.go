@@ -0,0 +1,118 @@
+package idempotency
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jmoiron/sqlx"
+	"time"
+)
+
+// Postgres keeps records in a table with (subject, key) as the primary key;
+// see migrations/007_create_idempotency_keys_table.up.sql.
+type Postgres struct {
+	db           *sqlx.DB
+	table        string
+	reserveQuery string
+}
+
+func NewPostgres(db *sqlx.DB, table string) *Postgres {
+	return &Postgres{db: db, table: table, reserveQuery: fmt.Sprintf(reserveQuery, table)}
+}
+
+// reserveQuery returns a row only when this request got the key: it was
+// free, expired, or held by an abandoned request.
+const reserveQuery = `
+INSERT INTO %[1]s AS k (subject, key, request_hash, created_at, expires_at)
+VALUES ($1, $2, $3, now(), now() + $4 * interval '1 second')
+ON CONFLICT (subject, key) DO UPDATE SET
+    request_hash = EXCLUDED.request_hash,
+    status = NULL,
+    content_type = NULL,
+    body = NULL,
+    created_at = EXCLUDED.created_at,
+    expires_at = EXCLUDED.expires_at
+WHERE k.expires_at <= now()
+   OR (k.status IS NULL AND k.created_at < now() - $5 * interval '1 second')
+RETURNING subject`
+
+func (p *Postgres) Reserve(ctx context.Context, subject, key, hash string, ttl time.Duration) (Record, bool, error) {
+	var owner string
+	err := p.db.QueryRowContext(ctx, p.reserveQuery, subject, key, hash, ttl.Seconds(), lockTimeout.Seconds()).Scan(&owner)
+	if err == nil {
+		return Record{}, true, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return Record{}, false, err
+	}
+
+	query, args, err := sq.Select("request_hash", "status", "content_type", "body").
+		From(p.table).
+		Where(sq.Eq{"subject": subject, "key": key}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return Record{}, false, err
+	}
+
+	var (
+		record      Record
+		status      sql.NullInt64
+		contentType sql.NullString
+	)
+	err = p.db.QueryRowContext(ctx, query, args...).Scan(&record.RequestHash, &status, &contentType, &record.Body)
+	if err != nil {
+		return Record{}, false, err
+	}
+	record.Completed = status.Valid
+	record.Status = int(status.Int64)
+	record.ContentType = contentType.String
+	return record, false, nil
+}
+
+func (p *Postgres) Complete(ctx context.Context, subject, key string, record Record) error {
+	query, args, err := sq.Update(p.table).
+		Set("status", record.Status).
+		Set("content_type", record.ContentType).
+		Set("body", record.Body).
+		Where(sq.Eq{"subject": subject, "key": key}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	_, err = p.db.ExecContext(ctx, query, args...)
+	return err
+}
+
+func (p *Postgres) Release(ctx context.Context, subject, key string) error {
+	query, args, err := sq.Delete(p.table).
+		Where(sq.Eq{"subject": subject, "key": key}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	_, err = p.db.ExecContext(ctx, query, args...)
+	return err
+}
+
+func (p *Postgres) DeleteExpired(ctx context.Context) (int64, error) {
+	query, args, err := sq.Delete(p.table).
+		Where("expires_at <= now()").
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return 0, err
+	}
+
+	res, err := p.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,82 @@
+package logging
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"time"
+)
+
+const HeaderRequestID = echo.HeaderXRequestID
+
+// Middleware reuses a well-formed incoming X-Request-ID or generates one,
+// echoes it back, stores a child logger carrying it in the request context
+// and writes one access log line per request.
+func Middleware(base *zap.SugaredLogger) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			start := time.Now()
+			req := ctx.Request()
+
+			requestID := req.Header.Get(HeaderRequestID)
+			if !validRequestID(requestID) {
+				requestID = newRequestID()
+			}
+			ctx.Response().Header().Set(HeaderRequestID, requestID)
+
+			logger := base.With("request_id", requestID)
+			if spanCtx := trace.SpanContextFromContext(req.Context()); spanCtx.IsValid() {
+				logger = logger.With("trace_id", spanCtx.TraceID().String())
+			}
+
+			reqCtx := WithRequestID(WithLogger(req.Context(), logger), requestID)
+			ctx.SetRequest(req.WithContext(reqCtx))
+
+			err := next(ctx)
+			if err != nil {
+				ctx.Error(err)
+			}
+
+			res := ctx.Response()
+			fields := []interface{}{
+				"method", req.Method,
+				"uri", req.RequestURI,
+				"route", ctx.Path(),
+				"status", res.Status,
+				"latency", time.Since(start),
+				"bytes_out", res.Size,
+				"remote_ip", ctx.RealIP(),
+				"user_agent", req.UserAgent(),
+			}
+			switch {
+			case res.Status >= 500:
+				logger.Errorw("request served", fields...)
+			case res.Status >= 400:
+				logger.Warnw("request served", fields...)
+			default:
+				logger.Infow("request served", fields...)
+			}
+			return err
+		}
+	}
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, r := range id {
+		if r < 0x21 || r > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,57 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"song-lib/internal/externalAPI"
+	"song-lib/internal/usecase/song"
+	"time"
+)
+
+// ExternalAPI records latency and outcome of every call that actually
+// reaches the upstream client.
+type ExternalAPI struct {
+	next    song.DetailsProvider
+	metrics *Metrics
+}
+
+func NewExternalAPI(next song.DetailsProvider, metrics *Metrics) *ExternalAPI {
+	return &ExternalAPI{next: next, metrics: metrics}
+}
+
+func (e *ExternalAPI) GetSongDetails(ctx context.Context, artist, title string) (*externalAPI.SongDetails, error) {
+	start := time.Now()
+	details, err := e.next.GetSongDetails(ctx, artist, title)
+
+	outcome := "success"
+	switch {
+	case errors.Is(err, externalAPI.ErrNotFound):
+		outcome = "not_found"
+	case errors.Is(err, externalAPI.ErrCircuitOpen):
+		outcome = "circuit_open"
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, context.Canceled):
+		outcome = "timeout"
+	case err != nil:
+		outcome = "error"
+	}
+	e.metrics.externalCalls.WithLabelValues(outcome).Inc()
+	e.metrics.externalDuration.WithLabelValues(outcome).Observe(time.Since(start).Seconds())
+	return details, err
+}
+
+// Enrichment tracks how many song enrichment lookups are pending, cache hits
+// included.
+type Enrichment struct {
+	next    song.DetailsProvider
+	metrics *Metrics
+}
+
+func NewEnrichment(next song.DetailsProvider, metrics *Metrics) *Enrichment {
+	return &Enrichment{next: next, metrics: metrics}
+}
+
+func (e *Enrichment) GetSongDetails(ctx context.Context, artist, title string) (*externalAPI.SongDetails, error) {
+	e.metrics.enrichmentQueue.Inc()
+	defer e.metrics.enrichmentQueue.Dec()
+	return e.next.GetSongDetails(ctx, artist, title)
+}
@@ -0,0 +1,164 @@
+package metrics
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+	"song-lib/internal/models"
+	"song-lib/internal/repository/cached"
+	"strconv"
+	"time"
+)
+
+const namespace = "songlib"
+
+type Metrics struct {
+	registry *prometheus.Registry
+
+	httpRequests     *prometheus.CounterVec
+	httpDuration     *prometheus.HistogramVec
+	queryDuration    *prometheus.HistogramVec
+	queryErrors      *prometheus.CounterVec
+	externalDuration *prometheus.HistogramVec
+	externalCalls    *prometheus.CounterVec
+	enrichmentQueue  prometheus.Gauge
+}
+
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		httpRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests by method, echo route and status code.",
+		}, []string{"method", "route", "status"}),
+		httpDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "HTTP request latency by method, echo route and status code.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+		queryDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "repository_query_duration_seconds",
+			Help:      "Repository method latency.",
+			Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+		}, []string{"repository", "method"}),
+		queryErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "repository_query_errors_total",
+			Help:      "Repository method calls that returned an error.",
+		}, []string{"repository", "method"}),
+		externalDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "external_api_request_duration_seconds",
+			Help:      "External /info API call latency by outcome.",
+			Buckets:   []float64{.01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+		}, []string{"outcome"}),
+		externalCalls: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "external_api_requests_total",
+			Help:      "External /info API calls by outcome.",
+		}, []string{"outcome"}),
+		enrichmentQueue: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "enrichment_queue_depth",
+			Help:      "Song enrichment lookups waiting for or running against the external API.",
+		}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.httpRequests,
+		m.httpDuration,
+		m.queryDuration,
+		m.queryErrors,
+		m.externalDuration,
+		m.externalCalls,
+		m.enrichmentQueue,
+	)
+	return m
+}
+
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registry})
+}
+
+func (m *Metrics) Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			start := time.Now()
+			err := next(ctx)
+			if err != nil {
+				ctx.Error(err)
+			}
+
+			route := ctx.Path()
+			if route == "" {
+				route = "unmatched"
+			}
+			labels := prometheus.Labels{
+				"method": ctx.Request().Method,
+				"route":  route,
+				"status": strconv.Itoa(ctx.Response().Status),
+			}
+			m.httpRequests.With(labels).Inc()
+			m.httpDuration.With(labels).Observe(time.Since(start).Seconds())
+			return err
+		}
+	}
+}
+
+func (m *Metrics) RegisterDB(db *sql.DB, name string) {
+	m.registry.MustRegister(collectors.NewDBStatsCollector(db, name))
+}
+
+func (m *Metrics) RegisterLyricsCache(cache *cached.LyricsClient) {
+	counter := func(name, help string, value func(cached.LyricsStats) int64) prometheus.Collector {
+		return prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "lyrics_cache",
+			Name:      name,
+			Help:      help,
+		}, func() float64 {
+			return float64(value(cache.Stats()))
+		})
+	}
+
+	m.registry.MustRegister(
+		counter("hits_total", "Lyric lookups answered from the cache.", func(s cached.LyricsStats) int64 { return s.Hits }),
+		counter("negative_hits_total", "Lyric lookups answered from a cached 404.", func(s cached.LyricsStats) int64 { return s.NegativeHits }),
+		counter("misses_total", "Lyric lookups that went to the external API.", func(s cached.LyricsStats) int64 { return s.Misses }),
+	)
+}
+
+func (m *Metrics) RegisterSongCache(cache *cached.SongRepo) {
+	counter := func(name, help string, value func(cached.Stats) int64) prometheus.Collector {
+		return prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "song_cache",
+			Name:      name,
+			Help:      help,
+		}, func() float64 {
+			return float64(value(cache.Stats()))
+		})
+	}
+
+	m.registry.MustRegister(
+		counter("hits_total", "Song reads answered from the cache.", func(s cached.Stats) int64 { return s.Hits }),
+		counter("misses_total", "Song reads that went to the repository.", func(s cached.Stats) int64 { return s.Misses }),
+	)
+}
+
+func (m *Metrics) observeQuery(repository, method string, start time.Time, err error) {
+	m.queryDuration.WithLabelValues(repository, method).Observe(time.Since(start).Seconds())
+	// A missing or conflicting song is an answer, not a failed query.
+	if err != nil && !errors.Is(err, models.ErrSongNotFound) && !errors.Is(err, models.ErrSongExists) {
+		m.queryErrors.WithLabelValues(repository, method).Inc()
+	}
+}
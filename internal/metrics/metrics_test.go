@@ -0,0 +1,89 @@
+package metrics_test
+
+import (
+	"context"
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"song-lib/internal/auth"
+	"song-lib/internal/handlers"
+	"song-lib/internal/metrics"
+	"song-lib/internal/models"
+	"song-lib/internal/repository/repotest"
+	"song-lib/internal/repository/sqlite"
+	"song-lib/internal/usecase"
+	"strings"
+	"testing"
+)
+
+func get(t *testing.T, url string) (int, string) {
+	t.Helper()
+
+	res, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("GET %s: %v", url, err)
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatalf("GET %s: read body: %v", url, err)
+	}
+	return res.StatusCode, string(body)
+}
+
+// TestScrape serves a song route the way cmd/server does and checks that a
+// request to it shows up in GET /metrics.
+func TestScrape(t *testing.T) {
+	sqliteDB := repotest.OpenSQLite(t)
+	appMetrics := metrics.New()
+	appMetrics.RegisterDB(sqliteDB.DB, "songs")
+
+	songRepo := metrics.NewSongRepository(sqlite.NewSongRepo(sqliteDB, zap.NewNop().Sugar()), appMetrics)
+	if err := songRepo.CreateSong(context.Background(), models.Song{Artist: "Muse", Title: "Hysteria", Text: "verse"}); err != nil {
+		t.Fatalf("CreateSong: %v", err)
+	}
+	songHandlers := handlers.NewSongHandler(usecase.NewSongInstance(songRepo, sqlite.NewTxManager(sqliteDB, 3), repotest.StubDetails{}, zap.NewNop().Sugar()), zap.NewNop().Sugar())
+
+	e := echo.New()
+	e.HTTPErrorHandler = handlers.ErrorHandler
+	e.Use(appMetrics.Middleware())
+	e.GET("/metrics", echo.WrapHandler(appMetrics.Handler()))
+	e.GET("/api/songs/:id", songHandlers.Get, auth.Anonymous())
+
+	server := httptest.NewServer(e)
+	t.Cleanup(server.Close)
+
+	for _, id := range []int{1, 1, 404} {
+		_, _ = get(t, fmt.Sprintf("%s/api/songs/%d", server.URL, id))
+	}
+	status, body := get(t, server.URL+"/metrics")
+	if status != http.StatusOK {
+		t.Fatalf("GET /metrics status = %d, want 200", status)
+	}
+
+	for _, want := range []string{
+		`songlib_http_requests_total{method="GET",route="/api/songs/:id",status="200"} 2`,
+		`songlib_http_requests_total{method="GET",route="/api/songs/:id",status="404"} 1`,
+		`songlib_http_request_duration_seconds_count{method="GET",route="/api/songs/:id",status="200"} 2`,
+		`songlib_http_request_duration_seconds_bucket{method="GET",route="/api/songs/:id",status="200",le="+Inf"} 2`,
+		`go_sql_max_open_connections{db_name="songs"}`,
+		`go_sql_open_connections{db_name="songs"}`,
+		`go_sql_in_use_connections{db_name="songs"}`,
+		`songlib_repository_query_duration_seconds_count{method="CreateSong",repository="song"} 1`,
+		`songlib_repository_query_duration_seconds_bucket{method="CreateSong",repository="song",le="+Inf"} 1`,
+		`songlib_repository_query_duration_seconds_count{method="Exist",repository="song"} 3`,
+		`songlib_repository_query_duration_seconds_count{method="GetSongText",repository="song"} 2`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("GET /metrics is missing %s", want)
+		}
+	}
+	// A missing song is an answer, not a failed query.
+	if strings.Contains(body, "songlib_repository_query_errors_total{") {
+		t.Errorf("GET /metrics counts the 404 as a repository error")
+	}
+}
@@ -0,0 +1,62 @@
+package metrics
+
+import (
+	"context"
+	"song-lib/internal/models"
+	"song-lib/internal/usecase/song"
+	"time"
+)
+
+type SongRepository struct {
+	next    song.Repository
+	metrics *Metrics
+}
+
+func NewSongRepository(next song.Repository, metrics *Metrics) *SongRepository {
+	return &SongRepository{next: next, metrics: metrics}
+}
+
+func (r *SongRepository) Exist(ctx context.Context, songID int) bool {
+	defer r.metrics.observeQuery("song", "Exist", time.Now(), nil)
+	return r.next.Exist(ctx, songID)
+}
+
+func (r *SongRepository) GetSong(ctx context.Context, songID int) (s models.Song, err error) {
+	defer func(start time.Time) { r.metrics.observeQuery("song", "GetSong", start, err) }(time.Now())
+	return r.next.GetSong(ctx, songID)
+}
+
+func (r *SongRepository) GetSongs(ctx context.Context, filter models.SongFilter) (songs []models.Song, err error) {
+	defer func(start time.Time) { r.metrics.observeQuery("song", "GetSongs", start, err) }(time.Now())
+	return r.next.GetSongs(ctx, filter)
+}
+
+func (r *SongRepository) GetSongText(ctx context.Context, songID int) (text []string, err error) {
+	defer func(start time.Time) { r.metrics.observeQuery("song", "GetSongText", start, err) }(time.Now())
+	return r.next.GetSongText(ctx, songID)
+}
+
+func (r *SongRepository) CreateSong(ctx context.Context, s models.Song) (err error) {
+	defer func(start time.Time) { r.metrics.observeQuery("song", "CreateSong", start, err) }(time.Now())
+	return r.next.CreateSong(ctx, s)
+}
+
+func (r *SongRepository) ChangeSong(ctx context.Context, s models.Song) (err error) {
+	defer func(start time.Time) { r.metrics.observeQuery("song", "ChangeSong", start, err) }(time.Now())
+	return r.next.ChangeSong(ctx, s)
+}
+
+func (r *SongRepository) DeleteSong(ctx context.Context, songID int) (err error) {
+	defer func(start time.Time) { r.metrics.observeQuery("song", "DeleteSong", start, err) }(time.Now())
+	return r.next.DeleteSong(ctx, songID)
+}
+
+func (r *SongRepository) GetDeletedSong(ctx context.Context, songID int) (s models.Song, err error) {
+	defer func(start time.Time) { r.metrics.observeQuery("song", "GetDeletedSong", start, err) }(time.Now())
+	return r.next.GetDeletedSong(ctx, songID)
+}
+
+func (r *SongRepository) RestoreSong(ctx context.Context, s models.Song) (err error) {
+	defer func(start time.Time) { r.metrics.observeQuery("song", "RestoreSong", start, err) }(time.Now())
+	return r.next.RestoreSong(ctx, s)
+}
@@ -0,0 +1,76 @@
+package mockinfo
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+type Fixture struct {
+	Group       string   `json:"group"`
+	Song        string   `json:"song"`
+	ReleaseDate string   `json:"releaseDate"`
+	Text        string   `json:"text"`
+	Link        string   `json:"link"`
+	Status      int      `json:"status,omitempty"`
+	Delay       Duration `json:"delay,omitempty"`
+	Malformed   bool     `json:"malformed,omitempty"`
+}
+
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func Key(group, song string) string {
+	return strings.ToLower(strings.Join(strings.Fields(group), " ")) + "\x00" +
+		strings.ToLower(strings.Join(strings.Fields(song), " "))
+}
+
+func LoadFixtures(dir string) (map[string]Fixture, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	fixtures := make(map[string]Fixture)
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		var list []Fixture
+		if strings.HasPrefix(strings.TrimSpace(string(data)), "[") {
+			err = json.Unmarshal(data, &list)
+		} else {
+			var fixture Fixture
+			err = json.Unmarshal(data, &fixture)
+			list = append(list, fixture)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse fixture %s: %w", file, err)
+		}
+
+		for _, fixture := range list {
+			if fixture.Group == "" || fixture.Song == "" {
+				return nil, fmt.Errorf("fixture %s: group and song are required", file)
+			}
+			fixtures[Key(fixture.Group, fixture.Song)] = fixture
+		}
+	}
+	return fixtures, nil
+}
@@ -0,0 +1,122 @@
+package mockinfo
+
+import (
+	"encoding/json"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Faults are applied to every request unless a fixture or the X-Mock-* request
+// headers override them.
+type Faults struct {
+	Latency       time.Duration
+	NotFoundRate  float64
+	ErrorRate     float64
+	MalformedRate float64
+}
+
+type Server struct {
+	mu       sync.RWMutex
+	fixtures map[string]Fixture
+	faults   Faults
+}
+
+func NewServer(fixtures map[string]Fixture, faults Faults) *Server {
+	return &Server{fixtures: fixtures, faults: faults}
+}
+
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /info", s.info)
+	return mux
+}
+
+func (s *Server) SetFixture(fixture Fixture) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fixtures[Key(fixture.Group, fixture.Song)] = fixture
+}
+
+func (s *Server) SetFaults(faults Faults) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = faults
+}
+
+type response struct {
+	ReleaseDate string `json:"releaseDate"`
+	Text        string `json:"text"`
+	Link        string `json:"link"`
+}
+
+func (s *Server) info(w http.ResponseWriter, r *http.Request) {
+	group := r.URL.Query().Get("group")
+	song := r.URL.Query().Get("song")
+	if group == "" || song == "" {
+		http.Error(w, "group and song are required", http.StatusBadRequest)
+		return
+	}
+
+	s.mu.RLock()
+	fixture, found := s.fixtures[Key(group, song)]
+	faults := s.faults
+	s.mu.RUnlock()
+
+	delay := faults.Latency
+	if fixture.Delay > 0 {
+		delay = time.Duration(fixture.Delay)
+	}
+	if v := r.Header.Get("X-Mock-Delay"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			delay = d
+		}
+	}
+	if delay > 0 {
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	status := fixture.Status
+	if v := r.Header.Get("X-Mock-Status"); v != "" {
+		if code, err := strconv.Atoi(v); err == nil {
+			status = code
+		}
+	}
+	if status == 0 {
+		switch {
+		case !found || hit(faults.NotFoundRate):
+			status = http.StatusNotFound
+		case hit(faults.ErrorRate):
+			status = http.StatusInternalServerError
+		default:
+			status = http.StatusOK
+		}
+	}
+	if status != http.StatusOK {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if fixture.Malformed || r.Header.Get("X-Mock-Malformed") == "true" || hit(faults.MalformedRate) {
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`{"releaseDate": "` + fixture.ReleaseDate + `", "text": `))
+		return
+	}
+
+	_ = json.NewEncoder(w).Encode(response{
+		ReleaseDate: fixture.ReleaseDate,
+		Text:        fixture.Text,
+		Link:        fixture.Link,
+	})
+}
+
+func hit(rate float64) bool {
+	return rate > 0 && rand.Float64() < rate
+}
@@ -0,0 +1,46 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	EventSongCreated = "song.created"
+	EventSongUpdated = "song.updated"
+	EventSongDeleted = "song.deleted"
+)
+
+// OutboxEvent is a song change written in the transaction of the mutation
+// and relayed downstream afterwards. IDs grow with every change of a song,
+// so consumers can drop redeliveries and reorder by them.
+type OutboxEvent struct {
+	ID         int64     `json:"id"`
+	Type       string    `json:"type"`
+	SongID     int       `json:"song_id"`
+	OccurredAt time.Time `json:"occurred_at"`
+	// Song is the song after the change, or before it for song.deleted.
+	Song json.RawMessage `json:"song" swaggertype:"object"`
+	// Attempts and LastError track failed deliveries; NextAttemptAt is when
+	// the next one is due, and DeadAt when the relay gave up on the event.
+	Attempts      int        `json:"-"`
+	LastError     string     `json:"-"`
+	NextAttemptAt *time.Time `json:"-"`
+	DeadAt        *time.Time `json:"-"`
+}
+
+// NewOutboxEvent describes the change recorded by an audit event; a
+// restored song is announced as created again.
+func NewOutboxEvent(event AuditEvent) OutboxEvent {
+	outboxEvent := OutboxEvent{SongID: event.SongID, OccurredAt: event.OccurredAt, Song: event.After}
+	switch event.Action {
+	case AuditCreate, AuditRestore:
+		outboxEvent.Type = EventSongCreated
+	case AuditUpdate:
+		outboxEvent.Type = EventSongUpdated
+	case AuditDelete:
+		outboxEvent.Type = EventSongDeleted
+		outboxEvent.Song = event.Before
+	}
+	return outboxEvent
+}
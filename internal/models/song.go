@@ -1,5 +1,17 @@
 package models
 
+import "errors"
+
+var (
+	ErrSongNotFound = errors.New("song not found")
+	// ErrSongExists is returned when a write would break the (artist, title)
+	// uniqueness, or restore a song whose ID is taken.
+	ErrSongExists = errors.New("song already exists")
+	// ErrForbidden is returned when the caller may not modify a song, e.g. a
+	// contributor editing someone else's song.
+	ErrForbidden = errors.New("forbidden")
+)
+
 type Song struct {
 	ID          int    `db:"id" json:"id"`
 	Artist      string `db:"artist" json:"artist"`
@@ -7,6 +19,8 @@ type Song struct {
 	ReleaseDate string `db:"release_date" json:"release_date"`
 	Text        string `db:"text" json:"text"`
 	SourceLink  string `db:"source_link" json:"source_link"`
+	CreatedBy   *int   `db:"created_by" json:"created_by,omitempty"`
+	UpdatedBy   *int   `db:"updated_by" json:"updated_by,omitempty"`
 }
 
 type SongFilter struct {
@@ -15,6 +29,7 @@ type SongFilter struct {
 	ReleaseDate string
 	Text        string
 	SourceLink  string
+	CreatedBy   int
 	Limit       uint64
 	Offset      uint64
 }
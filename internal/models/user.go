@@ -0,0 +1,17 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrUserNotFound = errors.New("user not found")
+
+type User struct {
+	ID         int       `db:"id" json:"id"`
+	Subject    string    `db:"subject" json:"subject"`
+	Name       string    `db:"name" json:"name"`
+	Role       string    `db:"role" json:"role"`
+	CreatedAt  time.Time `db:"created_at" json:"created_at"`
+	LastSeenAt time.Time `db:"last_seen_at" json:"last_seen_at"`
+}
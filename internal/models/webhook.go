@@ -0,0 +1,99 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+)
+
+var (
+	ErrWebhookNotFound  = errors.New("webhook not found")
+	ErrDeliveryNotFound = errors.New("webhook delivery not found")
+	// ErrInvalidWebhook wraps the reason a subscription was rejected.
+	ErrInvalidWebhook = errors.New("invalid webhook")
+)
+
+// WebhookEvents lists the event types a webhook can subscribe to.
+var WebhookEvents = []string{EventSongCreated, EventSongUpdated, EventSongDeleted}
+
+// Webhook is a subscription of a partner endpoint to song changes.
+type Webhook struct {
+	ID     int      `json:"id"`
+	Name   string   `json:"name"`
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	// Artists limits deliveries to songs of these artists, compared
+	// case-insensitively; empty means every artist.
+	Artists   []string  `json:"artists"`
+	Active    bool      `json:"active"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// Secret signs the deliveries; it is shown once, when the webhook is
+	// created.
+	Secret string `json:"-"`
+}
+
+// Matches reports whether the webhook subscribes to event.
+func (w Webhook) Matches(event OutboxEvent) bool {
+	if !w.Active || !slices.Contains(w.Events, event.Type) {
+		return false
+	}
+	if len(w.Artists) == 0 {
+		return true
+	}
+
+	var song Song
+	if err := json.Unmarshal(event.Song, &song); err != nil {
+		return false
+	}
+	return slices.ContainsFunc(w.Artists, func(artist string) bool {
+		return strings.EqualFold(artist, song.Artist)
+	})
+}
+
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	// DeliveryDead marks a delivery that ran out of attempts; it is retried
+	// only when redelivered by hand.
+	DeliveryDead = "dead"
+)
+
+// WebhookDelivery is one outbox event queued for one webhook, together with
+// the outcome of its last attempt.
+type WebhookDelivery struct {
+	ID        int64  `json:"id"`
+	WebhookID int    `json:"webhook_id"`
+	EventID   int64  `json:"event_id"`
+	EventType string `json:"event_type"`
+	// Payload is the body POSTed to the webhook, the same on every attempt.
+	Payload        json.RawMessage `json:"payload" swaggertype:"object"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  *time.Time      `json:"next_attempt_at,omitempty"`
+	LastAttemptAt  *time.Time      `json:"last_attempt_at,omitempty"`
+	ResponseStatus int             `json:"response_status,omitempty"`
+	LastError      string          `json:"last_error,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	DeliveredAt    *time.Time      `json:"delivered_at,omitempty"`
+}
+
+type DeliveryFilter struct {
+	WebhookID int
+	Status    string
+	Limit     uint64
+	Offset    uint64
+}
+
+// DeliveryAttempt is the outcome of one POST of a delivery. NextAttemptAt is
+// nil when the delivery succeeded or is given up on.
+type DeliveryAttempt struct {
+	DeliveryID     int64
+	Status         string
+	ResponseStatus int
+	Error          string
+	AttemptedAt    time.Time
+	NextAttemptAt  *time.Time
+}
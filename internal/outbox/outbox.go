@@ -0,0 +1,163 @@
+// Package outbox relays the song changes that the repositories write to the
+// outbox_events table, in the transaction of each mutation, to a Sink.
+//
+// Delivery is at least once: an event is removed only after the sink
+// accepted it, so a crash in between delivers it again. Events of one song
+// are delivered in the order they were written; when one fails, it is
+// retried with a growing backoff and the later events of that song wait for
+// it, while other songs go on. After MaxAttempts failures the event is dead:
+// it stays in the outbox, is no longer retried and no longer holds up its
+// song.
+package outbox
+
+import (
+	"context"
+	"go.uber.org/zap"
+	"song-lib/internal/logging"
+	"song-lib/internal/models"
+	"sync/atomic"
+	"time"
+)
+
+// Store is the outbox table of the configured storage.
+type Store interface {
+	// Lock makes sure one relay at a time reads the outbox, since replicas
+	// racing for events would break the order per song. acquired is false
+	// when another relay holds it.
+	Lock(ctx context.Context) (unlock func(), acquired bool, err error)
+	// Pending returns up to limit undelivered events that are due, oldest
+	// first. It leaves out dead events and every event of a song whose
+	// earlier event waits for a retry.
+	Pending(ctx context.Context, limit int) ([]models.OutboxEvent, error)
+	MarkPublished(ctx context.Context, ids ...int64) error
+	// MarkFailed records a failed delivery to be retried at nextAttemptAt,
+	// or marks the event dead if nextAttemptAt is nil.
+	MarkFailed(ctx context.Context, id int64, reason string, nextAttemptAt *time.Time) error
+}
+
+// Sink delivers an event downstream; an error leaves it in the outbox.
+type Sink interface {
+	Publish(ctx context.Context, event models.OutboxEvent) error
+}
+
+type Options struct {
+	BatchSize      int
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+type Stats struct {
+	Published int64  `json:"published"`
+	Failed    int64  `json:"failed"`
+	Dead      int64  `json:"dead"`
+	LastError string `json:"last_error,omitempty"`
+}
+
+type Relay struct {
+	store  Store
+	sink   Sink
+	opts   Options
+	logger *zap.SugaredLogger
+
+	published atomic.Int64
+	failed    atomic.Int64
+	dead      atomic.Int64
+	lastError atomic.Pointer[string]
+}
+
+func NewRelay(store Store, sink Sink, opts Options, logger *zap.SugaredLogger) *Relay {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 100
+	}
+	return &Relay{store: store, sink: sink, opts: opts, logger: logger}
+}
+
+func (r *Relay) Stats() Stats {
+	stats := Stats{Published: r.published.Load(), Failed: r.failed.Load(), Dead: r.dead.Load()}
+	if msg := r.lastError.Load(); msg != nil {
+		stats.LastError = *msg
+	}
+	return stats
+}
+
+// Flush delivers pending events batch by batch until the outbox is drained
+// or a batch had failures, and returns how many were delivered. It does
+// nothing while another relay holds the lock.
+func (r *Relay) Flush(ctx context.Context) (int, error) {
+	unlock, acquired, err := r.store.Lock(ctx)
+	if err != nil || !acquired {
+		return 0, err
+	}
+	defer unlock()
+
+	total := 0
+	for {
+		published, failed, fetched, err := r.relayBatch(ctx)
+		total += published
+		if err != nil || failed > 0 || fetched < r.opts.BatchSize {
+			return total, err
+		}
+	}
+}
+
+// Backoff returns the delay before the attempt that follows attempts failed
+// ones: InitialBackoff doubled with every failure, up to MaxBackoff.
+func (r *Relay) Backoff(attempts int) time.Duration {
+	delay := r.opts.InitialBackoff
+	for i := 1; i < attempts && delay < r.opts.MaxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, r.opts.MaxBackoff)
+}
+
+func (r *Relay) relayBatch(ctx context.Context) (published, failed, fetched int, err error) {
+	logger := logging.FromContext(ctx, r.logger)
+
+	events, err := r.store.Pending(ctx, r.opts.BatchSize)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	var delivered []int64
+	blocked := make(map[int]bool)
+	for _, event := range events {
+		if blocked[event.SongID] {
+			continue
+		}
+
+		if err := r.sink.Publish(ctx, event); err != nil {
+			blocked[event.SongID] = true
+			failed++
+			msg := err.Error()
+			r.lastError.Store(&msg)
+
+			var nextAttemptAt *time.Time
+			if attempts := event.Attempts + 1; r.opts.MaxAttempts > 0 && attempts >= r.opts.MaxAttempts {
+				r.dead.Add(1)
+				logger.Errorw("Outbox event is dead after running out of attempts", "eventID", event.ID, "type", event.Type,
+					"songID", event.SongID, "attempts", attempts, "error", err)
+			} else {
+				next := time.Now().Add(r.Backoff(attempts))
+				nextAttemptAt = &next
+				r.failed.Add(1)
+				logger.Warnw("Failed to publish outbox event, will retry", "eventID", event.ID, "type", event.Type,
+					"songID", event.SongID, "attempts", attempts, "nextAttemptAt", next, "error", err)
+			}
+			if err := r.store.MarkFailed(ctx, event.ID, msg, nextAttemptAt); err != nil {
+				logger.Warnw("Failed to record outbox delivery failure", "eventID", event.ID, "error", err)
+			}
+			continue
+		}
+		delivered = append(delivered, event.ID)
+	}
+
+	if len(delivered) > 0 {
+		// Events the sink took but that stay in the outbox are sent again.
+		if err := r.store.MarkPublished(ctx, delivered...); err != nil {
+			return 0, failed, len(events), err
+		}
+		r.published.Add(int64(len(delivered)))
+	}
+	return len(delivered), failed, len(events), nil
+}
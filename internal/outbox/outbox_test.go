@@ -0,0 +1,237 @@
+package outbox_test
+
+import (
+	"context"
+	"errors"
+	"go.uber.org/zap"
+	"song-lib/internal/models"
+	"song-lib/internal/outbox"
+	"song-lib/internal/repository/memory"
+	"song-lib/internal/repository/repotest"
+	"song-lib/internal/repository/sqlite"
+	"song-lib/internal/usecase/song"
+	"sync"
+	"testing"
+	"time"
+)
+
+type storage struct {
+	songs  song.Repository
+	outbox outbox.Store
+}
+
+// storages returns an empty memory and SQLite storage for each test.
+var storages = map[string]func(t *testing.T) storage{
+	"memory": func(t *testing.T) storage {
+		memoryDB := memory.NewDB()
+		return storage{songs: memory.NewSongRepo(memoryDB, zap.NewNop().Sugar()), outbox: memory.NewOutboxRepo(memoryDB, zap.NewNop().Sugar())}
+	},
+	"sqlite": func(t *testing.T) storage {
+		sqliteDB := repotest.OpenSQLite(t)
+		return storage{songs: sqlite.NewSongRepo(sqliteDB, zap.NewNop().Sugar()), outbox: sqlite.NewOutboxRepo(sqliteDB, zap.NewNop().Sugar())}
+	},
+}
+
+// failingSink rejects the events of the songs in failing and records the
+// others in the order it took them.
+type failingSink struct {
+	mu        sync.Mutex
+	failing   map[int]bool
+	attempts  map[int64]int
+	published []models.OutboxEvent
+}
+
+func newFailingSink(songIDs ...int) *failingSink {
+	sink := &failingSink{failing: make(map[int]bool), attempts: make(map[int64]int)}
+	for _, songID := range songIDs {
+		sink.failing[songID] = true
+	}
+	return sink
+}
+
+func (s *failingSink) Publish(_ context.Context, event models.OutboxEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.attempts[event.ID]++
+	if s.failing[event.SongID] {
+		return errors.New("sink is down")
+	}
+	s.published = append(s.published, event)
+	return nil
+}
+
+func (s *failingSink) recover(songID int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.failing, songID)
+}
+
+func (s *failingSink) attemptsOf(id int64) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.attempts[id]
+}
+
+func (s *failingSink) publishedOf(songID int) []int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var ids []int64
+	for _, event := range s.published {
+		if event.SongID == songID {
+			ids = append(ids, event.ID)
+		}
+	}
+	return ids
+}
+
+// createSong writes a song and then changes it, queueing 1+changes events,
+// and returns its ID.
+func createSong(t *testing.T, store storage, title string, changes int) int {
+	t.Helper()
+
+	ctx := context.Background()
+	if err := store.songs.CreateSong(ctx, models.Song{Artist: "Muse", Title: title}); err != nil {
+		t.Fatalf("CreateSong: %v", err)
+	}
+	songs, err := store.songs.GetSongs(ctx, models.SongFilter{Title: title})
+	if err != nil || len(songs) != 1 {
+		t.Fatalf("GetSongs = %v, %v", songs, err)
+	}
+	for i := range changes {
+		changed := songs[0]
+		changed.Text = title + string(rune('a'+i))
+		if err := store.songs.ChangeSong(ctx, changed); err != nil {
+			t.Fatalf("ChangeSong: %v", err)
+		}
+	}
+	return songs[0].ID
+}
+
+func pending(t *testing.T, store storage) []models.OutboxEvent {
+	t.Helper()
+
+	events, err := store.outbox.Pending(context.Background(), 100)
+	if err != nil {
+		t.Fatalf("Pending: %v", err)
+	}
+	return events
+}
+
+func flush(t *testing.T, relay *outbox.Relay) {
+	t.Helper()
+
+	if _, err := relay.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+}
+
+func TestRelay(t *testing.T) {
+	for name, newStorage := range storages {
+		t.Run(name, func(t *testing.T) {
+			t.Run("FailingSongDoesNotStarveOthers", func(t *testing.T) {
+				store := newStorage(t)
+				failing := createSong(t, store, "Hysteria", 4)
+				other := createSong(t, store, "Uprising", 0)
+
+				sink := newFailingSink(failing)
+				// A batch only holds events of the failing song.
+				relay := outbox.NewRelay(store.outbox, sink, outbox.Options{
+					BatchSize: 2, MaxAttempts: 5, InitialBackoff: time.Hour, MaxBackoff: time.Hour,
+				}, zap.NewNop().Sugar())
+
+				for range 3 {
+					flush(t, relay)
+				}
+				if ids := sink.publishedOf(other); len(ids) != 1 {
+					t.Errorf("published %v of the other song, want its event", ids)
+				}
+				if stats := relay.Stats(); stats.Published != 1 || stats.Failed != 1 {
+					t.Errorf("Stats = %+v, want 1 published and 1 failed", stats)
+				}
+				if events := pending(t, store); len(events) != 0 {
+					t.Errorf("Pending = %v, want the failing song to wait for its backoff", events)
+				}
+			})
+
+			t.Run("RetriesAfterBackoffInOrder", func(t *testing.T) {
+				store := newStorage(t)
+				songID := createSong(t, store, "Hysteria", 2)
+
+				sink := newFailingSink(songID)
+				relay := outbox.NewRelay(store.outbox, sink, outbox.Options{
+					BatchSize: 10, MaxAttempts: 5, InitialBackoff: 50 * time.Millisecond, MaxBackoff: time.Hour,
+				}, zap.NewNop().Sugar())
+
+				first := pending(t, store)[0].ID
+				flush(t, relay)
+				if events := pending(t, store); len(events) != 0 {
+					t.Fatalf("Pending before the backoff ran out = %v, want none", events)
+				}
+				flush(t, relay)
+				if attempts := sink.attemptsOf(first); attempts != 1 {
+					t.Fatalf("first event attempted %d times before the backoff ran out, want 1", attempts)
+				}
+
+				sink.recover(songID)
+				time.Sleep(60 * time.Millisecond)
+				flush(t, relay)
+
+				ids := sink.publishedOf(songID)
+				if len(ids) != 3 || ids[0] != first || ids[1] > ids[2] || ids[0] > ids[1] {
+					t.Fatalf("published %v, want the 3 events of the song in order", ids)
+				}
+				if attempts := sink.attemptsOf(first); attempts != 2 {
+					t.Errorf("first event attempted %d times, want 2", attempts)
+				}
+				if attempts := sink.attemptsOf(ids[1]); attempts != 1 {
+					t.Errorf("second event attempted %d times, want it held back until the first went through", attempts)
+				}
+			})
+
+			t.Run("DeadAfterMaxAttempts", func(t *testing.T) {
+				store := newStorage(t)
+				songID := createSong(t, store, "Hysteria", 1)
+
+				sink := newFailingSink(songID)
+				relay := outbox.NewRelay(store.outbox, sink, outbox.Options{
+					BatchSize: 10, MaxAttempts: 2, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond,
+				}, zap.NewNop().Sugar())
+
+				first := pending(t, store)[0].ID
+				flush(t, relay)
+				time.Sleep(5 * time.Millisecond)
+				flush(t, relay)
+				if stats := relay.Stats(); stats.Failed != 1 || stats.Dead != 1 {
+					t.Fatalf("Stats = %+v, want 1 failed and 1 dead", stats)
+				}
+
+				// The dead event no longer holds up the song.
+				sink.recover(songID)
+				flush(t, relay)
+				time.Sleep(5 * time.Millisecond)
+				flush(t, relay)
+				if attempts := sink.attemptsOf(first); attempts != 2 {
+					t.Errorf("dead event attempted %d times, want 2", attempts)
+				}
+				if ids := sink.publishedOf(songID); len(ids) != 1 || ids[0] == first {
+					t.Errorf("published %v, want the event after the dead one", ids)
+				}
+				if events := pending(t, store); len(events) != 0 {
+					t.Errorf("Pending = %v, want none", events)
+				}
+			})
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	relay := outbox.NewRelay(nil, nil, outbox.Options{InitialBackoff: time.Second, MaxBackoff: 5 * time.Second}, zap.NewNop().Sugar())
+
+	for attempts, want := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 4: 5 * time.Second, 10: 5 * time.Second} {
+		if got := relay.Backoff(attempts); got != want {
+			t.Errorf("Backoff(%d) = %v, want %v", attempts, got, want)
+		}
+	}
+}
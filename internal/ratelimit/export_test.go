@@ -0,0 +1,6 @@
+package ratelimit
+
+var (
+	Take     = take
+	ResultOf = result
+)
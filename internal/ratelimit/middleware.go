@@ -0,0 +1,52 @@
+package ratelimit
+
+import (
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+	"math"
+	"net/http"
+	"song-lib/internal/auth"
+	"song-lib/internal/logging"
+	"strconv"
+	"time"
+)
+
+const (
+	HeaderLimit     = "RateLimit-Limit"
+	HeaderRemaining = "RateLimit-Remaining"
+	HeaderReset     = "RateLimit-Reset"
+)
+
+// Middleware limits requests per client under the named budget. Clients are
+// identified by auth.ClientKey: their principal (API key or token subject)
+// when the route is authenticated and their IP otherwise. Store errors let the request through.
+func Middleware(store Store, budget string, limit Limit, fallback *zap.SugaredLogger) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			req := ctx.Request()
+			logger := logging.FromContext(req.Context(), fallback)
+
+			key := budget + ":" + auth.ClientKey(ctx)
+			res, err := store.Take(req.Context(), key, limit)
+			if err != nil {
+				logger.Warnw("rate limiter unavailable, allowing request", "budget", budget, "error", err)
+				return next(ctx)
+			}
+
+			header := ctx.Response().Header()
+			header.Set(HeaderLimit, strconv.Itoa(limit.Burst))
+			header.Set(HeaderRemaining, strconv.Itoa(res.Remaining))
+			header.Set(HeaderReset, strconv.Itoa(ceilSeconds(res.Reset)))
+			if !res.Allowed {
+				logger.Warnw("rate limit exceeded", "budget", budget, "key", key)
+				header.Set(echo.HeaderRetryAfter, strconv.Itoa(ceilSeconds(res.RetryAfter)))
+				return echo.NewHTTPError(http.StatusTooManyRequests, "rate limit exceeded")
+			}
+			return next(ctx)
+		}
+	}
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,65 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jmoiron/sqlx"
+	"time"
+)
+
+// Postgres shares buckets between replicas through a table with
+// (key TEXT PRIMARY KEY, tokens DOUBLE PRECISION, allowed BOOLEAN, updated_at TIMESTAMPTZ).
+type Postgres struct {
+	db        *sqlx.DB
+	table     string
+	takeQuery string
+}
+
+func NewPostgres(db *sqlx.DB, table string) *Postgres {
+	return &Postgres{db: db, table: table, takeQuery: fmt.Sprintf(takeQuery, table, refilled)}
+}
+
+// takeQuery refills and takes a token in one statement; the row lock taken by
+// ON CONFLICT serializes concurrent requests for the same key. SET
+// expressions all see the old row, so allowed and tokens agree.
+const takeQuery = `
+INSERT INTO %[1]s AS b (key, tokens, allowed, updated_at)
+VALUES ($1, $2::float8 - 1, true, now())
+ON CONFLICT (key) DO UPDATE SET
+    allowed = %[2]s >= 1,
+    tokens = CASE WHEN %[2]s >= 1 THEN %[2]s - 1 ELSE %[2]s END,
+    updated_at = now()
+RETURNING tokens, allowed`
+
+const refilled = `LEAST($2::float8, b.tokens + GREATEST(EXTRACT(EPOCH FROM now() - b.updated_at), 0) * $3::float8)`
+
+func (p *Postgres) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	var (
+		tokens  float64
+		allowed bool
+	)
+	err := p.db.QueryRowContext(ctx, p.takeQuery, key, limit.Burst, limit.Rate).Scan(&tokens, &allowed)
+	if err != nil {
+		return Result{}, err
+	}
+	return result(tokens, allowed, limit), nil
+}
+
+// DeleteIdle removes buckets untouched for longer than idle; pass the
+// longest FillTime of the limits in use so only full buckets go.
+func (p *Postgres) DeleteIdle(ctx context.Context, idle time.Duration) (int64, error) {
+	query, args, err := sq.Delete(p.table).
+		Where(sq.Lt{"updated_at": time.Now().Add(-idle)}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return 0, err
+	}
+
+	res, err := p.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,141 @@
+package ratelimit_test
+
+import (
+	"context"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"song-lib/internal/auth"
+	"song-lib/internal/ratelimit"
+	"testing"
+	"time"
+)
+
+func TestTake(t *testing.T) {
+	limit := ratelimit.Limit{Rate: 2, Burst: 10}
+
+	for name, tc := range map[string]struct {
+		tokens  float64
+		elapsed time.Duration
+		left    float64
+		want    ratelimit.Result
+	}{
+		"Full": {
+			tokens: 10, left: 9,
+			want: ratelimit.Result{Allowed: true, Remaining: 9, Reset: 500 * time.Millisecond},
+		},
+		"Refill": {
+			tokens: 0, elapsed: time.Second, left: 1,
+			want: ratelimit.Result{Allowed: true, Remaining: 1, Reset: 4500 * time.Millisecond},
+		},
+		"BurstCap": {
+			tokens: 5, elapsed: time.Hour, left: 9,
+			want: ratelimit.Result{Allowed: true, Remaining: 9, Reset: 500 * time.Millisecond},
+		},
+		"Empty": {
+			tokens: 0.5, left: 0.5,
+			want: ratelimit.Result{Remaining: 0, RetryAfter: 250 * time.Millisecond, Reset: 4750 * time.Millisecond},
+		},
+		"ClockSkew": {
+			tokens: 0, elapsed: -time.Minute, left: 0,
+			want: ratelimit.Result{Remaining: 0, RetryAfter: 500 * time.Millisecond, Reset: 5 * time.Second},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			left, res := ratelimit.Take(tc.tokens, tc.elapsed, limit)
+			if left != tc.left || res != tc.want {
+				t.Errorf("take(%v, %v) = %v, %+v; want %v, %+v", tc.tokens, tc.elapsed, left, res, tc.left, tc.want)
+			}
+		})
+	}
+}
+
+func TestResult(t *testing.T) {
+	limit := ratelimit.Limit{Rate: 0.5, Burst: 4}
+
+	for _, tc := range []struct {
+		tokens  float64
+		allowed bool
+		want    ratelimit.Result
+	}{
+		{tokens: 4, allowed: true, want: ratelimit.Result{Allowed: true, Remaining: 4}},
+		{tokens: 2.5, allowed: true, want: ratelimit.Result{Allowed: true, Remaining: 2, Reset: 3 * time.Second}},
+		{tokens: 0, allowed: false, want: ratelimit.Result{RetryAfter: 2 * time.Second, Reset: 8 * time.Second}},
+		{tokens: 0.75, allowed: false, want: ratelimit.Result{RetryAfter: 500 * time.Millisecond, Reset: 6500 * time.Millisecond}},
+	} {
+		if got := ratelimit.ResultOf(tc.tokens, tc.allowed, limit); got != tc.want {
+			t.Errorf("result(%v, %v) = %+v, want %+v", tc.tokens, tc.allowed, got, tc.want)
+		}
+	}
+}
+
+func newServer(limit ratelimit.Limit) *echo.Echo {
+	e := echo.New()
+	e.IPExtractor = echo.ExtractIPDirect()
+	e.GET("/", func(ctx echo.Context) error {
+		return ctx.NoContent(http.StatusNoContent)
+	}, ratelimit.Middleware(ratelimit.NewMemory(), "read", limit, zap.NewNop().Sugar()))
+	return e
+}
+
+func get(e *echo.Echo, mutate func(req *http.Request)) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if mutate != nil {
+		mutate(req)
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestMiddlewareHeaders(t *testing.T) {
+	e := newServer(ratelimit.Limit{Rate: 1, Burst: 2})
+
+	for i, want := range []struct {
+		status    int
+		remaining string
+	}{{http.StatusNoContent, "1"}, {http.StatusNoContent, "0"}, {http.StatusTooManyRequests, "0"}} {
+		rec := get(e, nil)
+		header := rec.Header()
+		if rec.Code != want.status || header.Get(ratelimit.HeaderLimit) != "2" || header.Get(ratelimit.HeaderRemaining) != want.remaining {
+			t.Fatalf("request %d = %d with %v, want %d with %s remaining", i+1, rec.Code, header, want.status, want.remaining)
+		}
+		if want.status == http.StatusTooManyRequests {
+			if got := header.Get(echo.HeaderRetryAfter); got != "1" {
+				t.Errorf("Retry-After = %q, want 1", got)
+			}
+			if got := header.Get(ratelimit.HeaderReset); got != "2" {
+				t.Errorf("%s = %q, want 2", ratelimit.HeaderReset, got)
+			}
+		} else if got := header.Get(echo.HeaderRetryAfter); got != "" {
+			t.Errorf("request %d Retry-After = %q, want none", i+1, got)
+		}
+	}
+}
+
+func TestMiddlewareClient(t *testing.T) {
+	t.Run("ForwardedForIgnored", func(t *testing.T) {
+		e := newServer(ratelimit.Limit{Rate: 1, Burst: 1})
+
+		for i, forwarded := range []string{"203.0.113.1", "203.0.113.2"} {
+			rec := get(e, func(req *http.Request) { req.Header.Set(echo.HeaderXForwardedFor, forwarded) })
+			if want := []int{http.StatusNoContent, http.StatusTooManyRequests}[i]; rec.Code != want {
+				t.Errorf("request from %s = %d, want %d", forwarded, rec.Code, want)
+			}
+		}
+	})
+
+	t.Run("PerPrincipal", func(t *testing.T) {
+		e := newServer(ratelimit.Limit{Rate: 1, Burst: 1})
+
+		for _, subject := range []string{"key:1", "key:2"} {
+			rec := get(e, func(req *http.Request) {
+				*req = *req.WithContext(auth.WithPrincipal(context.Background(), auth.Principal{Subject: subject}))
+			})
+			if rec.Code != http.StatusNoContent {
+				t.Errorf("first request of %s = %d, want 204", subject, rec.Code)
+			}
+		}
+	})
+}
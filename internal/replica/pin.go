@@ -0,0 +1,76 @@
+// Package replica keeps clients reading their own writes while read replicas
+// catch up with the primary.
+package replica
+
+import (
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"song-lib/internal/auth"
+	"song-lib/internal/db"
+	"sync"
+	"time"
+)
+
+// Pinner remembers which clients wrote recently. Its state is per process,
+// so replicas of the app behind a load balancer without sticky sessions each
+// pin on their own.
+type Pinner struct {
+	window time.Duration
+
+	mu        sync.Mutex
+	wrote     map[string]time.Time
+	lastSweep time.Time
+}
+
+func NewPinner(window time.Duration) *Pinner {
+	return &Pinner{window: window, wrote: make(map[string]time.Time)}
+}
+
+// Middleware sends the reads of a client that made a successful write in the
+// last window to the primary. Clients are identified by auth.ClientKey.
+func (p *Pinner) Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			req := ctx.Request()
+			key := auth.ClientKey(ctx)
+			if p.pinned(key) {
+				ctx.SetRequest(req.WithContext(db.WithPrimary(req.Context())))
+			}
+
+			err := next(ctx)
+			if isWrite(req.Method) && err == nil && ctx.Response().Status < http.StatusBadRequest {
+				p.record(key)
+			}
+			return err
+		}
+	}
+}
+
+func (p *Pinner) pinned(key string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	wrote, ok := p.wrote[key]
+	return ok && time.Since(wrote) < p.window
+}
+
+func (p *Pinner) record(key string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	p.wrote[key] = now
+	if now.Sub(p.lastSweep) < p.window {
+		return
+	}
+	for k, wrote := range p.wrote {
+		if now.Sub(wrote) >= p.window {
+			delete(p.wrote, k)
+		}
+	}
+	p.lastSweep = now
+}
+
+func isWrite(method string) bool {
+	return method != http.MethodGet && method != http.MethodHead && method != http.MethodOptions
+}
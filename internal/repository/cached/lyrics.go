@@ -0,0 +1,137 @@
+package cached
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
+	"song-lib/internal/cache"
+	"song-lib/internal/externalAPI"
+	"song-lib/internal/logging"
+	"song-lib/internal/usecase/song"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+type LyricsOptions struct {
+	TTL         time.Duration
+	NegativeTTL time.Duration
+}
+
+type LyricsStats struct {
+	Hits         int64 `json:"hits"`
+	NegativeHits int64 `json:"negative_hits"`
+	Misses       int64 `json:"misses"`
+	Shared       int64 `json:"shared"`
+}
+
+type lyricsEntry struct {
+	Details  *externalAPI.SongDetails `json:"details,omitempty"`
+	NotFound bool                     `json:"not_found,omitempty"`
+}
+
+// LyricsClient caches the external API lookups of another
+// song.DetailsProvider, songs it does not know included.
+type LyricsClient struct {
+	next   song.DetailsProvider
+	store  cache.Store
+	opts   LyricsOptions
+	group  singleflight.Group
+	logger *zap.SugaredLogger
+
+	hits         atomic.Int64
+	negativeHits atomic.Int64
+	misses       atomic.Int64
+	shared       atomic.Int64
+}
+
+func NewLyricsClient(next song.DetailsProvider, store cache.Store, opts LyricsOptions, logger *zap.SugaredLogger) *LyricsClient {
+	return &LyricsClient{next: next, store: store, opts: opts, logger: logger}
+}
+
+func LyricsKey(artist, title string) string {
+	return "lyrics:" + normalize(artist) + "\t" + normalize(title)
+}
+
+func normalize(s string) string {
+	return strings.ToLower(strings.Join(strings.Fields(s), " "))
+}
+
+func (c *LyricsClient) GetSongDetails(ctx context.Context, artist, title string) (*externalAPI.SongDetails, error) {
+	key := LyricsKey(artist, title)
+
+	if entry, ok := c.lookup(ctx, key); ok {
+		if entry.NotFound {
+			c.negativeHits.Add(1)
+			return nil, externalAPI.ErrNotFound
+		}
+		c.hits.Add(1)
+		return entry.Details, nil
+	}
+	c.misses.Add(1)
+
+	// Lookups are shared between concurrent callers, so one caller giving up
+	// must not cancel the request for everybody else.
+	v, err, shared := c.group.Do(key, func() (interface{}, error) {
+		fetchCtx := context.WithoutCancel(ctx)
+		details, err := c.next.GetSongDetails(fetchCtx, artist, title)
+		switch {
+		case errors.Is(err, externalAPI.ErrNotFound):
+			c.save(fetchCtx, key, lyricsEntry{NotFound: true}, c.opts.NegativeTTL)
+		case err == nil:
+			c.save(fetchCtx, key, lyricsEntry{Details: details}, c.opts.TTL)
+		}
+		return details, err
+	})
+	if shared {
+		c.shared.Add(1)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return v.(*externalAPI.SongDetails), nil
+}
+
+func (c *LyricsClient) Stats() LyricsStats {
+	return LyricsStats{
+		Hits:         c.hits.Load(),
+		NegativeHits: c.negativeHits.Load(),
+		Misses:       c.misses.Load(),
+		Shared:       c.shared.Load(),
+	}
+}
+
+func (c *LyricsClient) lookup(ctx context.Context, key string) (lyricsEntry, bool) {
+	raw, ok, err := c.store.Get(ctx, key)
+	if err != nil {
+		logging.FromContext(ctx, c.logger).Warnw("Failed to read lyrics cache", "key", key, "error", err)
+		return lyricsEntry{}, false
+	}
+	if !ok {
+		return lyricsEntry{}, false
+	}
+
+	var entry lyricsEntry
+	if err := json.Unmarshal(raw, &entry); err != nil {
+		logging.FromContext(ctx, c.logger).Warnw("Failed to decode lyrics cache entry", "key", key, "error", err)
+		return lyricsEntry{}, false
+	}
+	return entry, true
+}
+
+func (c *LyricsClient) save(ctx context.Context, key string, entry lyricsEntry, ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+
+	raw, err := json.Marshal(entry)
+	if err != nil {
+		logging.FromContext(ctx, c.logger).Warnw("Failed to encode lyrics cache entry", "key", key, "error", err)
+		return
+	}
+	if err := c.store.Set(ctx, key, raw, ttl); err != nil {
+		logging.FromContext(ctx, c.logger).Warnw("Failed to write lyrics cache", "key", key, "error", err)
+	}
+}
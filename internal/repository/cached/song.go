@@ -0,0 +1,304 @@
+// Package cached serves song reads and external API lookups from a
+// cache.Store in front of another song.Repository or song.DetailsProvider.
+package cached
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"go.uber.org/zap"
+	"song-lib/internal/cache"
+	"song-lib/internal/db"
+	"song-lib/internal/logging"
+	"song-lib/internal/models"
+	"song-lib/internal/usecase/song"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Options set how long entries live: TTL for a single song and its text,
+// ListTTL for search results, which any mutation may change.
+type Options struct {
+	TTL     time.Duration
+	ListTTL time.Duration
+}
+
+type Stats struct {
+	Hits   int64 `json:"hits"`
+	Misses int64 `json:"misses"`
+}
+
+// SongRepo caches GetSong, GetSongText and GetSongs. Search results are
+// keyed by a generation that every mutation bumps, since any of them may
+// change any result; songs are invalidated by ID.
+//
+// SongRepo is also the Transactor of the use case: reads inside a unit of
+// work bypass the cache, so they see the transaction, and invalidations are
+// repeated once it has ended, so a reader that refilled an entry in between
+// does not leave the old value behind.
+//
+// Misses are filled from the primary, since a lagging replica would put the
+// value from before the last write back for the whole TTL, and reads pinned
+// to the primary after a write bypass the cache, which another replica's
+// store may not have invalidated yet.
+type SongRepo struct {
+	next   song.Repository
+	tx     song.Transactor
+	store  cache.Store
+	opts   Options
+	logger *zap.SugaredLogger
+
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+func NewSongRepo(next song.Repository, tx song.Transactor, store cache.Store, opts Options, logger *zap.SugaredLogger) *SongRepo {
+	return &SongRepo{next: next, tx: tx, store: store, opts: opts, logger: logger}
+}
+
+const generationKey = "songs:generation"
+
+func songKey(songID int) string {
+	return "song:" + strconv.Itoa(songID)
+}
+
+func textKey(songID int) string {
+	return "song:" + strconv.Itoa(songID) + ":text"
+}
+
+// pending collects the invalidations of a unit of work.
+type pending struct {
+	mu      sync.Mutex
+	songIDs []int
+}
+
+type pendingKey struct{}
+
+func (s *SongRepo) WithTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(pendingKey{}).(*pending); ok {
+		return s.tx.WithTx(ctx, fn)
+	}
+
+	p := &pending{}
+	err := s.tx.WithTx(context.WithValue(ctx, pendingKey{}, p), fn)
+
+	p.mu.Lock()
+	songIDs := p.songIDs
+	p.mu.Unlock()
+	for _, songID := range songIDs {
+		s.invalidate(ctx, songID)
+	}
+	return err
+}
+
+func inUnitOfWork(ctx context.Context) bool {
+	_, ok := ctx.Value(pendingKey{}).(*pending)
+	return ok
+}
+
+// bypass reports whether reads under ctx must not be served from the cache.
+func bypass(ctx context.Context) bool {
+	return inUnitOfWork(ctx) || db.Pinned(ctx)
+}
+
+func (s *SongRepo) Stats() Stats {
+	return Stats{Hits: s.hits.Load(), Misses: s.misses.Load()}
+}
+
+func (s *SongRepo) Exist(ctx context.Context, songID int) bool {
+	if !bypass(ctx) {
+		for _, key := range []string{songKey(songID), textKey(songID)} {
+			if _, ok, err := s.store.Get(ctx, key); err == nil && ok {
+				return true
+			}
+		}
+	}
+	return s.next.Exist(ctx, songID)
+}
+
+func (s *SongRepo) GetSong(ctx context.Context, songID int) (models.Song, error) {
+	if bypass(ctx) {
+		return s.next.GetSong(ctx, songID)
+	}
+
+	var cached models.Song
+	if s.lookup(ctx, songKey(songID), &cached) {
+		return cached, nil
+	}
+
+	found, err := s.next.GetSong(db.WithPrimary(ctx), songID)
+	if err != nil {
+		return models.Song{}, err
+	}
+	s.save(ctx, songKey(songID), found, s.opts.TTL)
+	return found, nil
+}
+
+func (s *SongRepo) GetSongText(ctx context.Context, songID int) ([]string, error) {
+	if bypass(ctx) {
+		return s.next.GetSongText(ctx, songID)
+	}
+
+	var cached []string
+	if s.lookup(ctx, textKey(songID), &cached) {
+		return cached, nil
+	}
+
+	text, err := s.next.GetSongText(db.WithPrimary(ctx), songID)
+	if err != nil || text == nil {
+		return text, err
+	}
+	s.save(ctx, textKey(songID), text, s.opts.TTL)
+	return text, nil
+}
+
+func (s *SongRepo) GetSongs(ctx context.Context, filter models.SongFilter) ([]models.Song, error) {
+	if bypass(ctx) {
+		return s.next.GetSongs(ctx, filter)
+	}
+
+	key, ok := s.listKey(ctx, filter)
+	if !ok {
+		return s.next.GetSongs(ctx, filter)
+	}
+
+	var cached []models.Song
+	if s.lookup(ctx, key, &cached) {
+		return cached, nil
+	}
+
+	songs, err := s.next.GetSongs(db.WithPrimary(ctx), filter)
+	if err != nil {
+		return nil, err
+	}
+	s.save(ctx, key, songs, s.opts.ListTTL)
+	return songs, nil
+}
+
+// listKey names the cached result of filter under the current generation,
+// starting one when the store has none.
+func (s *SongRepo) listKey(ctx context.Context, filter models.SongFilter) (string, bool) {
+	logger := logging.FromContext(ctx, s.logger)
+
+	generation, ok, err := s.store.Get(ctx, generationKey)
+	if err != nil {
+		logger.Warnw("Failed to read song cache generation", "error", err)
+		return "", false
+	}
+	if !ok {
+		if generation, err = s.bumpGeneration(ctx); err != nil {
+			logger.Warnw("Failed to start song cache generation", "error", err)
+			return "", false
+		}
+	}
+
+	raw, err := json.Marshal(filter)
+	if err != nil {
+		return "", false
+	}
+	sum := sha256.Sum256(raw)
+	return "songs:" + string(generation) + ":" + hex.EncodeToString(sum[:16]), true
+}
+
+func (s *SongRepo) bumpGeneration(ctx context.Context) ([]byte, error) {
+	generation := []byte(strconv.FormatInt(time.Now().UnixNano(), 36))
+	return generation, s.store.Set(ctx, generationKey, generation, 0)
+}
+
+func (s *SongRepo) CreateSong(ctx context.Context, song models.Song) error {
+	err := s.next.CreateSong(ctx, song)
+	if err == nil {
+		s.mutated(ctx, 0)
+	}
+	return err
+}
+
+func (s *SongRepo) ChangeSong(ctx context.Context, song models.Song) error {
+	err := s.next.ChangeSong(ctx, song)
+	if err == nil {
+		s.mutated(ctx, song.ID)
+	}
+	return err
+}
+
+func (s *SongRepo) DeleteSong(ctx context.Context, songID int) error {
+	err := s.next.DeleteSong(ctx, songID)
+	if err == nil {
+		s.mutated(ctx, songID)
+	}
+	return err
+}
+
+func (s *SongRepo) GetDeletedSong(ctx context.Context, songID int) (models.Song, error) {
+	return s.next.GetDeletedSong(ctx, songID)
+}
+
+func (s *SongRepo) RestoreSong(ctx context.Context, song models.Song) error {
+	err := s.next.RestoreSong(ctx, song)
+	if err == nil {
+		s.mutated(ctx, song.ID)
+	}
+	return err
+}
+
+// mutated invalidates what a change to songID affects; 0 only invalidates
+// search results.
+func (s *SongRepo) mutated(ctx context.Context, songID int) {
+	s.invalidate(ctx, songID)
+
+	if p, ok := ctx.Value(pendingKey{}).(*pending); ok {
+		p.mu.Lock()
+		p.songIDs = append(p.songIDs, songID)
+		p.mu.Unlock()
+	}
+}
+
+func (s *SongRepo) invalidate(ctx context.Context, songID int) {
+	logger := logging.FromContext(ctx, s.logger)
+
+	if songID != 0 {
+		if err := s.store.Delete(ctx, songKey(songID), textKey(songID)); err != nil {
+			logger.Warnw("Failed to invalidate cached song", "songID", songID, "error", err)
+		}
+	}
+	if _, err := s.bumpGeneration(ctx); err != nil {
+		logger.Warnw("Failed to invalidate cached song lists", "error", err)
+	}
+}
+
+func (s *SongRepo) lookup(ctx context.Context, key string, dest any) bool {
+	raw, ok, err := s.store.Get(ctx, key)
+	if err != nil {
+		logging.FromContext(ctx, s.logger).Warnw("Failed to read song cache", "key", key, "error", err)
+	}
+	if err != nil || !ok {
+		s.misses.Add(1)
+		return false
+	}
+
+	if err := json.Unmarshal(raw, dest); err != nil {
+		logging.FromContext(ctx, s.logger).Warnw("Failed to decode song cache entry", "key", key, "error", err)
+		s.misses.Add(1)
+		return false
+	}
+	s.hits.Add(1)
+	return true
+}
+
+func (s *SongRepo) save(ctx context.Context, key string, value any, ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+
+	raw, err := json.Marshal(value)
+	if err != nil {
+		logging.FromContext(ctx, s.logger).Warnw("Failed to encode song cache entry", "key", key, "error", err)
+		return
+	}
+	if err := s.store.Set(ctx, key, raw, ttl); err != nil {
+		logging.FromContext(ctx, s.logger).Warnw("Failed to write song cache", "key", key, "error", err)
+	}
+}
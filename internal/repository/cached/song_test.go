@@ -0,0 +1,214 @@
+package cached_test
+
+import (
+	"context"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+	"song-lib/internal/cache"
+	"song-lib/internal/db"
+	"song-lib/internal/models"
+	"song-lib/internal/repository/cached"
+	"song-lib/internal/repository/memory"
+	"song-lib/internal/usecase/song"
+	"sync"
+	"testing"
+	"time"
+)
+
+// stores returns an empty store of each kind the song cache runs on;
+// miniredis is the server behind cmd/mockredis.
+var stores = map[string]func(t *testing.T) cache.Store{
+	"lru": func(t *testing.T) cache.Store {
+		return cache.NewLRU(100)
+	},
+	"redis": func(t *testing.T) cache.Store {
+		server := miniredis.RunT(t)
+		client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+		t.Cleanup(func() { _ = client.Close() })
+		return cache.NewRedis(client, "test:")
+	},
+}
+
+// recorder counts the reads that reach the repository behind the cache and
+// whether they were sent to the primary.
+type recorder struct {
+	song.Repository
+
+	mu       sync.Mutex
+	reads    int
+	unpinned int
+}
+
+func (r *recorder) read(ctx context.Context) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.reads++
+	if !db.Pinned(ctx) {
+		r.unpinned++
+	}
+}
+
+func (r *recorder) counts() (reads, unpinned int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.reads, r.unpinned
+}
+
+func (r *recorder) GetSong(ctx context.Context, songID int) (models.Song, error) {
+	r.read(ctx)
+	return r.Repository.GetSong(ctx, songID)
+}
+
+func (r *recorder) GetSongText(ctx context.Context, songID int) ([]string, error) {
+	r.read(ctx)
+	return r.Repository.GetSongText(ctx, songID)
+}
+
+func (r *recorder) GetSongs(ctx context.Context, filter models.SongFilter) ([]models.Song, error) {
+	r.read(ctx)
+	return r.Repository.GetSongs(ctx, filter)
+}
+
+type fixture struct {
+	repo *cached.SongRepo
+	next *recorder
+	song models.Song
+}
+
+func newFixture(t *testing.T, store cache.Store) fixture {
+	t.Helper()
+
+	memoryDB := memory.NewDB()
+	next := &recorder{Repository: memory.NewSongRepo(memoryDB, zap.NewNop().Sugar())}
+	repo := cached.NewSongRepo(next, memory.NewTxManager(memoryDB), store, cached.Options{TTL: time.Minute, ListTTL: time.Minute}, zap.NewNop().Sugar())
+
+	ctx := context.Background()
+	if err := repo.CreateSong(ctx, models.Song{Artist: "Muse", Title: "Hysteria", Text: "verse\n\nchorus"}); err != nil {
+		t.Fatalf("CreateSong: %v", err)
+	}
+	songs, err := next.Repository.GetSongs(ctx, models.SongFilter{})
+	if err != nil || len(songs) != 1 {
+		t.Fatalf("GetSongs = %v, %v", songs, err)
+	}
+	return fixture{repo: repo, next: next, song: songs[0]}
+}
+
+func TestSongRepo(t *testing.T) {
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			t.Run("HitsAfterMiss", func(t *testing.T) {
+				f := newFixture(t, newStore(t))
+				ctx := context.Background()
+
+				for range 3 {
+					if _, err := f.repo.GetSong(ctx, f.song.ID); err != nil {
+						t.Fatalf("GetSong: %v", err)
+					}
+					if _, err := f.repo.GetSongText(ctx, f.song.ID); err != nil {
+						t.Fatalf("GetSongText: %v", err)
+					}
+					if _, err := f.repo.GetSongs(ctx, models.SongFilter{Artist: "Muse"}); err != nil {
+						t.Fatalf("GetSongs: %v", err)
+					}
+				}
+				if reads, _ := f.next.counts(); reads != 3 {
+					t.Errorf("%d reads reached the repository, want 3 misses", reads)
+				}
+				if stats := f.repo.Stats(); stats.Hits != 6 || stats.Misses != 3 {
+					t.Errorf("Stats = %+v, want 6 hits and 3 misses", stats)
+				}
+			})
+
+			t.Run("MissesFillFromPrimary", func(t *testing.T) {
+				f := newFixture(t, newStore(t))
+				ctx := context.Background()
+
+				_, _ = f.repo.GetSong(ctx, f.song.ID)
+				_, _ = f.repo.GetSongText(ctx, f.song.ID)
+				_, _ = f.repo.GetSongs(ctx, models.SongFilter{})
+				if reads, unpinned := f.next.counts(); reads != 3 || unpinned != 0 {
+					t.Errorf("%d of %d misses read from a replica, want all from the primary", unpinned, reads)
+				}
+			})
+
+			t.Run("PinnedReadsBypass", func(t *testing.T) {
+				f := newFixture(t, newStore(t))
+				ctx := db.WithPrimary(context.Background())
+
+				for range 2 {
+					if _, err := f.repo.GetSong(ctx, f.song.ID); err != nil {
+						t.Fatalf("GetSong: %v", err)
+					}
+				}
+				if reads, _ := f.next.counts(); reads != 2 {
+					t.Errorf("%d of 2 pinned reads reached the repository", reads)
+				}
+				if _, err := f.repo.GetSong(context.Background(), f.song.ID); err != nil {
+					t.Fatalf("GetSong: %v", err)
+				}
+				if stats := f.repo.Stats(); stats.Misses != 1 {
+					t.Errorf("Stats = %+v, want the unpinned read to miss, pinned reads fill nothing", stats)
+				}
+			})
+
+			t.Run("ChangeInvalidates", func(t *testing.T) {
+				f := newFixture(t, newStore(t))
+				ctx := context.Background()
+
+				_, _ = f.repo.GetSong(ctx, f.song.ID)
+				_, _ = f.repo.GetSongs(ctx, models.SongFilter{Title: "Hysteria"})
+
+				changed := f.song
+				changed.Title = "Uprising"
+				if err := f.repo.ChangeSong(ctx, changed); err != nil {
+					t.Fatalf("ChangeSong: %v", err)
+				}
+
+				got, err := f.repo.GetSong(ctx, f.song.ID)
+				if err != nil || got.Title != "Uprising" {
+					t.Errorf("GetSong after ChangeSong = %+v, %v; want the new title", got, err)
+				}
+				songs, err := f.repo.GetSongs(ctx, models.SongFilter{Title: "Hysteria"})
+				if err != nil || len(songs) != 0 {
+					t.Errorf("GetSongs after ChangeSong = %v, %v; want no songs", songs, err)
+				}
+			})
+
+			t.Run("DeleteInvalidates", func(t *testing.T) {
+				f := newFixture(t, newStore(t))
+				ctx := context.Background()
+
+				_, _ = f.repo.GetSong(ctx, f.song.ID)
+				_, _ = f.repo.GetSongText(ctx, f.song.ID)
+				if err := f.repo.DeleteSong(ctx, f.song.ID); err != nil {
+					t.Fatalf("DeleteSong: %v", err)
+				}
+
+				if _, err := f.repo.GetSong(ctx, f.song.ID); err != models.ErrSongNotFound {
+					t.Errorf("GetSong after DeleteSong error = %v, want ErrSongNotFound", err)
+				}
+				if f.repo.Exist(ctx, f.song.ID) {
+					t.Error("Exist after DeleteSong = true")
+				}
+			})
+
+			t.Run("UnitOfWorkBypasses", func(t *testing.T) {
+				f := newFixture(t, newStore(t))
+				ctx := context.Background()
+
+				_, _ = f.repo.GetSong(ctx, f.song.ID)
+				err := f.repo.WithTx(ctx, func(ctx context.Context) error {
+					_, err := f.repo.GetSong(ctx, f.song.ID)
+					return err
+				})
+				if err != nil {
+					t.Fatalf("WithTx: %v", err)
+				}
+				if reads, _ := f.next.counts(); reads != 2 {
+					t.Errorf("%d reads reached the repository, want the read in the unit of work to bypass the cache", reads)
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package memory
+
+import (
+	"context"
+	"go.uber.org/zap"
+	"slices"
+	"song-lib/internal/models"
+	"time"
+)
+
+type apiKey struct {
+	key  models.APIKey
+	hash string
+}
+
+type APIKeyRepo struct {
+	db     *DB
+	logger *zap.SugaredLogger
+}
+
+func NewAPIKeyRepo(db *DB, logger *zap.SugaredLogger) *APIKeyRepo {
+	return &APIKeyRepo{db: db, logger: logger}
+}
+
+func (a *APIKeyRepo) CreateKey(_ context.Context, key models.APIKey, hash string) (models.APIKey, error) {
+	a.db.mu.Lock()
+	defer a.db.mu.Unlock()
+
+	a.db.lastAPIKeyID++
+	key.ID = a.db.lastAPIKeyID
+	key.CreatedAt = time.Now()
+	a.db.apiKeys[key.ID] = apiKey{key: key, hash: hash}
+	return key, nil
+}
+
+func (a *APIKeyRepo) ListKeys(_ context.Context) ([]models.APIKey, error) {
+	a.db.mu.RLock()
+	defer a.db.mu.RUnlock()
+
+	keys := make([]models.APIKey, 0, len(a.db.apiKeys))
+	for _, stored := range a.db.apiKeys {
+		keys = append(keys, stored.key)
+	}
+	slices.SortFunc(keys, func(a, b models.APIKey) int { return a.ID - b.ID })
+	return keys, nil
+}
+
+func (a *APIKeyRepo) RevokeKey(_ context.Context, keyID int) error {
+	a.db.mu.Lock()
+	defer a.db.mu.Unlock()
+
+	stored, ok := a.db.apiKeys[keyID]
+	if !ok || stored.key.RevokedAt != nil {
+		return models.ErrAPIKeyNotFound
+	}
+	now := time.Now()
+	stored.key.RevokedAt = &now
+	a.db.apiKeys[keyID] = stored
+	return nil
+}
+
+func (a *APIKeyRepo) Authenticate(_ context.Context, hash string) (models.APIKey, error) {
+	a.db.mu.Lock()
+	defer a.db.mu.Unlock()
+
+	for id, stored := range a.db.apiKeys {
+		if stored.hash != hash || stored.key.RevokedAt != nil {
+			continue
+		}
+		now := time.Now()
+		key := stored.key
+		stored.key.LastUsedAt = &now
+		a.db.apiKeys[id] = stored
+		return key, nil
+	}
+	return models.APIKey{}, models.ErrAPIKeyNotFound
+}
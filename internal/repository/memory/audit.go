@@ -0,0 +1,74 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"go.uber.org/zap"
+	"slices"
+	"song-lib/internal/models"
+	"time"
+)
+
+type AuditRepo struct {
+	db     *DB
+	logger *zap.SugaredLogger
+}
+
+func NewAuditRepo(db *DB, logger *zap.SugaredLogger) *AuditRepo {
+	return &AuditRepo{db: db, logger: logger}
+}
+
+func (a *AuditRepo) ListEvents(_ context.Context, filter models.AuditFilter) ([]models.AuditEvent, error) {
+	a.db.mu.RLock()
+	defer a.db.mu.RUnlock()
+
+	events := make([]models.AuditEvent, 0)
+	skipped := uint64(0)
+	for i := len(a.db.auditEvents) - 1; i >= 0; i-- {
+		event := a.db.auditEvents[i]
+		switch {
+		case filter.SongID != 0 && event.SongID != filter.SongID,
+			filter.Actor != "" && event.Actor != filter.Actor,
+			!filter.From.IsZero() && event.OccurredAt.Before(filter.From),
+			!filter.To.IsZero() && !event.OccurredAt.Before(filter.To):
+			continue
+		}
+		if skipped < filter.Offset {
+			skipped++
+			continue
+		}
+		events = append(events, event)
+		if filter.Limit > 0 && uint64(len(events)) == filter.Limit {
+			break
+		}
+	}
+	return events, nil
+}
+
+// EventsAfter returns up to limit events with IDs above afterID, oldest
+// first, for following the log.
+func (a *AuditRepo) EventsAfter(_ context.Context, afterID int64, limit uint64) ([]models.AuditEvent, error) {
+	a.db.mu.RLock()
+	defer a.db.mu.RUnlock()
+
+	i, _ := slices.BinarySearchFunc(a.db.auditEvents, afterID+1, func(event models.AuditEvent, id int64) int {
+		return cmp.Compare(event.ID, id)
+	})
+	events := a.db.auditEvents[i:]
+	return slices.Clone(events[:min(limit, uint64(len(events)))]), nil
+}
+
+func (a *AuditRepo) DeleteBefore(_ context.Context, before time.Time) (int64, error) {
+	a.db.mu.Lock()
+	defer a.db.mu.Unlock()
+
+	kept := a.db.auditEvents[:0]
+	for _, event := range a.db.auditEvents {
+		if !event.OccurredAt.Before(before) {
+			kept = append(kept, event)
+		}
+	}
+	deleted := int64(len(a.db.auditEvents) - len(kept))
+	a.db.auditEvents = kept
+	return deleted, nil
+}
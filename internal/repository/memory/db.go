@@ -0,0 +1,45 @@
+package memory
+
+import (
+	"song-lib/internal/models"
+	"sync"
+)
+
+// DB holds the tables of the in-memory repositories behind one lock, so a
+// song mutation and its audit and outbox events are applied atomically just
+// like the Postgres transaction does.
+type DB struct {
+	mu sync.RWMutex
+	// txMu serializes units of work run by TxManager.
+	txMu sync.Mutex
+
+	songs      map[int]models.Song
+	lastSongID int
+
+	users      map[int]models.User
+	lastUserID int
+
+	apiKeys      map[int]apiKey
+	lastAPIKeyID int
+
+	auditEvents []models.AuditEvent
+	lastAuditID int64
+
+	outboxEvents []models.OutboxEvent
+	lastOutboxID int64
+
+	webhooks      map[int]models.Webhook
+	lastWebhookID int
+
+	deliveries     []models.WebhookDelivery
+	lastDeliveryID int64
+}
+
+func NewDB() *DB {
+	return &DB{
+		songs:    make(map[int]models.Song),
+		users:    make(map[int]models.User),
+		apiKeys:  make(map[int]apiKey),
+		webhooks: make(map[int]models.Webhook),
+	}
+}
@@ -0,0 +1,74 @@
+package memory
+
+import (
+	"context"
+	"go.uber.org/zap"
+	"slices"
+	"song-lib/internal/models"
+	"time"
+)
+
+type OutboxRepo struct {
+	db     *DB
+	logger *zap.SugaredLogger
+}
+
+func NewOutboxRepo(db *DB, logger *zap.SugaredLogger) *OutboxRepo {
+	return &OutboxRepo{db: db, logger: logger}
+}
+
+// Lock always succeeds: the outbox lives in this process, which runs one
+// relay.
+func (o *OutboxRepo) Lock(context.Context) (func(), bool, error) {
+	return func() {}, true, nil
+}
+
+func (o *OutboxRepo) Pending(_ context.Context, limit int) ([]models.OutboxEvent, error) {
+	o.db.mu.RLock()
+	defer o.db.mu.RUnlock()
+
+	now := time.Now()
+	waiting := make(map[int]bool)
+	var events []models.OutboxEvent
+	for _, event := range o.db.outboxEvents {
+		if len(events) == limit {
+			break
+		}
+		switch {
+		case event.DeadAt != nil, waiting[event.SongID]:
+		case event.NextAttemptAt != nil && event.NextAttemptAt.After(now):
+			waiting[event.SongID] = true
+		default:
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+func (o *OutboxRepo) MarkPublished(_ context.Context, ids ...int64) error {
+	o.db.mu.Lock()
+	defer o.db.mu.Unlock()
+
+	o.db.outboxEvents = slices.DeleteFunc(o.db.outboxEvents, func(event models.OutboxEvent) bool {
+		return slices.Contains(ids, event.ID)
+	})
+	return nil
+}
+
+func (o *OutboxRepo) MarkFailed(_ context.Context, id int64, reason string, nextAttemptAt *time.Time) error {
+	o.db.mu.Lock()
+	defer o.db.mu.Unlock()
+
+	for i := range o.db.outboxEvents {
+		if event := &o.db.outboxEvents[i]; event.ID == id {
+			event.Attempts++
+			event.LastError = reason
+			event.NextAttemptAt = nextAttemptAt
+			if nextAttemptAt == nil {
+				deadAt := time.Now()
+				event.DeadAt = &deadAt
+			}
+		}
+	}
+	return nil
+}
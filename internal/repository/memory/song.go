@@ -0,0 +1,220 @@
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"go.uber.org/zap"
+	"slices"
+	"song-lib/internal/audit"
+	"song-lib/internal/logging"
+	"song-lib/internal/models"
+	"strings"
+	"time"
+)
+
+type SongRepo struct {
+	db     *DB
+	logger *zap.SugaredLogger
+}
+
+func NewSongRepo(db *DB, logger *zap.SugaredLogger) *SongRepo {
+	return &SongRepo{db: db, logger: logger}
+}
+
+func (s *SongRepo) Exist(_ context.Context, songID int) bool {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+
+	_, ok := s.db.songs[songID]
+	return ok
+}
+
+func (s *SongRepo) GetSong(_ context.Context, songID int) (models.Song, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+
+	song, ok := s.db.songs[songID]
+	if !ok {
+		return models.Song{}, models.ErrSongNotFound
+	}
+	return song, nil
+}
+
+func (s *SongRepo) GetSongs(ctx context.Context, filter models.SongFilter) ([]models.Song, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+
+	var songs []models.Song
+	for _, song := range s.db.songs {
+		if matches(song, filter) {
+			songs = append(songs, song)
+		}
+	}
+	slices.SortFunc(songs, func(a, b models.Song) int { return a.ID - b.ID })
+
+	offset := min(int(filter.Offset), len(songs))
+	songs = songs[offset:]
+	if filter.Limit > 0 && int(filter.Limit) < len(songs) {
+		songs = songs[:filter.Limit]
+	}
+
+	logging.FromContext(ctx, s.logger).Infow("Successfully retrieved songs", "count", len(songs))
+	return songs, nil
+}
+
+func matches(song models.Song, filter models.SongFilter) bool {
+	switch {
+	case filter.Artist != "" && !strings.Contains(song.Artist, filter.Artist),
+		filter.Title != "" && !strings.Contains(song.Title, filter.Title),
+		filter.ReleaseDate != "" && song.ReleaseDate != filter.ReleaseDate,
+		filter.Text != "" && !strings.Contains(song.Text, filter.Text),
+		filter.SourceLink != "" && song.SourceLink != filter.SourceLink,
+		filter.CreatedBy != 0 && (song.CreatedBy == nil || *song.CreatedBy != filter.CreatedBy):
+		return false
+	}
+	return true
+}
+
+func (s *SongRepo) GetSongText(_ context.Context, songID int) ([]string, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+
+	song, ok := s.db.songs[songID]
+	if !ok {
+		return nil, nil
+	}
+	return strings.Split(song.Text, "\n\n"), nil
+}
+
+func (s *SongRepo) CreateSong(ctx context.Context, song models.Song) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if s.duplicate(song) {
+		return models.ErrSongExists
+	}
+
+	s.db.lastSongID++
+	song.ID = s.db.lastSongID
+	if err := s.insert(ctx, models.AuditCreate, song); err != nil {
+		return err
+	}
+
+	logging.FromContext(ctx, s.logger).Infow("Song created successfully", "title", song.Title, "artist", song.Artist)
+	return nil
+}
+
+func (s *SongRepo) ChangeSong(ctx context.Context, song models.Song) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	before, ok := s.db.songs[song.ID]
+	if !ok {
+		return models.ErrSongNotFound
+	}
+	if s.duplicate(song) {
+		return models.ErrSongExists
+	}
+
+	after := before
+	after.Artist = song.Artist
+	after.Title = song.Title
+	after.ReleaseDate = song.ReleaseDate
+	after.Text = song.Text
+	after.SourceLink = song.SourceLink
+	after.UpdatedBy = song.UpdatedBy
+	if err := s.record(ctx, models.AuditUpdate, song.ID, &before, &after); err != nil {
+		return err
+	}
+	s.db.songs[song.ID] = after
+
+	logging.FromContext(ctx, s.logger).Infow("Song updated successfully", "songID", song.ID)
+	return nil
+}
+
+func (s *SongRepo) DeleteSong(ctx context.Context, songID int) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	before, ok := s.db.songs[songID]
+	if !ok {
+		return models.ErrSongNotFound
+	}
+	if err := s.record(ctx, models.AuditDelete, songID, &before, nil); err != nil {
+		return err
+	}
+	delete(s.db.songs, songID)
+
+	logging.FromContext(ctx, s.logger).Infow("Song deleted successfully", "songID", songID)
+	return nil
+}
+
+func (s *SongRepo) GetDeletedSong(_ context.Context, songID int) (models.Song, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+
+	for i := len(s.db.auditEvents) - 1; i >= 0; i-- {
+		if event := s.db.auditEvents[i]; event.SongID == songID && event.Action == models.AuditDelete {
+			var song models.Song
+			err := json.Unmarshal(event.Before, &song)
+			return song, err
+		}
+	}
+	return models.Song{}, models.ErrSongNotFound
+}
+
+func (s *SongRepo) RestoreSong(ctx context.Context, song models.Song) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if _, ok := s.db.songs[song.ID]; ok {
+		return models.ErrSongExists
+	}
+	if s.duplicate(song) {
+		return models.ErrSongExists
+	}
+	if err := s.insert(ctx, models.AuditRestore, song); err != nil {
+		return err
+	}
+
+	logging.FromContext(ctx, s.logger).Infow("Song restored successfully", "songID", song.ID)
+	return nil
+}
+
+// duplicate reports whether another song has the same artist and title,
+// mirroring the unique constraint of the songs table.
+func (s *SongRepo) duplicate(song models.Song) bool {
+	for _, other := range s.db.songs {
+		if other.ID != song.ID && other.Artist == song.Artist && other.Title == song.Title {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *SongRepo) insert(ctx context.Context, action string, song models.Song) error {
+	if err := s.record(ctx, action, song.ID, nil, &song); err != nil {
+		return err
+	}
+	s.db.songs[song.ID] = song
+	return nil
+}
+
+// record appends an audit event and its outbox event; the caller holds the
+// write lock.
+func (s *SongRepo) record(ctx context.Context, action string, songID int, before, after *models.Song) error {
+	event, err := audit.NewEvent(ctx, action, songID, before, after)
+	if err != nil {
+		return err
+	}
+	s.db.lastAuditID++
+	event.ID = s.db.lastAuditID
+	event.OccurredAt = time.Now()
+	s.db.auditEvents = append(s.db.auditEvents, event)
+
+	outboxEvent := models.NewOutboxEvent(event)
+	s.db.lastOutboxID++
+	outboxEvent.ID = s.db.lastOutboxID
+	s.db.outboxEvents = append(s.db.outboxEvents, outboxEvent)
+	return nil
+}
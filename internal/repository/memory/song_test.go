@@ -0,0 +1,18 @@
+package memory_test
+
+import (
+	"go.uber.org/zap"
+	"song-lib/internal/repository/memory"
+	"song-lib/internal/repository/repotest"
+	"testing"
+)
+
+func TestSongRepo(t *testing.T) {
+	repotest.SongRepository(t, func(t *testing.T) repotest.Repositories {
+		db := memory.NewDB()
+		return repotest.Repositories{
+			Songs: memory.NewSongRepo(db, zap.NewNop().Sugar()),
+			Users: memory.NewUserRepo(db, zap.NewNop().Sugar()),
+		}
+	})
+}
@@ -0,0 +1,26 @@
+package memory
+
+import "context"
+
+type txKey struct{}
+
+// TxManager runs units of work one at a time. Each repository call still
+// applies on its own, so a failed unit of work is not rolled back; that is
+// good enough for a store that is thrown away on exit.
+type TxManager struct {
+	db *DB
+}
+
+func NewTxManager(db *DB) *TxManager {
+	return &TxManager{db: db}
+}
+
+func (m *TxManager) WithTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if ctx.Value(txKey{}) != nil {
+		return fn(ctx)
+	}
+
+	m.db.txMu.Lock()
+	defer m.db.txMu.Unlock()
+	return fn(context.WithValue(ctx, txKey{}, true))
+}
@@ -0,0 +1,85 @@
+package memory
+
+import (
+	"context"
+	"go.uber.org/zap"
+	"slices"
+	"song-lib/internal/auth"
+	"song-lib/internal/models"
+	"time"
+)
+
+type UserRepo struct {
+	db     *DB
+	logger *zap.SugaredLogger
+}
+
+func NewUserRepo(db *DB, logger *zap.SugaredLogger) *UserRepo {
+	return &UserRepo{db: db, logger: logger}
+}
+
+func (u *UserRepo) UpsertUser(_ context.Context, user models.User) (models.User, error) {
+	u.db.mu.Lock()
+	defer u.db.mu.Unlock()
+
+	now := time.Now()
+	for id, existing := range u.db.users {
+		if existing.Subject != user.Subject {
+			continue
+		}
+		existing.Name = user.Name
+		if user.Role != "" {
+			existing.Role = user.Role
+		}
+		existing.LastSeenAt = now
+		u.db.users[id] = existing
+		return existing, nil
+	}
+
+	if user.Role == "" {
+		user.Role = auth.RoleViewer
+	}
+	u.db.lastUserID++
+	user.ID = u.db.lastUserID
+	user.CreatedAt = now
+	user.LastSeenAt = now
+	u.db.users[user.ID] = user
+	return user, nil
+}
+
+func (u *UserRepo) GetUser(_ context.Context, userID int) (models.User, error) {
+	u.db.mu.RLock()
+	defer u.db.mu.RUnlock()
+
+	user, ok := u.db.users[userID]
+	if !ok {
+		return models.User{}, models.ErrUserNotFound
+	}
+	return user, nil
+}
+
+func (u *UserRepo) ListUsers(_ context.Context) ([]models.User, error) {
+	u.db.mu.RLock()
+	defer u.db.mu.RUnlock()
+
+	users := make([]models.User, 0, len(u.db.users))
+	for _, user := range u.db.users {
+		users = append(users, user)
+	}
+	slices.SortFunc(users, func(a, b models.User) int { return a.ID - b.ID })
+	return users, nil
+}
+
+func (u *UserRepo) SetRole(_ context.Context, subject, role string) error {
+	u.db.mu.Lock()
+	defer u.db.mu.Unlock()
+
+	for id, user := range u.db.users {
+		if user.Subject == subject {
+			user.Role = role
+			u.db.users[id] = user
+			return nil
+		}
+	}
+	return models.ErrUserNotFound
+}
@@ -0,0 +1,236 @@
+package memory
+
+import (
+	"context"
+	"go.uber.org/zap"
+	"slices"
+	"song-lib/internal/models"
+	"time"
+)
+
+type WebhookRepo struct {
+	db     *DB
+	logger *zap.SugaredLogger
+}
+
+func NewWebhookRepo(db *DB, logger *zap.SugaredLogger) *WebhookRepo {
+	return &WebhookRepo{db: db, logger: logger}
+}
+
+// cloneWebhook keeps callers from changing the stored slices.
+func cloneWebhook(webhook models.Webhook) models.Webhook {
+	webhook.Events = slices.Clone(webhook.Events)
+	webhook.Artists = slices.Clone(webhook.Artists)
+	return webhook
+}
+
+func (w *WebhookRepo) CreateWebhook(_ context.Context, webhook models.Webhook) (models.Webhook, error) {
+	w.db.mu.Lock()
+	defer w.db.mu.Unlock()
+
+	w.db.lastWebhookID++
+	webhook.ID = w.db.lastWebhookID
+	webhook.CreatedAt = time.Now()
+	webhook.UpdatedAt = webhook.CreatedAt
+	w.db.webhooks[webhook.ID] = cloneWebhook(webhook)
+	return webhook, nil
+}
+
+func (w *WebhookRepo) GetWebhook(_ context.Context, webhookID int) (models.Webhook, error) {
+	w.db.mu.RLock()
+	defer w.db.mu.RUnlock()
+
+	webhook, ok := w.db.webhooks[webhookID]
+	if !ok {
+		return models.Webhook{}, models.ErrWebhookNotFound
+	}
+	return cloneWebhook(webhook), nil
+}
+
+func (w *WebhookRepo) ListWebhooks(_ context.Context) ([]models.Webhook, error) {
+	return w.listWebhooks(false), nil
+}
+
+func (w *WebhookRepo) ActiveWebhooks(_ context.Context) ([]models.Webhook, error) {
+	return w.listWebhooks(true), nil
+}
+
+func (w *WebhookRepo) listWebhooks(activeOnly bool) []models.Webhook {
+	w.db.mu.RLock()
+	defer w.db.mu.RUnlock()
+
+	webhooks := make([]models.Webhook, 0, len(w.db.webhooks))
+	for _, webhook := range w.db.webhooks {
+		if !activeOnly || webhook.Active {
+			webhooks = append(webhooks, cloneWebhook(webhook))
+		}
+	}
+	slices.SortFunc(webhooks, func(a, b models.Webhook) int { return a.ID - b.ID })
+	return webhooks
+}
+
+func (w *WebhookRepo) UpdateWebhook(_ context.Context, webhook models.Webhook) (models.Webhook, error) {
+	w.db.mu.Lock()
+	defer w.db.mu.Unlock()
+
+	stored, ok := w.db.webhooks[webhook.ID]
+	if !ok {
+		return models.Webhook{}, models.ErrWebhookNotFound
+	}
+	stored.Name = webhook.Name
+	stored.URL = webhook.URL
+	stored.Events = slices.Clone(webhook.Events)
+	stored.Artists = slices.Clone(webhook.Artists)
+	stored.Active = webhook.Active
+	stored.UpdatedAt = time.Now()
+	w.db.webhooks[webhook.ID] = stored
+	return cloneWebhook(stored), nil
+}
+
+func (w *WebhookRepo) DeleteWebhook(_ context.Context, webhookID int) error {
+	w.db.mu.Lock()
+	defer w.db.mu.Unlock()
+
+	if _, ok := w.db.webhooks[webhookID]; !ok {
+		return models.ErrWebhookNotFound
+	}
+	delete(w.db.webhooks, webhookID)
+	w.db.deliveries = slices.DeleteFunc(w.db.deliveries, func(delivery models.WebhookDelivery) bool {
+		return delivery.WebhookID == webhookID
+	})
+	return nil
+}
+
+func (w *WebhookRepo) ListDeliveries(_ context.Context, filter models.DeliveryFilter) ([]models.WebhookDelivery, error) {
+	w.db.mu.RLock()
+	defer w.db.mu.RUnlock()
+
+	var deliveries []models.WebhookDelivery
+	for i := len(w.db.deliveries) - 1; i >= 0; i-- {
+		delivery := w.db.deliveries[i]
+		if delivery.WebhookID != filter.WebhookID || (filter.Status != "" && delivery.Status != filter.Status) {
+			continue
+		}
+		deliveries = append(deliveries, delivery)
+	}
+
+	deliveries = deliveries[min(filter.Offset, uint64(len(deliveries))):]
+	if filter.Limit > 0 && uint64(len(deliveries)) > filter.Limit {
+		deliveries = deliveries[:filter.Limit]
+	}
+	return deliveries, nil
+}
+
+func (w *WebhookRepo) Redeliver(_ context.Context, webhookID int, deliveryID int64) (models.WebhookDelivery, error) {
+	w.db.mu.Lock()
+	defer w.db.mu.Unlock()
+
+	i := w.db.deliveryIndex(deliveryID)
+	if i < 0 || w.db.deliveries[i].WebhookID != webhookID {
+		return models.WebhookDelivery{}, models.ErrDeliveryNotFound
+	}
+
+	now := time.Now()
+	delivery := &w.db.deliveries[i]
+	delivery.Status = models.DeliveryPending
+	delivery.Attempts = 0
+	delivery.NextAttemptAt = &now
+	delivery.DeliveredAt = nil
+	return *delivery, nil
+}
+
+func (w *WebhookRepo) DeleteDeliveriesBefore(_ context.Context, before time.Time) (int64, error) {
+	w.db.mu.Lock()
+	defer w.db.mu.Unlock()
+
+	n := len(w.db.deliveries)
+	w.db.deliveries = slices.DeleteFunc(w.db.deliveries, func(delivery models.WebhookDelivery) bool {
+		return delivery.Status != models.DeliveryPending && delivery.CreatedAt.Before(before)
+	})
+	return int64(n - len(w.db.deliveries)), nil
+}
+
+func (w *WebhookRepo) Enqueue(_ context.Context, deliveries ...models.WebhookDelivery) error {
+	w.db.mu.Lock()
+	defer w.db.mu.Unlock()
+
+	now := time.Now()
+	for _, delivery := range deliveries {
+		queued := slices.ContainsFunc(w.db.deliveries, func(stored models.WebhookDelivery) bool {
+			return stored.WebhookID == delivery.WebhookID && stored.EventID == delivery.EventID
+		})
+		if queued {
+			continue
+		}
+
+		w.db.lastDeliveryID++
+		delivery.ID = w.db.lastDeliveryID
+		delivery.Status = models.DeliveryPending
+		delivery.Attempts = 0
+		delivery.NextAttemptAt = &now
+		delivery.CreatedAt = now
+		w.db.deliveries = append(w.db.deliveries, delivery)
+	}
+	return nil
+}
+
+func (w *WebhookRepo) Claim(_ context.Context, limit int, lease time.Duration) ([]models.WebhookDelivery, error) {
+	w.db.mu.Lock()
+	defer w.db.mu.Unlock()
+
+	now := time.Now()
+	leasedUntil := now.Add(lease)
+	var due []*models.WebhookDelivery
+	for i := range w.db.deliveries {
+		delivery := &w.db.deliveries[i]
+		if delivery.Status != models.DeliveryPending || delivery.NextAttemptAt.After(now) ||
+			!w.db.webhooks[delivery.WebhookID].Active {
+			continue
+		}
+		due = append(due, delivery)
+	}
+	slices.SortStableFunc(due, func(a, b *models.WebhookDelivery) int {
+		return a.NextAttemptAt.Compare(*b.NextAttemptAt)
+	})
+
+	claimed := make([]models.WebhookDelivery, 0, min(limit, len(due)))
+	for _, delivery := range due[:min(limit, len(due))] {
+		delivery.NextAttemptAt = &leasedUntil
+		claimed = append(claimed, *delivery)
+	}
+	return claimed, nil
+}
+
+func (w *WebhookRepo) RecordAttempt(_ context.Context, attempt models.DeliveryAttempt) error {
+	w.db.mu.Lock()
+	defer w.db.mu.Unlock()
+
+	i := w.db.deliveryIndex(attempt.DeliveryID)
+	if i < 0 {
+		// The webhook was deleted while its delivery was attempted.
+		return nil
+	}
+
+	delivery := &w.db.deliveries[i]
+	delivery.Status = attempt.Status
+	delivery.Attempts++
+	delivery.LastAttemptAt = &attempt.AttemptedAt
+	delivery.NextAttemptAt = attempt.NextAttemptAt
+	delivery.ResponseStatus = attempt.ResponseStatus
+	delivery.LastError = attempt.Error
+	if attempt.Status == models.DeliveryDelivered {
+		delivery.DeliveredAt = &attempt.AttemptedAt
+	}
+	return nil
+}
+
+// deliveryIndex finds a delivery by ID; deliveries are kept in ID order.
+func (db *DB) deliveryIndex(deliveryID int64) int {
+	i, found := slices.BinarySearchFunc(db.deliveries, deliveryID, func(delivery models.WebhookDelivery, id int64) int {
+		return int(delivery.ID - id)
+	})
+	if !found {
+		return -1
+	}
+	return i
+}
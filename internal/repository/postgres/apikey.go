@@ -0,0 +1,184 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+	"song-lib/internal/db"
+	"song-lib/internal/logging"
+	"song-lib/internal/models"
+	"song-lib/internal/tracing"
+	"strings"
+	"time"
+)
+
+type APIKeyRepo struct {
+	db     *sqlx.DB
+	logger *zap.SugaredLogger
+}
+
+func NewAPIKeyRepo(db *sqlx.DB, logger *zap.SugaredLogger) *APIKeyRepo {
+	return &APIKeyRepo{db: db, logger: logger}
+}
+
+// conn joins the transaction of a unit of work when ctx carries one.
+func (a *APIKeyRepo) conn(ctx context.Context) db.Queryer {
+	return db.Conn(ctx, a.db)
+}
+
+type apiKeyRow struct {
+	ID         int            `db:"id"`
+	Name       string         `db:"name"`
+	Prefix     string         `db:"prefix"`
+	Scopes     pq.StringArray `db:"scopes"`
+	CreatedAt  time.Time      `db:"created_at"`
+	LastUsedAt *time.Time     `db:"last_used_at"`
+	RevokedAt  *time.Time     `db:"revoked_at"`
+}
+
+func (r apiKeyRow) model() models.APIKey {
+	return models.APIKey{
+		ID:         r.ID,
+		Name:       r.Name,
+		Prefix:     r.Prefix,
+		Scopes:     r.Scopes,
+		CreatedAt:  r.CreatedAt,
+		LastUsedAt: r.LastUsedAt,
+		RevokedAt:  r.RevokedAt,
+	}
+}
+
+var apiKeyColumns = []string{"id", "name", "prefix", "scopes", "created_at", "last_used_at", "revoked_at"}
+
+func (a *APIKeyRepo) CreateKey(ctx context.Context, key models.APIKey, hash string) (models.APIKey, error) {
+	logger := logging.FromContext(ctx, a.logger)
+
+	query, args, err := sq.Insert("api_keys").
+		Columns("name", "prefix", "key_hash", "scopes").
+		Values(key.Name, key.Prefix, hash, pq.StringArray(key.Scopes)).
+		Suffix("RETURNING " + strings.Join(apiKeyColumns, ", ")).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		logger.Errorw("Failed to build SQL query for CreateKey", "error", err)
+		return models.APIKey{}, err
+	}
+
+	ctx, cancel := db.WithQueryTimeout(ctx)
+	defer cancel()
+
+	ctx, span := tracing.StartQuery(ctx, "APIKeyRepo.CreateKey", query)
+	defer span.End()
+
+	var row apiKeyRow
+	if err := a.conn(ctx).QueryRowxContext(ctx, query, args...).StructScan(&row); err != nil {
+		tracing.RecordError(span, err)
+		logger.Errorw("Failed to execute CreateKey query", "error", err)
+		return models.APIKey{}, err
+	}
+	return row.model(), nil
+}
+
+func (a *APIKeyRepo) ListKeys(ctx context.Context) ([]models.APIKey, error) {
+	logger := logging.FromContext(ctx, a.logger)
+
+	query, args, err := sq.Select(apiKeyColumns...).
+		From("api_keys").
+		OrderBy("id").
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		logger.Errorw("Failed to build SQL query for ListKeys", "error", err)
+		return nil, err
+	}
+
+	ctx, cancel := db.WithQueryTimeout(ctx)
+	defer cancel()
+
+	ctx, span := tracing.StartQuery(ctx, "APIKeyRepo.ListKeys", query)
+	defer span.End()
+
+	var rows []apiKeyRow
+	if err := a.conn(ctx).SelectContext(ctx, &rows, query, args...); err != nil {
+		tracing.RecordError(span, err)
+		logger.Errorw("Failed to execute ListKeys query", "error", err)
+		return nil, err
+	}
+
+	keys := make([]models.APIKey, 0, len(rows))
+	for _, row := range rows {
+		keys = append(keys, row.model())
+	}
+	return keys, nil
+}
+
+func (a *APIKeyRepo) RevokeKey(ctx context.Context, keyID int) error {
+	logger := logging.FromContext(ctx, a.logger)
+
+	query, args, err := sq.Update("api_keys").
+		Set("revoked_at", sq.Expr("now()")).
+		Where(sq.Eq{"id": keyID, "revoked_at": nil}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		logger.Errorw("Failed to build SQL query for RevokeKey", "error", err)
+		return err
+	}
+
+	ctx, cancel := db.WithQueryTimeout(ctx)
+	defer cancel()
+
+	ctx, span := tracing.StartQuery(ctx, "APIKeyRepo.RevokeKey", query)
+	defer span.End()
+
+	res, err := a.conn(ctx).ExecContext(ctx, query, args...)
+	if err != nil {
+		tracing.RecordError(span, err)
+		logger.Errorw("Failed to execute RevokeKey query", "error", err)
+		return err
+	}
+	if affected, err := res.RowsAffected(); err == nil && affected == 0 {
+		return models.ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// authenticateQuery looks up an active key and bumps last_used_at in the same
+// round trip, at most once a minute per key to keep writes off the hot path.
+const authenticateQuery = `
+WITH key AS (
+    SELECT id, name, prefix, scopes, created_at, last_used_at, revoked_at
+    FROM api_keys
+    WHERE key_hash = $1 AND revoked_at IS NULL
+), touch AS (
+    UPDATE api_keys SET last_used_at = now()
+    WHERE id = (SELECT id FROM key)
+      AND (last_used_at IS NULL OR last_used_at < now() - interval '1 minute')
+)
+SELECT id, name, prefix, scopes, created_at, last_used_at, revoked_at FROM key`
+
+func (a *APIKeyRepo) Authenticate(ctx context.Context, hash string) (models.APIKey, error) {
+	logger := logging.FromContext(ctx, a.logger)
+
+	ctx, cancel := db.WithQueryTimeout(ctx)
+	defer cancel()
+
+	ctx, span := tracing.StartQuery(ctx, "APIKeyRepo.Authenticate", authenticateQuery)
+	defer span.End()
+
+	var row apiKeyRow
+	err := a.conn(ctx).QueryRowxContext(ctx, authenticateQuery, hash).StructScan(&row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.APIKey{}, models.ErrAPIKeyNotFound
+		}
+		tracing.RecordError(span, err)
+		logger.Errorw("Failed to execute Authenticate query", "error", err)
+		return models.APIKey{}, err
+	}
+	return row.model(), nil
+}
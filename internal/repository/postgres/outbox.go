@@ -0,0 +1,202 @@
+package postgres
+
+import (
+	"context"
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+	"song-lib/internal/db"
+	"song-lib/internal/logging"
+	"song-lib/internal/models"
+	"song-lib/internal/tracing"
+	"time"
+)
+
+// outboxLockID keys the advisory lock held by the replica relaying the
+// outbox.
+const outboxLockID int64 = 0x6f757462 // "outb"
+
+type OutboxRepo struct {
+	db     *sqlx.DB
+	logger *zap.SugaredLogger
+}
+
+func NewOutboxRepo(db *sqlx.DB, logger *zap.SugaredLogger) *OutboxRepo {
+	return &OutboxRepo{db: db, logger: logger}
+}
+
+type outboxEventRow struct {
+	ID            int64      `db:"id"`
+	OccurredAt    time.Time  `db:"occurred_at"`
+	Type          string     `db:"type"`
+	SongID        int        `db:"song_id"`
+	Song          []byte     `db:"song"`
+	Attempts      int        `db:"attempts"`
+	LastError     *string    `db:"last_error"`
+	NextAttemptAt *time.Time `db:"next_attempt_at"`
+	DeadAt        *time.Time `db:"dead_at"`
+}
+
+func (r outboxEventRow) model() models.OutboxEvent {
+	event := models.OutboxEvent{
+		ID:            r.ID,
+		Type:          r.Type,
+		SongID:        r.SongID,
+		OccurredAt:    r.OccurredAt,
+		Song:          r.Song,
+		Attempts:      r.Attempts,
+		NextAttemptAt: r.NextAttemptAt,
+		DeadAt:        r.DeadAt,
+	}
+	if r.LastError != nil {
+		event.LastError = *r.LastError
+	}
+	return event
+}
+
+// insertOutboxEvent is called by SongRepo inside the transaction of the
+// mutation it announces.
+func insertOutboxEvent(ctx context.Context, tx *sqlx.Tx, event models.OutboxEvent) error {
+	query, args, err := sq.Insert("outbox_events").
+		Columns("type", "song_id", "song").
+		Values(event.Type, event.SongID, jsonb(event.Song)).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	ctx, span := tracing.StartQuery(ctx, "OutboxRepo.InsertEvent", query)
+	defer span.End()
+
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		tracing.RecordError(span, err)
+		return err
+	}
+	return nil
+}
+
+// Lock takes a session-level advisory lock on a connection of its own, held
+// until unlock.
+func (o *OutboxRepo) Lock(ctx context.Context) (func(), bool, error) {
+	conn, err := o.db.Conn(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var acquired bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", outboxLockID).Scan(&acquired); err != nil {
+		_ = conn.Close()
+		return nil, false, err
+	}
+	if !acquired {
+		_ = conn.Close()
+		return nil, false, nil
+	}
+
+	return func() {
+		_, _ = conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", outboxLockID)
+		_ = conn.Close()
+	}, true, nil
+}
+
+func (o *OutboxRepo) Pending(ctx context.Context, limit int) ([]models.OutboxEvent, error) {
+	logger := logging.FromContext(ctx, o.logger)
+
+	// An event waits while an earlier live event of its song is not due, so
+	// that a failing song keeps its order without holding up the others.
+	dueAt := time.Now()
+	query, args, err := sq.Select("id", "occurred_at", "type", "song_id", "song", "attempts", "last_error", "next_attempt_at", "dead_at").
+		From("outbox_events e").
+		Where(sq.Eq{"dead_at": nil}).
+		Where(sq.Or{sq.Eq{"next_attempt_at": nil}, sq.LtOrEq{"next_attempt_at": dueAt}}).
+		Where(`NOT EXISTS (SELECT 1 FROM outbox_events b
+			WHERE b.song_id = e.song_id AND b.id < e.id AND b.dead_at IS NULL AND b.next_attempt_at > ?)`, dueAt).
+		OrderBy("id").
+		Limit(uint64(limit)).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		logger.Errorw("Failed to build SQL query for Pending", "error", err)
+		return nil, err
+	}
+
+	ctx, cancel := db.WithQueryTimeout(ctx)
+	defer cancel()
+
+	ctx, span := tracing.StartQuery(ctx, "OutboxRepo.Pending", query)
+	defer span.End()
+
+	var rows []outboxEventRow
+	if err := o.db.SelectContext(ctx, &rows, query, args...); err != nil {
+		tracing.RecordError(span, err)
+		logger.Errorw("Failed to execute Pending query", "error", err)
+		return nil, err
+	}
+
+	events := make([]models.OutboxEvent, 0, len(rows))
+	for _, row := range rows {
+		events = append(events, row.model())
+	}
+	return events, nil
+}
+
+func (o *OutboxRepo) MarkPublished(ctx context.Context, ids ...int64) error {
+	logger := logging.FromContext(ctx, o.logger)
+
+	query, args, err := sq.Delete("outbox_events").
+		Where(sq.Eq{"id": ids}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		logger.Errorw("Failed to build SQL query for MarkPublished", "error", err)
+		return err
+	}
+
+	ctx, cancel := db.WithQueryTimeout(ctx)
+	defer cancel()
+
+	ctx, span := tracing.StartQuery(ctx, "OutboxRepo.MarkPublished", query)
+	defer span.End()
+
+	if _, err := o.db.ExecContext(ctx, query, args...); err != nil {
+		tracing.RecordError(span, err)
+		logger.Errorw("Failed to execute MarkPublished query", "error", err)
+		return err
+	}
+	return nil
+}
+
+func (o *OutboxRepo) MarkFailed(ctx context.Context, id int64, reason string, nextAttemptAt *time.Time) error {
+	logger := logging.FromContext(ctx, o.logger)
+
+	builder := sq.Update("outbox_events").
+		Set("attempts", sq.Expr("attempts + 1")).
+		Set("last_error", reason)
+	if nextAttemptAt != nil {
+		builder = builder.Set("next_attempt_at", nextAttemptAt.UTC())
+	} else {
+		builder = builder.Set("dead_at", time.Now())
+	}
+	query, args, err := builder.
+		Where(sq.Eq{"id": id}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		logger.Errorw("Failed to build SQL query for MarkFailed", "error", err)
+		return err
+	}
+
+	ctx, cancel := db.WithQueryTimeout(ctx)
+	defer cancel()
+
+	ctx, span := tracing.StartQuery(ctx, "OutboxRepo.MarkFailed", query)
+	defer span.End()
+
+	if _, err := o.db.ExecContext(ctx, query, args...); err != nil {
+		tracing.RecordError(span, err)
+		logger.Errorw("Failed to execute MarkFailed query", "error", err)
+		return err
+	}
+	return nil
+}
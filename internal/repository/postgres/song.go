@@ -3,51 +3,84 @@ package postgres
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	sq "github.com/Masterminds/squirrel"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 	"go.uber.org/zap"
+	"song-lib/internal/audit"
+	"song-lib/internal/db"
+	"song-lib/internal/logging"
 	"song-lib/internal/models"
+	"song-lib/internal/tracing"
 	"strings"
 )
 
 type SongRepo struct {
-	db     *sqlx.DB
-	logger *zap.SugaredLogger
+	db       *sqlx.DB
+	replicas *db.ReplicaSet
+	logger   *zap.SugaredLogger
 }
 
-func NewSongRepo(db *sqlx.DB, logger *zap.SugaredLogger) *SongRepo {
-	return &SongRepo{db: db, logger: logger}
+// NewSongRepo serves lookups and searches from replicas when there are any;
+// replicas may be nil.
+func NewSongRepo(db *sqlx.DB, replicas *db.ReplicaSet, logger *zap.SugaredLogger) *SongRepo {
+	return &SongRepo{db: db, replicas: replicas, logger: logger}
 }
 
+// conn joins the transaction of a unit of work when ctx carries one.
+func (s *SongRepo) conn(ctx context.Context) db.Queryer {
+	return db.Conn(ctx, s.db)
+}
+
+// readConn is conn for read-only queries, which may go to a replica.
+func (s *SongRepo) readConn(ctx context.Context) db.Queryer {
+	return db.ReadConn(ctx, s.db, s.replicas)
+}
+
+var songColumns = []string{"id", "artist", "title", "release_date", "text", "source_link", "created_by", "updated_by"}
+
 func (s *SongRepo) Exist(ctx context.Context, songID int) bool {
+	logger := logging.FromContext(ctx, s.logger)
+
 	query, args, err := sq.Select("COUNT(*) > 0").
 		From("songs").
 		Where(sq.Eq{"id": songID}).
 		PlaceholderFormat(sq.Dollar).
 		ToSql()
 	if err != nil {
-		s.logger.Errorw("Failed to build SQL query for Exist", "error", err)
+		logger.Errorw("Failed to build SQL query for Exist", "error", err)
 		return false
 	}
 
+	ctx, cancel := db.WithQueryTimeout(ctx)
+	defer cancel()
+
+	ctx, span := tracing.StartQuery(ctx, "SongRepo.Exist", query)
+	defer span.End()
+
 	var exists bool
-	err = s.db.QueryRowContext(ctx, query, args...).Scan(&exists)
+	err = s.readConn(ctx).QueryRowContext(ctx, query, args...).Scan(&exists)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return false
 		}
-		s.logger.Errorw("DB error in Exist", "songID", songID, "error", err)
+		tracing.RecordError(span, err)
+		logger.Errorw("DB error in Exist", "songID", songID, "error", err)
 		return false
 	}
 
-	s.logger.Debugw("Exist check", "songID", songID, "exists", exists)
+	logger.Debugw("Exist check", "songID", songID, "exists", exists)
 	return exists
 }
 
 func (s *SongRepo) GetSongs(ctx context.Context, filter models.SongFilter) ([]models.Song, error) {
-	query := sq.Select("id", "artist", "title", "release_date", "text", "source_link").
-		From("songs")
+	logger := logging.FromContext(ctx, s.logger)
+
+	query := sq.Select(songColumns...).
+		From("songs").
+		OrderBy("id")
 
 	if filter.Artist != "" {
 		query = query.Where(sq.Like{"artist": "%" + filter.Artist + "%"})
@@ -64,6 +97,9 @@ func (s *SongRepo) GetSongs(ctx context.Context, filter models.SongFilter) ([]mo
 	if filter.SourceLink != "" {
 		query = query.Where(sq.Eq{"source_link": filter.SourceLink})
 	}
+	if filter.CreatedBy != 0 {
+		query = query.Where(sq.Eq{"created_by": filter.CreatedBy})
+	}
 
 	if filter.Limit > 0 {
 		query = query.Limit(filter.Limit)
@@ -74,137 +110,394 @@ func (s *SongRepo) GetSongs(ctx context.Context, filter models.SongFilter) ([]mo
 
 	sqlQuery, args, err := query.PlaceholderFormat(sq.Dollar).ToSql()
 	if err != nil {
-		s.logger.Errorw("Failed to build SQL query for GetSongs", "error", err)
+		logger.Errorw("Failed to build SQL query for GetSongs", "error", err)
 		return nil, err
 	}
 
-	s.logger.Debugw("Executing GetSongs query", "query", sqlQuery, "args", args)
+	logger.Debugw("Executing GetSongs query", "query", sqlQuery, "args", args)
+
+	ctx, cancel := db.WithQueryTimeout(ctx)
+	defer cancel()
 
-	rows, err := s.db.QueryContext(ctx, sqlQuery, args...)
+	ctx, span := tracing.StartQuery(ctx, "SongRepo.GetSongs", sqlQuery)
+	defer span.End()
+
+	rows, err := s.readConn(ctx).QueryContext(ctx, sqlQuery, args...)
 	if err != nil {
-		s.logger.Errorw("Failed to execute GetSongs query", "error", err)
+		tracing.RecordError(span, err)
+		logger.Errorw("Failed to execute GetSongs query", "error", err)
 		return nil, err
 	}
 	defer func(rows *sql.Rows) {
 		err := rows.Close()
 		if err != nil {
-			s.logger.Warnw("Failed to close rows", "error", err)
+			logger.Warnw("Failed to close rows", "error", err)
 		}
 	}(rows)
 
 	var songs []models.Song
 	for rows.Next() {
 		var song models.Song
-		if err := rows.Scan(&song.ID, &song.Artist, &song.Title, &song.ReleaseDate, &song.Text, &song.SourceLink); err != nil {
-			s.logger.Errorw("Failed to scan row in GetSongs", "error", err)
+		if err := rows.Scan(&song.ID, &song.Artist, &song.Title, &song.ReleaseDate, &song.Text, &song.SourceLink, &song.CreatedBy, &song.UpdatedBy); err != nil {
+			tracing.RecordError(span, err)
+			logger.Errorw("Failed to scan row in GetSongs", "error", err)
 			return nil, err
 		}
 		songs = append(songs, song)
 	}
 
 	if err := rows.Err(); err != nil {
-		s.logger.Errorw("Rows iteration error in GetSongs", "error", err)
+		tracing.RecordError(span, err)
+		logger.Errorw("Rows iteration error in GetSongs", "error", err)
 		return nil, err
 	}
 
-	s.logger.Infow("Successfully retrieved songs", "count", len(songs))
+	logger.Infow("Successfully retrieved songs", "count", len(songs))
 	return songs, nil
 }
 
+func (s *SongRepo) GetSong(ctx context.Context, songID int) (models.Song, error) {
+	logger := logging.FromContext(ctx, s.logger)
+
+	query, args, err := sq.Select(songColumns...).
+		From("songs").
+		Where(sq.Eq{"id": songID}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		logger.Errorw("Failed to build SQL query for GetSong", "error", err)
+		return models.Song{}, err
+	}
+
+	ctx, cancel := db.WithQueryTimeout(ctx)
+	defer cancel()
+
+	ctx, span := tracing.StartQuery(ctx, "SongRepo.GetSong", query)
+	defer span.End()
+
+	var song models.Song
+	if err := s.readConn(ctx).GetContext(ctx, &song, query, args...); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Song{}, models.ErrSongNotFound
+		}
+		tracing.RecordError(span, err)
+		logger.Errorw("Failed to fetch song", "songID", songID, "error", err)
+		return models.Song{}, err
+	}
+	return song, nil
+}
+
 func (s *SongRepo) GetSongText(ctx context.Context, songID int) ([]string, error) {
+	logger := logging.FromContext(ctx, s.logger)
+
 	query, args, err := sq.Select("text").
 		From("songs").
 		Where(sq.Eq{"id": songID}).
 		PlaceholderFormat(sq.Dollar).
 		ToSql()
 	if err != nil {
-		s.logger.Errorw("Failed to build SQL query for GetSongText", "error", err)
+		logger.Errorw("Failed to build SQL query for GetSongText", "error", err)
 		return nil, err
 	}
 
-	s.logger.Debugw("Executing GetSongText query", "query", query, "args", args)
+	logger.Debugw("Executing GetSongText query", "query", query, "args", args)
+
+	ctx, cancel := db.WithQueryTimeout(ctx)
+	defer cancel()
+
+	ctx, span := tracing.StartQuery(ctx, "SongRepo.GetSongText", query)
+	defer span.End()
 
 	var text string
-	err = s.db.QueryRowContext(ctx, query, args...).Scan(&text)
+	err = s.readConn(ctx).QueryRowContext(ctx, query, args...).Scan(&text)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			s.logger.Warnw("Song text not found", "songID", songID)
+			logger.Warnw("Song text not found", "songID", songID)
 			return nil, nil
 		}
-		s.logger.Errorw("Failed to fetch song text", "songID", songID, "error", err)
+		tracing.RecordError(span, err)
+		logger.Errorw("Failed to fetch song text", "songID", songID, "error", err)
 		return nil, err
 	}
 
 	textParts := strings.Split(text, "\n\n")
-	s.logger.Infow("Successfully retrieved song text", "songID", songID, "parts", len(textParts))
+	logger.Infow("Successfully retrieved song text", "songID", songID, "parts", len(textParts))
 	return textParts, nil
 }
 
 func (s *SongRepo) CreateSong(ctx context.Context, song models.Song) error {
+	logger := logging.FromContext(ctx, s.logger)
+
 	query, args, err := sq.Insert("songs").
-		Columns("artist", "title", "release_date", "text", "source_link").
-		Values(song.Artist, song.Title, song.ReleaseDate, song.Text, song.SourceLink).
+		Columns("artist", "title", "release_date", "text", "source_link", "created_by", "updated_by").
+		Values(song.Artist, song.Title, song.ReleaseDate, song.Text, song.SourceLink, song.CreatedBy, song.UpdatedBy).
+		Suffix("RETURNING " + strings.Join(songColumns, ", ")).
 		PlaceholderFormat(sq.Dollar).
 		ToSql()
 	if err != nil {
-		s.logger.Errorw("Failed to build SQL query for CreateSong", "error", err)
+		logger.Errorw("Failed to build SQL query for CreateSong", "error", err)
 		return err
 	}
 
-	s.logger.Infow("Executing CreateSong query", "query", query, "args", args)
-	_, err = s.db.ExecContext(ctx, query, args...)
+	logger.Infow("Executing CreateSong query", "query", query, "args", args)
+
+	ctx, cancel := db.WithQueryTimeout(ctx)
+	defer cancel()
+
+	ctx, span := tracing.StartQuery(ctx, "SongRepo.CreateSong", query)
+	defer span.End()
+
+	err = s.inTx(ctx, func(tx *sqlx.Tx) error {
+		var created models.Song
+		if err := tx.QueryRowxContext(ctx, query, args...).StructScan(&created); err != nil {
+			return err
+		}
+		return s.audit(ctx, tx, models.AuditCreate, created.ID, nil, &created)
+	})
 	if err != nil {
-		s.logger.Errorw("Failed to execute CreateSong query", "error", err)
+		if expected, ok := songError(err); ok {
+			return expected
+		}
+		tracing.RecordError(span, err)
+		logger.Errorw("Failed to execute CreateSong query", "error", err)
 		return err
 	}
 
-	s.logger.Infow("Song created successfully", "title", song.Title, "artist", song.Artist)
+	logger.Infow("Song created successfully", "title", song.Title, "artist", song.Artist)
 	return nil
 }
 
 func (s *SongRepo) ChangeSong(ctx context.Context, song models.Song) error {
+	logger := logging.FromContext(ctx, s.logger)
+
 	query, args, err := sq.Update("songs").
 		Set("artist", song.Artist).
 		Set("title", song.Title).
 		Set("release_date", song.ReleaseDate).
 		Set("text", song.Text).
 		Set("source_link", song.SourceLink).
+		Set("updated_by", song.UpdatedBy).
 		Where(sq.Eq{"id": song.ID}).
+		Suffix("RETURNING " + strings.Join(songColumns, ", ")).
 		PlaceholderFormat(sq.Dollar).
 		ToSql()
 	if err != nil {
-		s.logger.Errorw("Failed to build SQL query for ChangeSong", "error", err)
+		logger.Errorw("Failed to build SQL query for ChangeSong", "error", err)
 		return err
 	}
 
-	s.logger.Infow("Executing ChangeSong query", "query", query, "args", args)
-	_, err = s.db.ExecContext(ctx, query, args...)
+	logger.Infow("Executing ChangeSong query", "query", query, "args", args)
+
+	ctx, cancel := db.WithQueryTimeout(ctx)
+	defer cancel()
+
+	ctx, span := tracing.StartQuery(ctx, "SongRepo.ChangeSong", query)
+	defer span.End()
+
+	err = s.inTx(ctx, func(tx *sqlx.Tx) error {
+		before, err := s.lockSong(ctx, tx, song.ID)
+		if err != nil {
+			return err
+		}
+
+		var after models.Song
+		if err := tx.QueryRowxContext(ctx, query, args...).StructScan(&after); err != nil {
+			return err
+		}
+		return s.audit(ctx, tx, models.AuditUpdate, song.ID, &before, &after)
+	})
 	if err != nil {
-		s.logger.Errorw("Failed to execute ChangeSong query", "error", err)
+		if expected, ok := songError(err); ok {
+			return expected
+		}
+		tracing.RecordError(span, err)
+		logger.Errorw("Failed to execute ChangeSong query", "error", err)
 		return err
 	}
 
-	s.logger.Infow("Song updated successfully", "songID", song.ID)
+	logger.Infow("Song updated successfully", "songID", song.ID)
 	return nil
 }
 
 func (s *SongRepo) DeleteSong(ctx context.Context, songID int) error {
+	logger := logging.FromContext(ctx, s.logger)
+
 	query, args, err := sq.Delete("songs").
 		Where(sq.Eq{"id": songID}).
 		PlaceholderFormat(sq.Dollar).
 		ToSql()
 	if err != nil {
-		s.logger.Errorw("Failed to build SQL query for DeleteSong", "error", err)
+		logger.Errorw("Failed to build SQL query for DeleteSong", "error", err)
 		return err
 	}
 
-	s.logger.Infow("Executing DeleteSong query", "query", query, "args", args)
-	_, err = s.db.ExecContext(ctx, query, args...)
+	logger.Infow("Executing DeleteSong query", "query", query, "args", args)
+
+	ctx, cancel := db.WithQueryTimeout(ctx)
+	defer cancel()
+
+	ctx, span := tracing.StartQuery(ctx, "SongRepo.DeleteSong", query)
+	defer span.End()
+
+	err = s.inTx(ctx, func(tx *sqlx.Tx) error {
+		before, err := s.lockSong(ctx, tx, songID)
+		if err != nil {
+			return err
+		}
+
+		res, err := tx.ExecContext(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+		if affected, err := res.RowsAffected(); err == nil && affected == 0 {
+			return models.ErrSongNotFound
+		}
+		return s.audit(ctx, tx, models.AuditDelete, songID, &before, nil)
+	})
 	if err != nil {
-		s.logger.Errorw("Failed to execute DeleteSong query", "error", err)
+		if expected, ok := songError(err); ok {
+			return expected
+		}
+		tracing.RecordError(span, err)
+		logger.Errorw("Failed to execute DeleteSong query", "error", err)
 		return err
 	}
 
-	s.logger.Infow("Song deleted successfully", "songID", songID)
+	logger.Infow("Song deleted successfully", "songID", songID)
 	return nil
 }
+
+// GetDeletedSong returns the snapshot taken when the song was last deleted.
+func (s *SongRepo) GetDeletedSong(ctx context.Context, songID int) (models.Song, error) {
+	logger := logging.FromContext(ctx, s.logger)
+
+	query, args, err := sq.Select("before").
+		From("audit_events").
+		Where(sq.Eq{"song_id": songID, "action": models.AuditDelete}).
+		OrderBy("id DESC").
+		Limit(1).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		logger.Errorw("Failed to build SQL query for GetDeletedSong", "error", err)
+		return models.Song{}, err
+	}
+
+	ctx, cancel := db.WithQueryTimeout(ctx)
+	defer cancel()
+
+	ctx, span := tracing.StartQuery(ctx, "SongRepo.GetDeletedSong", query)
+	defer span.End()
+
+	var snapshot []byte
+	if err := s.conn(ctx).QueryRowContext(ctx, query, args...).Scan(&snapshot); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Song{}, models.ErrSongNotFound
+		}
+		tracing.RecordError(span, err)
+		logger.Errorw("Failed to fetch deleted song", "songID", songID, "error", err)
+		return models.Song{}, err
+	}
+
+	var song models.Song
+	if err := json.Unmarshal(snapshot, &song); err != nil {
+		logger.Errorw("Failed to decode deleted song snapshot", "songID", songID, "error", err)
+		return models.Song{}, err
+	}
+	return song, nil
+}
+
+// RestoreSong re-inserts a deleted song under its original ID.
+func (s *SongRepo) RestoreSong(ctx context.Context, song models.Song) error {
+	logger := logging.FromContext(ctx, s.logger)
+
+	query, args, err := sq.Insert("songs").
+		Columns(songColumns...).
+		Values(song.ID, song.Artist, song.Title, song.ReleaseDate, song.Text, song.SourceLink, song.CreatedBy, song.UpdatedBy).
+		Suffix("RETURNING " + strings.Join(songColumns, ", ")).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		logger.Errorw("Failed to build SQL query for RestoreSong", "error", err)
+		return err
+	}
+
+	ctx, cancel := db.WithQueryTimeout(ctx)
+	defer cancel()
+
+	ctx, span := tracing.StartQuery(ctx, "SongRepo.RestoreSong", query)
+	defer span.End()
+
+	err = s.inTx(ctx, func(tx *sqlx.Tx) error {
+		var restored models.Song
+		if err := tx.QueryRowxContext(ctx, query, args...).StructScan(&restored); err != nil {
+			return err
+		}
+		return s.audit(ctx, tx, models.AuditRestore, song.ID, nil, &restored)
+	})
+	if err != nil {
+		if expected, ok := songError(err); ok {
+			return expected
+		}
+		tracing.RecordError(span, err)
+		logger.Errorw("Failed to execute RestoreSong query", "songID", song.ID, "error", err)
+		return err
+	}
+
+	logger.Infow("Song restored successfully", "songID", song.ID)
+	return nil
+}
+
+// lockSong reads the current row for the audit snapshot and locks it until
+// the transaction ends.
+func (s *SongRepo) lockSong(ctx context.Context, tx *sqlx.Tx, songID int) (models.Song, error) {
+	query, args, err := sq.Select(songColumns...).
+		From("songs").
+		Where(sq.Eq{"id": songID}).
+		Suffix("FOR UPDATE").
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return models.Song{}, err
+	}
+
+	var song models.Song
+	if err := tx.GetContext(ctx, &song, query, args...); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Song{}, models.ErrSongNotFound
+		}
+		return models.Song{}, err
+	}
+	return song, nil
+}
+
+// audit records the mutation and queues it in the outbox for the relay.
+func (s *SongRepo) audit(ctx context.Context, tx *sqlx.Tx, action string, songID int, before, after *models.Song) error {
+	event, err := audit.NewEvent(ctx, action, songID, before, after)
+	if err != nil {
+		return err
+	}
+	if err := insertAuditEvent(ctx, tx, event); err != nil {
+		return err
+	}
+	return insertOutboxEvent(ctx, tx, models.NewOutboxEvent(event))
+}
+
+// inTx keeps a mutation, its audit event and its outbox event atomic, inside
+// the caller's unit of work when there is one.
+func (s *SongRepo) inTx(ctx context.Context, fn func(tx *sqlx.Tx) error) error {
+	return db.RunTx(ctx, s.db, db.TxOptions{}, func(ctx context.Context) error {
+		tx, _ := db.TxFromContext(ctx)
+		return fn(tx)
+	})
+}
+
+// songError maps a unique violation to ErrSongExists and reports whether err
+// is an expected outcome of a mutation rather than a failed query.
+func songError(err error) (error, bool) {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return models.ErrSongExists, true
+	}
+	return err, errors.Is(err, models.ErrSongNotFound)
+}
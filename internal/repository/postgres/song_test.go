@@ -0,0 +1,62 @@
+package postgres_test
+
+import (
+	"context"
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+	"os"
+	"song-lib/internal/db"
+	"song-lib/internal/repository/postgres"
+	"song-lib/internal/repository/repotest"
+	"testing"
+)
+
+// dsnEnv names a lib/pq connection string of a disposable database; the
+// tests migrate it and truncate its tables.
+const dsnEnv = "SONGLIB_TEST_POSTGRES_DSN"
+
+func TestSongRepo(t *testing.T) {
+	pgDB := openDB(t)
+
+	repotest.SongRepository(t, func(t *testing.T) repotest.Repositories {
+		truncate(t, pgDB)
+		return repotest.Repositories{
+			Songs: postgres.NewSongRepo(pgDB, nil, zap.NewNop().Sugar()),
+			Users: postgres.NewUserRepo(pgDB, zap.NewNop().Sugar()),
+		}
+	})
+}
+
+func openDB(t *testing.T) *sqlx.DB {
+	t.Helper()
+
+	dsn := os.Getenv(dsnEnv)
+	if dsn == "" {
+		t.Skipf("%s is not set", dsnEnv)
+	}
+	ctx := context.Background()
+
+	pgDB, err := sqlx.Connect("postgres", dsn)
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	t.Cleanup(func() { _ = pgDB.Close() })
+
+	migrator, err := db.NewMigrator(ctx, pgDB)
+	if err != nil {
+		t.Fatalf("NewMigrator: %v", err)
+	}
+	defer migrator.Close()
+	if err := migrator.Up(ctx); err != nil {
+		t.Fatalf("migrate up: %v", err)
+	}
+	return pgDB
+}
+
+func truncate(t *testing.T, pgDB *sqlx.DB) {
+	t.Helper()
+
+	if _, err := pgDB.Exec("TRUNCATE songs, users RESTART IDENTITY CASCADE"); err != nil {
+		t.Fatalf("truncate: %v", err)
+	}
+}
@@ -0,0 +1,36 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"song-lib/internal/db"
+)
+
+type TxManager struct {
+	db   *sqlx.DB
+	opts db.TxOptions
+}
+
+func NewTxManager(sqlDB *sqlx.DB, isolation sql.IsolationLevel, retries int) *TxManager {
+	return &TxManager{
+		db:   sqlDB,
+		opts: db.TxOptions{Isolation: isolation, Retries: retries, Retryable: isRetryable},
+	}
+}
+
+func (m *TxManager) WithTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return db.RunTx(ctx, m.db, m.opts, fn)
+}
+
+// isRetryable matches serialization failures and deadlocks, after which
+// Postgres expects the whole transaction to be retried.
+func isRetryable(err error) bool {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return false
+	}
+	return pqErr.Code == "40001" || pqErr.Code == "40P01"
+}
@@ -0,0 +1,14 @@
+package repotest
+
+import (
+	"context"
+	"song-lib/internal/externalAPI"
+)
+
+// StubDetails is a song.DetailsProvider that answers every lookup with the
+// same details.
+type StubDetails struct{}
+
+func (StubDetails) GetSongDetails(context.Context, string, string) (*externalAPI.SongDetails, error) {
+	return &externalAPI.SongDetails{ReleaseDate: "16.07.2006", Text: "verse\n\nchorus", Link: "https://example.com"}, nil
+}
@@ -0,0 +1,343 @@
+// Package repotest holds conformance suites shared by the repository
+// implementations. Each implementation's tests call them with a constructor
+// that returns an empty repository:
+//
+//	func TestSongRepo(t *testing.T) {
+//		repotest.SongRepository(t, func(t *testing.T) repotest.Repositories {
+//			db := memory.NewDB()
+//			return repotest.Repositories{
+//				Songs: memory.NewSongRepo(db, zap.NewNop().Sugar()),
+//				Users: memory.NewUserRepo(db, zap.NewNop().Sugar()),
+//			}
+//		})
+//	}
+package repotest
+
+import (
+	"context"
+	"errors"
+	"song-lib/internal/auth"
+	"song-lib/internal/models"
+	"song-lib/internal/usecase/song"
+	"song-lib/internal/usecase/user"
+	"sync"
+	"testing"
+)
+
+// Repositories share one empty store; Users registers the owners that
+// songs.created_by refers to.
+type Repositories struct {
+	Songs song.Repository
+	Users user.Repository
+}
+
+// SongRepository checks the behaviour song.Repository implementations must
+// agree on: filtering, pagination, the (artist, title) uniqueness, text
+// splitting, restoring deleted songs, and reporting ErrSongNotFound and
+// ErrSongExists from the mutation itself when writers race.
+func SongRepository(t *testing.T, newRepos func(t *testing.T) Repositories) {
+	newRepo := func(t *testing.T) song.Repository { return newRepos(t).Songs }
+
+	t.Run("CreateAndGet", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := context.Background()
+
+		created := mustCreate(t, repo, models.Song{Artist: "Muse", Title: "Uprising", ReleaseDate: "2009", Text: "a\n\nb", SourceLink: "https://example.com/uprising"})
+		if !repo.Exist(ctx, created.ID) {
+			t.Fatalf("Exist(%d) = false after CreateSong", created.ID)
+		}
+		got, err := repo.GetSong(ctx, created.ID)
+		if err != nil {
+			t.Fatalf("GetSong: %v", err)
+		}
+		if got.Artist != "Muse" || got.Title != "Uprising" || got.ReleaseDate != "2009" || got.SourceLink != "https://example.com/uprising" {
+			t.Errorf("GetSong = %+v", got)
+		}
+	})
+
+	t.Run("Missing", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := context.Background()
+
+		if repo.Exist(ctx, 4242) {
+			t.Error("Exist on an empty repository = true")
+		}
+		if _, err := repo.GetSong(ctx, 4242); err != models.ErrSongNotFound {
+			t.Errorf("GetSong error = %v, want ErrSongNotFound", err)
+		}
+		if text, err := repo.GetSongText(ctx, 4242); err != nil || text != nil {
+			t.Errorf("GetSongText = %v, %v; want nil, nil", text, err)
+		}
+		if err := repo.ChangeSong(ctx, models.Song{ID: 4242, Artist: "Muse", Title: "Uprising"}); !errors.Is(err, models.ErrSongNotFound) {
+			t.Errorf("ChangeSong error = %v, want ErrSongNotFound", err)
+		}
+		if err := repo.DeleteSong(ctx, 4242); !errors.Is(err, models.ErrSongNotFound) {
+			t.Errorf("DeleteSong error = %v, want ErrSongNotFound", err)
+		}
+	})
+
+	t.Run("Unique", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := context.Background()
+
+		mustCreate(t, repo, models.Song{Artist: "Muse", Title: "Uprising"})
+		other := mustCreate(t, repo, models.Song{Artist: "Muse", Title: "Resistance"})
+
+		if err := repo.CreateSong(ctx, models.Song{Artist: "Muse", Title: "Uprising"}); !errors.Is(err, models.ErrSongExists) {
+			t.Errorf("CreateSong with a duplicate artist and title error = %v, want ErrSongExists", err)
+		}
+		other.Title = "Uprising"
+		if err := repo.ChangeSong(ctx, other); !errors.Is(err, models.ErrSongExists) {
+			t.Errorf("ChangeSong to a duplicate artist and title error = %v, want ErrSongExists", err)
+		}
+	})
+
+	t.Run("Filter", func(t *testing.T) {
+		repos := newRepos(t)
+		repo := repos.Songs
+		ctx := context.Background()
+
+		owner, err := repos.Users.UpsertUser(ctx, models.User{Subject: "repotest", Name: "repotest", Role: auth.RoleContributor})
+		if err != nil {
+			t.Fatalf("UpsertUser: %v", err)
+		}
+
+		mustCreate(t, repo, models.Song{Artist: "Muse", Title: "Uprising", ReleaseDate: "2009", Text: "They will not force us", SourceLink: "a"})
+		mustCreate(t, repo, models.Song{Artist: "Muse", Title: "Madness", ReleaseDate: "2012", Text: "I can't get these memories", SourceLink: "b"})
+		mustCreate(t, repo, models.Song{Artist: "Queen", Title: "Bicycle Race", ReleaseDate: "1978", Text: "I want to ride", SourceLink: "c", CreatedBy: &owner.ID})
+
+		cases := []struct {
+			name   string
+			filter models.SongFilter
+			want   []string
+		}{
+			{"all", models.SongFilter{}, []string{"Uprising", "Madness", "Bicycle Race"}},
+			{"artist substring", models.SongFilter{Artist: "us"}, []string{"Uprising", "Madness"}},
+			{"title substring", models.SongFilter{Title: "Race"}, []string{"Bicycle Race"}},
+			{"release date exact", models.SongFilter{ReleaseDate: "201"}, nil},
+			{"release date", models.SongFilter{ReleaseDate: "2012"}, []string{"Madness"}},
+			{"text substring", models.SongFilter{Text: "force"}, []string{"Uprising"}},
+			{"source link", models.SongFilter{SourceLink: "c"}, []string{"Bicycle Race"}},
+			{"combined", models.SongFilter{Artist: "Muse", ReleaseDate: "2009"}, []string{"Uprising"}},
+			{"created by", models.SongFilter{CreatedBy: owner.ID}, []string{"Bicycle Race"}},
+		}
+
+		for _, tc := range cases {
+			t.Run(tc.name, func(t *testing.T) {
+				songs, err := repo.GetSongs(ctx, tc.filter)
+				if err != nil {
+					t.Fatalf("GetSongs: %v", err)
+				}
+				assertTitles(t, songs, tc.want)
+			})
+		}
+	})
+
+	t.Run("Pagination", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := context.Background()
+
+		for _, title := range []string{"One", "Two", "Three", "Four"} {
+			mustCreate(t, repo, models.Song{Artist: "Band", Title: title})
+		}
+
+		all, err := repo.GetSongs(ctx, models.SongFilter{})
+		if err != nil {
+			t.Fatalf("GetSongs: %v", err)
+		}
+		page, err := repo.GetSongs(ctx, models.SongFilter{Limit: 2, Offset: 1})
+		if err != nil {
+			t.Fatalf("GetSongs: %v", err)
+		}
+		if len(page) != 2 || page[0].ID != all[1].ID || page[1].ID != all[2].ID {
+			t.Errorf("GetSongs(limit 2, offset 1) = %v, want songs 2 and 3 of %v", page, all)
+		}
+		if past, err := repo.GetSongs(ctx, models.SongFilter{Offset: 10}); err != nil || len(past) != 0 {
+			t.Errorf("GetSongs(offset 10) = %v, %v; want no songs", past, err)
+		}
+	})
+
+	t.Run("ChangeAndText", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := context.Background()
+
+		created := mustCreate(t, repo, models.Song{Artist: "Muse", Title: "Uprising", Text: "old"})
+		created.Text = "verse one\n\nchorus\n\nverse two"
+		if err := repo.ChangeSong(ctx, created); err != nil {
+			t.Fatalf("ChangeSong: %v", err)
+		}
+
+		text, err := repo.GetSongText(ctx, created.ID)
+		if err != nil {
+			t.Fatalf("GetSongText: %v", err)
+		}
+		if len(text) != 3 || text[0] != "verse one" || text[1] != "chorus" || text[2] != "verse two" {
+			t.Errorf("GetSongText = %q", text)
+		}
+	})
+
+	t.Run("DeleteAndRestore", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := context.Background()
+
+		created := mustCreate(t, repo, models.Song{Artist: "Muse", Title: "Uprising", Text: "lyrics"})
+		if _, err := repo.GetDeletedSong(ctx, created.ID); err != models.ErrSongNotFound {
+			t.Errorf("GetDeletedSong before delete error = %v, want ErrSongNotFound", err)
+		}
+
+		if err := repo.DeleteSong(ctx, created.ID); err != nil {
+			t.Fatalf("DeleteSong: %v", err)
+		}
+		if repo.Exist(ctx, created.ID) {
+			t.Fatal("Exist = true after DeleteSong")
+		}
+		if other := mustCreate(t, repo, models.Song{Artist: "Muse", Title: "Resistance"}); other.ID == created.ID {
+			t.Fatalf("CreateSong reused the ID %d of a deleted song", created.ID)
+		}
+
+		deleted, err := repo.GetDeletedSong(ctx, created.ID)
+		if err != nil {
+			t.Fatalf("GetDeletedSong: %v", err)
+		}
+		if deleted.ID != created.ID || deleted.Text != "lyrics" {
+			t.Errorf("GetDeletedSong = %+v", deleted)
+		}
+
+		if err := repo.RestoreSong(ctx, deleted); err != nil {
+			t.Fatalf("RestoreSong: %v", err)
+		}
+		restored, err := repo.GetSong(ctx, created.ID)
+		if err != nil || restored.Title != "Uprising" {
+			t.Errorf("GetSong after restore = %+v, %v", restored, err)
+		}
+		if err := repo.RestoreSong(ctx, deleted); !errors.Is(err, models.ErrSongExists) {
+			t.Errorf("RestoreSong of a present song error = %v, want ErrSongExists", err)
+		}
+	})
+
+	t.Run("ConcurrentDelete", func(t *testing.T) {
+		repo := newRepo(t)
+		created := mustCreate(t, repo, models.Song{Artist: "Muse", Title: "Uprising"})
+
+		errs := race(func(ctx context.Context) error { return repo.DeleteSong(ctx, created.ID) })
+		assertOutcomes(t, "DeleteSong", errs, models.ErrSongNotFound)
+	})
+
+	t.Run("ConcurrentCreate", func(t *testing.T) {
+		repo := newRepo(t)
+
+		errs := race(func(ctx context.Context) error {
+			return repo.CreateSong(ctx, models.Song{Artist: "Muse", Title: "Uprising"})
+		})
+		assertOutcomes(t, "CreateSong", errs, models.ErrSongExists)
+	})
+
+	t.Run("ConcurrentChangeAndDelete", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := context.Background()
+		created := mustCreate(t, repo, models.Song{Artist: "Muse", Title: "Uprising"})
+
+		var wg sync.WaitGroup
+		var changeErr, deleteErr error
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			changed := created
+			changed.Text = "changed"
+			changeErr = repo.ChangeSong(ctx, changed)
+		}()
+		go func() {
+			defer wg.Done()
+			deleteErr = repo.DeleteSong(ctx, created.ID)
+		}()
+		wg.Wait()
+
+		if deleteErr != nil {
+			t.Fatalf("DeleteSong: %v", deleteErr)
+		}
+		// Either the update won and was then deleted, or it found no song.
+		if changeErr != nil && !errors.Is(changeErr, models.ErrSongNotFound) {
+			t.Errorf("ChangeSong error = %v, want nil or ErrSongNotFound", changeErr)
+		}
+		if repo.Exist(ctx, created.ID) {
+			t.Error("Exist = true after DeleteSong")
+		}
+	})
+}
+
+// racers is how many goroutines race for the same song.
+const racers = 8
+
+func race(fn func(ctx context.Context) error) []error {
+	errs := make([]error, racers)
+	start := make(chan struct{})
+
+	var wg sync.WaitGroup
+	for i := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			errs[i] = fn(context.Background())
+		}()
+	}
+	close(start)
+	wg.Wait()
+	return errs
+}
+
+// assertOutcomes expects exactly one racer to succeed and the others to fail
+// with lost.
+func assertOutcomes(t *testing.T, method string, errs []error, lost error) {
+	t.Helper()
+
+	succeeded := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			succeeded++
+		case !errors.Is(err, lost):
+			t.Errorf("%s error = %v, want nil or %v", method, err, lost)
+		}
+	}
+	if succeeded != 1 {
+		t.Errorf("%d concurrent %s calls succeeded, want 1", succeeded, method)
+	}
+}
+
+func mustCreate(t *testing.T, repo song.Repository, s models.Song) models.Song {
+	t.Helper()
+	ctx := context.Background()
+
+	if err := repo.CreateSong(ctx, s); err != nil {
+		t.Fatalf("CreateSong(%s - %s): %v", s.Artist, s.Title, err)
+	}
+	songs, err := repo.GetSongs(ctx, models.SongFilter{Artist: s.Artist, Title: s.Title})
+	if err != nil {
+		t.Fatalf("GetSongs: %v", err)
+	}
+	for _, created := range songs {
+		if created.Artist == s.Artist && created.Title == s.Title {
+			return created
+		}
+	}
+	t.Fatalf("song %s - %s not found after CreateSong", s.Artist, s.Title)
+	return models.Song{}
+}
+
+func assertTitles(t *testing.T, songs []models.Song, want []string) {
+	t.Helper()
+
+	var got []string
+	for _, s := range songs {
+		got = append(got, s.Title)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("titles = %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("titles = %q, want %q", got, want)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package repotest
+
+import (
+	"context"
+	"github.com/jmoiron/sqlx"
+	"path/filepath"
+	"song-lib/internal/config"
+	"song-lib/internal/db"
+	"testing"
+)
+
+// OpenSQLite migrates a fresh SQLite database in a temporary directory and
+// closes it when the test ends.
+func OpenSQLite(t *testing.T) *sqlx.DB {
+	t.Helper()
+
+	dsn := config.SQLiteConfig{Path: filepath.Join(t.TempDir(), "songs.db")}.DSN()
+	migrator, err := db.NewSQLiteMigrator(dsn)
+	if err != nil {
+		t.Fatalf("NewSQLiteMigrator: %v", err)
+	}
+	if err := migrator.Up(context.Background()); err != nil {
+		t.Fatalf("migrate up: %v", err)
+	}
+	if err := migrator.Close(); err != nil {
+		t.Fatalf("close migrator: %v", err)
+	}
+
+	sqliteDB, err := sqlx.Connect("sqlite", dsn)
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	t.Cleanup(func() { _ = sqliteDB.Close() })
+	return sqliteDB
+}
@@ -0,0 +1,197 @@
+package sqlite
+
+import (
+	"context"
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+	"math"
+	"song-lib/internal/db"
+	"song-lib/internal/logging"
+	"song-lib/internal/models"
+	"song-lib/internal/tracing"
+	"time"
+)
+
+type AuditRepo struct {
+	db     *sqlx.DB
+	logger *zap.SugaredLogger
+}
+
+func NewAuditRepo(db *sqlx.DB, logger *zap.SugaredLogger) *AuditRepo {
+	return &AuditRepo{db: db, logger: logger}
+}
+
+// conn joins the transaction of a unit of work when ctx carries one.
+func (a *AuditRepo) conn(ctx context.Context) db.Queryer {
+	return db.Conn(ctx, a.db)
+}
+
+type auditEventRow struct {
+	ID         int64     `db:"id"`
+	OccurredAt time.Time `db:"occurred_at"`
+	Action     string    `db:"action"`
+	SongID     int       `db:"song_id"`
+	ActorID    *int      `db:"actor_id"`
+	Actor      string    `db:"actor"`
+	RequestID  string    `db:"request_id"`
+	ClientIP   string    `db:"client_ip"`
+	Before     []byte    `db:"before"`
+	After      []byte    `db:"after"`
+}
+
+func (r auditEventRow) model() models.AuditEvent {
+	return models.AuditEvent{
+		ID:         r.ID,
+		OccurredAt: r.OccurredAt,
+		Action:     r.Action,
+		SongID:     r.SongID,
+		ActorID:    r.ActorID,
+		Actor:      r.Actor,
+		RequestID:  r.RequestID,
+		ClientIP:   r.ClientIP,
+		Before:     r.Before,
+		After:      r.After,
+	}
+}
+
+var auditEventColumns = []string{"id", "occurred_at", "action", "song_id", "actor_id", "actor", "request_id", "client_ip", "before", "after"}
+
+// insertAuditEvent is called by SongRepo inside the transaction of the
+// mutation it describes.
+func insertAuditEvent(ctx context.Context, tx *sqlx.Tx, event models.AuditEvent) error {
+	query, args, err := sq.Insert("audit_events").
+		Columns("occurred_at", "action", "song_id", "actor_id", "actor", "request_id", "client_ip", "before", "after").
+		Values(now(), event.Action, event.SongID, event.ActorID, event.Actor, event.RequestID, event.ClientIP,
+			jsonText(event.Before), jsonText(event.After)).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	ctx, span := tracing.StartQuery(ctx, "AuditRepo.InsertEvent", query)
+	defer span.End()
+
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		tracing.RecordError(span, err)
+		return err
+	}
+	return nil
+}
+
+// jsonText stores a snapshot as TEXT so it stays readable with the sqlite3
+// shell and its JSON functions, rather than as a BLOB.
+func jsonText(data []byte) interface{} {
+	if data == nil {
+		return nil
+	}
+	return string(data)
+}
+
+func (a *AuditRepo) ListEvents(ctx context.Context, filter models.AuditFilter) ([]models.AuditEvent, error) {
+	logger := logging.FromContext(ctx, a.logger)
+
+	query := sq.Select(auditEventColumns...).
+		From("audit_events").
+		OrderBy("occurred_at DESC", "id DESC")
+
+	if filter.SongID != 0 {
+		query = query.Where(sq.Eq{"song_id": filter.SongID})
+	}
+	if filter.Actor != "" {
+		query = query.Where(sq.Eq{"actor": filter.Actor})
+	}
+	if !filter.From.IsZero() {
+		query = query.Where(sq.GtOrEq{"occurred_at": filter.From.UTC()})
+	}
+	if !filter.To.IsZero() {
+		query = query.Where(sq.Lt{"occurred_at": filter.To.UTC()})
+	}
+	if filter.Limit > 0 {
+		query = query.Limit(filter.Limit)
+	}
+	if filter.Offset > 0 {
+		if filter.Limit == 0 {
+			query = query.Limit(math.MaxInt64)
+		}
+		query = query.Offset(filter.Offset)
+	}
+
+	sqlQuery, args, err := query.ToSql()
+	if err != nil {
+		logger.Errorw("Failed to build SQL query for ListEvents", "error", err)
+		return nil, err
+	}
+
+	ctx, span := tracing.StartQuery(ctx, "AuditRepo.ListEvents", sqlQuery)
+	defer span.End()
+
+	var rows []auditEventRow
+	if err := a.conn(ctx).SelectContext(ctx, &rows, sqlQuery, args...); err != nil {
+		tracing.RecordError(span, err)
+		logger.Errorw("Failed to execute ListEvents query", "error", err)
+		return nil, err
+	}
+
+	events := make([]models.AuditEvent, 0, len(rows))
+	for _, row := range rows {
+		events = append(events, row.model())
+	}
+	return events, nil
+}
+
+// EventsAfter returns up to limit events with IDs above afterID, oldest
+// first, for following the log.
+func (a *AuditRepo) EventsAfter(ctx context.Context, afterID int64, limit uint64) ([]models.AuditEvent, error) {
+	logger := logging.FromContext(ctx, a.logger)
+
+	query, args, err := sq.Select(auditEventColumns...).
+		From("audit_events").
+		Where(sq.Gt{"id": afterID}).
+		OrderBy("id").
+		Limit(limit).
+		ToSql()
+	if err != nil {
+		logger.Errorw("Failed to build SQL query for EventsAfter", "error", err)
+		return nil, err
+	}
+
+	ctx, span := tracing.StartQuery(ctx, "AuditRepo.EventsAfter", query)
+	defer span.End()
+
+	var rows []auditEventRow
+	if err := a.conn(ctx).SelectContext(ctx, &rows, query, args...); err != nil {
+		tracing.RecordError(span, err)
+		logger.Errorw("Failed to execute EventsAfter query", "error", err)
+		return nil, err
+	}
+
+	events := make([]models.AuditEvent, 0, len(rows))
+	for _, row := range rows {
+		events = append(events, row.model())
+	}
+	return events, nil
+}
+
+func (a *AuditRepo) DeleteBefore(ctx context.Context, before time.Time) (int64, error) {
+	logger := logging.FromContext(ctx, a.logger)
+
+	query, args, err := sq.Delete("audit_events").
+		Where(sq.Lt{"occurred_at": before.UTC()}).
+		ToSql()
+	if err != nil {
+		logger.Errorw("Failed to build SQL query for DeleteBefore", "error", err)
+		return 0, err
+	}
+
+	ctx, span := tracing.StartQuery(ctx, "AuditRepo.DeleteBefore", query)
+	defer span.End()
+
+	res, err := a.conn(ctx).ExecContext(ctx, query, args...)
+	if err != nil {
+		tracing.RecordError(span, err)
+		logger.Errorw("Failed to execute DeleteBefore query", "error", err)
+		return 0, err
+	}
+	return res.RowsAffected()
+}
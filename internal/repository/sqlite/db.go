@@ -0,0 +1,10 @@
+// Package sqlite implements the repositories on a single SQLite file for
+// deployments without Postgres. Times are always written in UTC by the
+// application, so the stored text compares in time order.
+package sqlite
+
+import "time"
+
+func now() time.Time {
+	return time.Now().UTC()
+}
@@ -0,0 +1,166 @@
+package sqlite
+
+import (
+	"context"
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+	"song-lib/internal/logging"
+	"song-lib/internal/models"
+	"song-lib/internal/tracing"
+	"time"
+)
+
+type OutboxRepo struct {
+	db     *sqlx.DB
+	logger *zap.SugaredLogger
+}
+
+func NewOutboxRepo(db *sqlx.DB, logger *zap.SugaredLogger) *OutboxRepo {
+	return &OutboxRepo{db: db, logger: logger}
+}
+
+type outboxEventRow struct {
+	ID            int64      `db:"id"`
+	OccurredAt    time.Time  `db:"occurred_at"`
+	Type          string     `db:"type"`
+	SongID        int        `db:"song_id"`
+	Song          string     `db:"song"`
+	Attempts      int        `db:"attempts"`
+	LastError     *string    `db:"last_error"`
+	NextAttemptAt *time.Time `db:"next_attempt_at"`
+	DeadAt        *time.Time `db:"dead_at"`
+}
+
+func (r outboxEventRow) model() models.OutboxEvent {
+	event := models.OutboxEvent{
+		ID:            r.ID,
+		Type:          r.Type,
+		SongID:        r.SongID,
+		OccurredAt:    r.OccurredAt,
+		Song:          []byte(r.Song),
+		Attempts:      r.Attempts,
+		NextAttemptAt: r.NextAttemptAt,
+		DeadAt:        r.DeadAt,
+	}
+	if r.LastError != nil {
+		event.LastError = *r.LastError
+	}
+	return event
+}
+
+// insertOutboxEvent is called by SongRepo inside the transaction of the
+// mutation it announces.
+func insertOutboxEvent(ctx context.Context, tx *sqlx.Tx, event models.OutboxEvent) error {
+	query, args, err := sq.Insert("outbox_events").
+		Columns("occurred_at", "type", "song_id", "song").
+		Values(now(), event.Type, event.SongID, jsonText(event.Song)).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	ctx, span := tracing.StartQuery(ctx, "OutboxRepo.InsertEvent", query)
+	defer span.End()
+
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		tracing.RecordError(span, err)
+		return err
+	}
+	return nil
+}
+
+// Lock always succeeds: the database file belongs to one process, which
+// runs one relay.
+func (o *OutboxRepo) Lock(context.Context) (func(), bool, error) {
+	return func() {}, true, nil
+}
+
+func (o *OutboxRepo) Pending(ctx context.Context, limit int) ([]models.OutboxEvent, error) {
+	logger := logging.FromContext(ctx, o.logger)
+
+	// An event waits while an earlier live event of its song is not due, so
+	// that a failing song keeps its order without holding up the others.
+	dueAt := now()
+	query, args, err := sq.Select("id", "occurred_at", "type", "song_id", "song", "attempts", "last_error", "next_attempt_at", "dead_at").
+		From("outbox_events e").
+		Where(sq.Eq{"dead_at": nil}).
+		Where(sq.Or{sq.Eq{"next_attempt_at": nil}, sq.LtOrEq{"next_attempt_at": dueAt}}).
+		Where(`NOT EXISTS (SELECT 1 FROM outbox_events b
+			WHERE b.song_id = e.song_id AND b.id < e.id AND b.dead_at IS NULL AND b.next_attempt_at > ?)`, dueAt).
+		OrderBy("id").
+		Limit(uint64(limit)).
+		ToSql()
+	if err != nil {
+		logger.Errorw("Failed to build SQL query for Pending", "error", err)
+		return nil, err
+	}
+
+	ctx, span := tracing.StartQuery(ctx, "OutboxRepo.Pending", query)
+	defer span.End()
+
+	var rows []outboxEventRow
+	if err := o.db.SelectContext(ctx, &rows, query, args...); err != nil {
+		tracing.RecordError(span, err)
+		logger.Errorw("Failed to execute Pending query", "error", err)
+		return nil, err
+	}
+
+	events := make([]models.OutboxEvent, 0, len(rows))
+	for _, row := range rows {
+		events = append(events, row.model())
+	}
+	return events, nil
+}
+
+func (o *OutboxRepo) MarkPublished(ctx context.Context, ids ...int64) error {
+	logger := logging.FromContext(ctx, o.logger)
+
+	query, args, err := sq.Delete("outbox_events").
+		Where(sq.Eq{"id": ids}).
+		ToSql()
+	if err != nil {
+		logger.Errorw("Failed to build SQL query for MarkPublished", "error", err)
+		return err
+	}
+
+	ctx, span := tracing.StartQuery(ctx, "OutboxRepo.MarkPublished", query)
+	defer span.End()
+
+	if _, err := o.db.ExecContext(ctx, query, args...); err != nil {
+		tracing.RecordError(span, err)
+		logger.Errorw("Failed to execute MarkPublished query", "error", err)
+		return err
+	}
+	return nil
+}
+
+func (o *OutboxRepo) MarkFailed(ctx context.Context, id int64, reason string, nextAttemptAt *time.Time) error {
+	logger := logging.FromContext(ctx, o.logger)
+
+	builder := sq.Update("outbox_events").
+		Set("attempts", sq.Expr("attempts + 1")).
+		Set("last_error", reason)
+	if nextAttemptAt != nil {
+		builder = builder.Set("next_attempt_at", nextAttemptAt.UTC())
+	} else {
+		builder = builder.Set("dead_at", now())
+	}
+	query, args, err := builder.
+		Where(sq.Eq{"id": id}).
+		ToSql()
+	if err != nil {
+		logger.Errorw("Failed to build SQL query for MarkFailed", "error", err)
+		return err
+	}
+
+	ctx, span := tracing.StartQuery(ctx, "OutboxRepo.MarkFailed", query)
+	defer span.End()
+
+	if _, err := o.db.ExecContext(ctx, query, args...); err != nil {
+		tracing.RecordError(span, err)
+		logger.Errorw("Failed to execute MarkFailed query", "error", err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,18 @@
+package sqlite_test
+
+import (
+	"go.uber.org/zap"
+	"song-lib/internal/repository/repotest"
+	"song-lib/internal/repository/sqlite"
+	"testing"
+)
+
+func TestSongRepo(t *testing.T) {
+	repotest.SongRepository(t, func(t *testing.T) repotest.Repositories {
+		sqliteDB := repotest.OpenSQLite(t)
+		return repotest.Repositories{
+			Songs: sqlite.NewSongRepo(sqliteDB, zap.NewNop().Sugar()),
+			Users: sqlite.NewUserRepo(sqliteDB, zap.NewNop().Sugar()),
+		}
+	})
+}
@@ -0,0 +1,38 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"github.com/jmoiron/sqlx"
+	sqlitedriver "modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+	"song-lib/internal/db"
+)
+
+// TxManager runs units of work in IMMEDIATE transactions, which SQLite
+// executes serializably whatever db.isolation says.
+type TxManager struct {
+	db   *sqlx.DB
+	opts db.TxOptions
+}
+
+func NewTxManager(sqlDB *sqlx.DB, retries int) *TxManager {
+	return &TxManager{
+		db:   sqlDB,
+		opts: db.TxOptions{Retries: retries, Retryable: isRetryable},
+	}
+}
+
+func (m *TxManager) WithTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return db.RunTx(ctx, m.db, m.opts, fn)
+}
+
+// isRetryable matches SQLITE_BUSY, returned once busy_timeout ran out while
+// another connection held the write lock.
+func isRetryable(err error) bool {
+	var sqliteErr *sqlitedriver.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	return sqliteErr.Code()&0xff == sqlite3.SQLITE_BUSY
+}
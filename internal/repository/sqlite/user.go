@@ -0,0 +1,159 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+	"song-lib/internal/db"
+	"song-lib/internal/logging"
+	"song-lib/internal/models"
+	"song-lib/internal/tracing"
+	"time"
+)
+
+type UserRepo struct {
+	db     *sqlx.DB
+	logger *zap.SugaredLogger
+}
+
+func NewUserRepo(db *sqlx.DB, logger *zap.SugaredLogger) *UserRepo {
+	return &UserRepo{db: db, logger: logger}
+}
+
+// conn joins the transaction of a unit of work when ctx carries one.
+func (u *UserRepo) conn(ctx context.Context) db.Queryer {
+	return db.Conn(ctx, u.db)
+}
+
+var userColumns = []string{"id", "subject", "name", "role", "created_at", "last_seen_at"}
+
+// upsertUserQuery follows the Postgres statement: it only writes when the
+// name or role changed, or last_seen_at is older than ?5. An empty role
+// keeps the stored one. When nothing is written RETURNING yields no row and
+// UpsertUser reads the user instead.
+const upsertUserQuery = `
+INSERT INTO users (subject, name, role, created_at, last_seen_at)
+VALUES (?1, ?2, COALESCE(NULLIF(?3, ''), 'viewer'), ?4, ?4)
+ON CONFLICT (subject) DO UPDATE
+SET name = excluded.name,
+    role = CASE WHEN ?3 = '' THEN users.role ELSE excluded.role END,
+    last_seen_at = excluded.last_seen_at
+WHERE users.name <> excluded.name
+   OR (?3 <> '' AND users.role <> excluded.role)
+   OR users.last_seen_at < ?5
+RETURNING id, subject, name, role, created_at, last_seen_at`
+
+func (u *UserRepo) UpsertUser(ctx context.Context, user models.User) (models.User, error) {
+	logger := logging.FromContext(ctx, u.logger)
+
+	ctx, span := tracing.StartQuery(ctx, "UserRepo.UpsertUser", upsertUserQuery)
+	defer span.End()
+
+	seenAt := now()
+	var row models.User
+	err := u.conn(ctx).QueryRowxContext(ctx, upsertUserQuery, user.Subject, user.Name, user.Role, seenAt, seenAt.Add(-time.Minute)).StructScan(&row)
+	if errors.Is(err, sql.ErrNoRows) {
+		row, err = u.getBySubject(ctx, user.Subject)
+	}
+	if err != nil {
+		tracing.RecordError(span, err)
+		logger.Errorw("Failed to execute UpsertUser query", "subject", user.Subject, "error", err)
+		return models.User{}, err
+	}
+	return row, nil
+}
+
+func (u *UserRepo) getBySubject(ctx context.Context, subject string) (models.User, error) {
+	query, args, err := sq.Select(userColumns...).
+		From("users").
+		Where(sq.Eq{"subject": subject}).
+		ToSql()
+	if err != nil {
+		return models.User{}, err
+	}
+
+	var user models.User
+	err = u.conn(ctx).GetContext(ctx, &user, query, args...)
+	return user, err
+}
+
+func (u *UserRepo) GetUser(ctx context.Context, userID int) (models.User, error) {
+	logger := logging.FromContext(ctx, u.logger)
+
+	query, args, err := sq.Select(userColumns...).
+		From("users").
+		Where(sq.Eq{"id": userID}).
+		ToSql()
+	if err != nil {
+		logger.Errorw("Failed to build SQL query for GetUser", "error", err)
+		return models.User{}, err
+	}
+
+	ctx, span := tracing.StartQuery(ctx, "UserRepo.GetUser", query)
+	defer span.End()
+
+	var user models.User
+	if err := u.conn(ctx).GetContext(ctx, &user, query, args...); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.User{}, models.ErrUserNotFound
+		}
+		tracing.RecordError(span, err)
+		logger.Errorw("Failed to execute GetUser query", "userID", userID, "error", err)
+		return models.User{}, err
+	}
+	return user, nil
+}
+
+func (u *UserRepo) ListUsers(ctx context.Context) ([]models.User, error) {
+	logger := logging.FromContext(ctx, u.logger)
+
+	query, args, err := sq.Select(userColumns...).
+		From("users").
+		OrderBy("id").
+		ToSql()
+	if err != nil {
+		logger.Errorw("Failed to build SQL query for ListUsers", "error", err)
+		return nil, err
+	}
+
+	ctx, span := tracing.StartQuery(ctx, "UserRepo.ListUsers", query)
+	defer span.End()
+
+	var users []models.User
+	if err := u.conn(ctx).SelectContext(ctx, &users, query, args...); err != nil {
+		tracing.RecordError(span, err)
+		logger.Errorw("Failed to execute ListUsers query", "error", err)
+		return nil, err
+	}
+	return users, nil
+}
+
+func (u *UserRepo) SetRole(ctx context.Context, subject, role string) error {
+	logger := logging.FromContext(ctx, u.logger)
+
+	query, args, err := sq.Update("users").
+		Set("role", role).
+		Where(sq.Eq{"subject": subject}).
+		ToSql()
+	if err != nil {
+		logger.Errorw("Failed to build SQL query for SetRole", "error", err)
+		return err
+	}
+
+	ctx, span := tracing.StartQuery(ctx, "UserRepo.SetRole", query)
+	defer span.End()
+
+	res, err := u.conn(ctx).ExecContext(ctx, query, args...)
+	if err != nil {
+		tracing.RecordError(span, err)
+		logger.Errorw("Failed to execute SetRole query", "error", err)
+		return err
+	}
+	if affected, err := res.RowsAffected(); err == nil && affected == 0 {
+		return models.ErrUserNotFound
+	}
+	return nil
+}
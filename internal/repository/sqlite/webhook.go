@@ -0,0 +1,488 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+	"song-lib/internal/logging"
+	"song-lib/internal/models"
+	"song-lib/internal/tracing"
+	"strings"
+	"time"
+)
+
+type WebhookRepo struct {
+	db     *sqlx.DB
+	logger *zap.SugaredLogger
+}
+
+func NewWebhookRepo(db *sqlx.DB, logger *zap.SugaredLogger) *WebhookRepo {
+	return &WebhookRepo{db: db, logger: logger}
+}
+
+type webhookRow struct {
+	ID        int       `db:"id"`
+	Name      string    `db:"name"`
+	URL       string    `db:"url"`
+	Secret    string    `db:"secret"`
+	Events    string    `db:"events"`
+	Artists   string    `db:"artists"`
+	Active    bool      `db:"active"`
+	CreatedAt time.Time `db:"created_at"`
+	UpdatedAt time.Time `db:"updated_at"`
+}
+
+func (r webhookRow) model() (models.Webhook, error) {
+	webhook := models.Webhook{
+		ID:        r.ID,
+		Name:      r.Name,
+		URL:       r.URL,
+		Secret:    r.Secret,
+		Active:    r.Active,
+		CreatedAt: r.CreatedAt,
+		UpdatedAt: r.UpdatedAt,
+	}
+	if err := json.Unmarshal([]byte(r.Events), &webhook.Events); err != nil {
+		return models.Webhook{}, err
+	}
+	if err := json.Unmarshal([]byte(r.Artists), &webhook.Artists); err != nil {
+		return models.Webhook{}, err
+	}
+	return webhook, nil
+}
+
+var webhookColumns = []string{"id", "name", "url", "secret", "events", "artists", "active", "created_at", "updated_at"}
+
+type deliveryRow struct {
+	ID             int64      `db:"id"`
+	WebhookID      int        `db:"webhook_id"`
+	EventID        int64      `db:"event_id"`
+	EventType      string     `db:"event_type"`
+	Payload        []byte     `db:"payload"`
+	Status         string     `db:"status"`
+	Attempts       int        `db:"attempts"`
+	NextAttemptAt  *time.Time `db:"next_attempt_at"`
+	LastAttemptAt  *time.Time `db:"last_attempt_at"`
+	ResponseStatus *int       `db:"response_status"`
+	LastError      *string    `db:"last_error"`
+	CreatedAt      time.Time  `db:"created_at"`
+	DeliveredAt    *time.Time `db:"delivered_at"`
+}
+
+func (r deliveryRow) model() models.WebhookDelivery {
+	delivery := models.WebhookDelivery{
+		ID:            r.ID,
+		WebhookID:     r.WebhookID,
+		EventID:       r.EventID,
+		EventType:     r.EventType,
+		Payload:       r.Payload,
+		Status:        r.Status,
+		Attempts:      r.Attempts,
+		NextAttemptAt: r.NextAttemptAt,
+		LastAttemptAt: r.LastAttemptAt,
+		CreatedAt:     r.CreatedAt,
+		DeliveredAt:   r.DeliveredAt,
+	}
+	if r.ResponseStatus != nil {
+		delivery.ResponseStatus = *r.ResponseStatus
+	}
+	if r.LastError != nil {
+		delivery.LastError = *r.LastError
+	}
+	return delivery
+}
+
+var deliveryColumns = []string{"id", "webhook_id", "event_id", "event_type", "payload", "status", "attempts",
+	"next_attempt_at", "last_attempt_at", "response_status", "last_error", "created_at", "delivered_at"}
+
+func (w *WebhookRepo) CreateWebhook(ctx context.Context, webhook models.Webhook) (models.Webhook, error) {
+	logger := logging.FromContext(ctx, w.logger)
+
+	events, err := json.Marshal(webhook.Events)
+	if err != nil {
+		return models.Webhook{}, err
+	}
+	artists, err := json.Marshal(webhook.Artists)
+	if err != nil {
+		return models.Webhook{}, err
+	}
+
+	createdAt := now()
+	query, args, err := sq.Insert("webhooks").
+		Columns("name", "url", "secret", "events", "artists", "active", "created_at", "updated_at").
+		Values(webhook.Name, webhook.URL, webhook.Secret, string(events), string(artists), webhook.Active,
+			createdAt, createdAt).
+		Suffix("RETURNING " + strings.Join(webhookColumns, ", ")).
+		ToSql()
+	if err != nil {
+		logger.Errorw("Failed to build SQL query for CreateWebhook", "error", err)
+		return models.Webhook{}, err
+	}
+
+	ctx, span := tracing.StartQuery(ctx, "WebhookRepo.CreateWebhook", query)
+	defer span.End()
+
+	var row webhookRow
+	if err := w.db.QueryRowxContext(ctx, query, args...).StructScan(&row); err != nil {
+		tracing.RecordError(span, err)
+		logger.Errorw("Failed to execute CreateWebhook query", "error", err)
+		return models.Webhook{}, err
+	}
+	return row.model()
+}
+
+func (w *WebhookRepo) GetWebhook(ctx context.Context, webhookID int) (models.Webhook, error) {
+	logger := logging.FromContext(ctx, w.logger)
+
+	query, args, err := sq.Select(webhookColumns...).
+		From("webhooks").
+		Where(sq.Eq{"id": webhookID}).
+		ToSql()
+	if err != nil {
+		logger.Errorw("Failed to build SQL query for GetWebhook", "error", err)
+		return models.Webhook{}, err
+	}
+
+	ctx, span := tracing.StartQuery(ctx, "WebhookRepo.GetWebhook", query)
+	defer span.End()
+
+	var row webhookRow
+	if err := w.db.QueryRowxContext(ctx, query, args...).StructScan(&row); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Webhook{}, models.ErrWebhookNotFound
+		}
+		tracing.RecordError(span, err)
+		logger.Errorw("Failed to execute GetWebhook query", "error", err)
+		return models.Webhook{}, err
+	}
+	return row.model()
+}
+
+func (w *WebhookRepo) ListWebhooks(ctx context.Context) ([]models.Webhook, error) {
+	return w.listWebhooks(ctx, "ListWebhooks", nil)
+}
+
+func (w *WebhookRepo) ActiveWebhooks(ctx context.Context) ([]models.Webhook, error) {
+	return w.listWebhooks(ctx, "ActiveWebhooks", sq.Eq{"active": true})
+}
+
+func (w *WebhookRepo) listWebhooks(ctx context.Context, method string, where sq.Sqlizer) ([]models.Webhook, error) {
+	logger := logging.FromContext(ctx, w.logger)
+
+	builder := sq.Select(webhookColumns...).
+		From("webhooks").
+		OrderBy("id")
+	if where != nil {
+		builder = builder.Where(where)
+	}
+	query, args, err := builder.ToSql()
+	if err != nil {
+		logger.Errorw("Failed to build SQL query for "+method, "error", err)
+		return nil, err
+	}
+
+	ctx, span := tracing.StartQuery(ctx, "WebhookRepo."+method, query)
+	defer span.End()
+
+	var rows []webhookRow
+	if err := w.db.SelectContext(ctx, &rows, query, args...); err != nil {
+		tracing.RecordError(span, err)
+		logger.Errorw("Failed to execute "+method+" query", "error", err)
+		return nil, err
+	}
+
+	webhooks := make([]models.Webhook, 0, len(rows))
+	for _, row := range rows {
+		webhook, err := row.model()
+		if err != nil {
+			logger.Errorw("Failed to decode webhook", "webhookID", row.ID, "error", err)
+			return nil, err
+		}
+		webhooks = append(webhooks, webhook)
+	}
+	return webhooks, nil
+}
+
+func (w *WebhookRepo) UpdateWebhook(ctx context.Context, webhook models.Webhook) (models.Webhook, error) {
+	logger := logging.FromContext(ctx, w.logger)
+
+	events, err := json.Marshal(webhook.Events)
+	if err != nil {
+		return models.Webhook{}, err
+	}
+	artists, err := json.Marshal(webhook.Artists)
+	if err != nil {
+		return models.Webhook{}, err
+	}
+
+	query, args, err := sq.Update("webhooks").
+		Set("name", webhook.Name).
+		Set("url", webhook.URL).
+		Set("events", string(events)).
+		Set("artists", string(artists)).
+		Set("active", webhook.Active).
+		Set("updated_at", now()).
+		Where(sq.Eq{"id": webhook.ID}).
+		Suffix("RETURNING " + strings.Join(webhookColumns, ", ")).
+		ToSql()
+	if err != nil {
+		logger.Errorw("Failed to build SQL query for UpdateWebhook", "error", err)
+		return models.Webhook{}, err
+	}
+
+	ctx, span := tracing.StartQuery(ctx, "WebhookRepo.UpdateWebhook", query)
+	defer span.End()
+
+	var row webhookRow
+	if err := w.db.QueryRowxContext(ctx, query, args...).StructScan(&row); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Webhook{}, models.ErrWebhookNotFound
+		}
+		tracing.RecordError(span, err)
+		logger.Errorw("Failed to execute UpdateWebhook query", "error", err)
+		return models.Webhook{}, err
+	}
+	return row.model()
+}
+
+func (w *WebhookRepo) DeleteWebhook(ctx context.Context, webhookID int) error {
+	logger := logging.FromContext(ctx, w.logger)
+
+	query, args, err := sq.Delete("webhooks").
+		Where(sq.Eq{"id": webhookID}).
+		ToSql()
+	if err != nil {
+		logger.Errorw("Failed to build SQL query for DeleteWebhook", "error", err)
+		return err
+	}
+
+	ctx, span := tracing.StartQuery(ctx, "WebhookRepo.DeleteWebhook", query)
+	defer span.End()
+
+	res, err := w.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		tracing.RecordError(span, err)
+		logger.Errorw("Failed to execute DeleteWebhook query", "error", err)
+		return err
+	}
+	if affected, err := res.RowsAffected(); err == nil && affected == 0 {
+		return models.ErrWebhookNotFound
+	}
+	return nil
+}
+
+func (w *WebhookRepo) ListDeliveries(ctx context.Context, filter models.DeliveryFilter) ([]models.WebhookDelivery, error) {
+	logger := logging.FromContext(ctx, w.logger)
+
+	builder := sq.Select(deliveryColumns...).
+		From("webhook_deliveries").
+		Where(sq.Eq{"webhook_id": filter.WebhookID}).
+		OrderBy("id DESC")
+	if filter.Status != "" {
+		builder = builder.Where(sq.Eq{"status": filter.Status})
+	}
+	if filter.Limit > 0 {
+		builder = builder.Limit(filter.Limit)
+	}
+	if filter.Offset > 0 {
+		builder = builder.Offset(filter.Offset)
+	}
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		logger.Errorw("Failed to build SQL query for ListDeliveries", "error", err)
+		return nil, err
+	}
+
+	ctx, span := tracing.StartQuery(ctx, "WebhookRepo.ListDeliveries", query)
+	defer span.End()
+
+	var rows []deliveryRow
+	if err := w.db.SelectContext(ctx, &rows, query, args...); err != nil {
+		tracing.RecordError(span, err)
+		logger.Errorw("Failed to execute ListDeliveries query", "error", err)
+		return nil, err
+	}
+
+	deliveries := make([]models.WebhookDelivery, 0, len(rows))
+	for _, row := range rows {
+		deliveries = append(deliveries, row.model())
+	}
+	return deliveries, nil
+}
+
+func (w *WebhookRepo) Redeliver(ctx context.Context, webhookID int, deliveryID int64) (models.WebhookDelivery, error) {
+	logger := logging.FromContext(ctx, w.logger)
+
+	query, args, err := sq.Update("webhook_deliveries").
+		Set("status", models.DeliveryPending).
+		Set("attempts", 0).
+		Set("next_attempt_at", now()).
+		Set("delivered_at", nil).
+		Where(sq.Eq{"id": deliveryID, "webhook_id": webhookID}).
+		Suffix("RETURNING " + strings.Join(deliveryColumns, ", ")).
+		ToSql()
+	if err != nil {
+		logger.Errorw("Failed to build SQL query for Redeliver", "error", err)
+		return models.WebhookDelivery{}, err
+	}
+
+	ctx, span := tracing.StartQuery(ctx, "WebhookRepo.Redeliver", query)
+	defer span.End()
+
+	var row deliveryRow
+	if err := w.db.QueryRowxContext(ctx, query, args...).StructScan(&row); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.WebhookDelivery{}, models.ErrDeliveryNotFound
+		}
+		tracing.RecordError(span, err)
+		logger.Errorw("Failed to execute Redeliver query", "error", err)
+		return models.WebhookDelivery{}, err
+	}
+	return row.model(), nil
+}
+
+func (w *WebhookRepo) DeleteDeliveriesBefore(ctx context.Context, before time.Time) (int64, error) {
+	logger := logging.FromContext(ctx, w.logger)
+
+	query, args, err := sq.Delete("webhook_deliveries").
+		Where(sq.Lt{"created_at": before.UTC()}).
+		Where(sq.NotEq{"status": models.DeliveryPending}).
+		ToSql()
+	if err != nil {
+		logger.Errorw("Failed to build SQL query for DeleteDeliveriesBefore", "error", err)
+		return 0, err
+	}
+
+	ctx, span := tracing.StartQuery(ctx, "WebhookRepo.DeleteDeliveriesBefore", query)
+	defer span.End()
+
+	res, err := w.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		tracing.RecordError(span, err)
+		logger.Errorw("Failed to execute DeleteDeliveriesBefore query", "error", err)
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (w *WebhookRepo) Enqueue(ctx context.Context, deliveries ...models.WebhookDelivery) error {
+	logger := logging.FromContext(ctx, w.logger)
+
+	queuedAt := now()
+	builder := sq.Insert("webhook_deliveries").
+		Columns("webhook_id", "event_id", "event_type", "payload", "status", "next_attempt_at", "created_at")
+	for _, delivery := range deliveries {
+		builder = builder.Values(delivery.WebhookID, delivery.EventID, delivery.EventType, jsonText(delivery.Payload),
+			models.DeliveryPending, queuedAt, queuedAt)
+	}
+	query, args, err := builder.
+		Suffix("ON CONFLICT (webhook_id, event_id) DO NOTHING").
+		ToSql()
+	if err != nil {
+		logger.Errorw("Failed to build SQL query for Enqueue", "error", err)
+		return err
+	}
+
+	ctx, span := tracing.StartQuery(ctx, "WebhookRepo.Enqueue", query)
+	defer span.End()
+
+	if _, err := w.db.ExecContext(ctx, query, args...); err != nil {
+		tracing.RecordError(span, err)
+		logger.Errorw("Failed to execute Enqueue query", "error", err)
+		return err
+	}
+	return nil
+}
+
+// claimQuery pushes the due deliveries back by the lease while they are
+// attempted; the database file belongs to one process, so nothing else
+// claims them meanwhile.
+var claimQuery = `
+UPDATE webhook_deliveries SET next_attempt_at = ?3
+WHERE id IN (
+    SELECT d.id FROM webhook_deliveries d
+    JOIN webhooks w ON w.id = d.webhook_id
+    WHERE d.status = 'pending' AND d.next_attempt_at <= ?2 AND w.active
+    ORDER BY d.next_attempt_at, d.id
+    LIMIT ?1
+)
+RETURNING ` + strings.Join(deliveryColumns, ", ")
+
+func (w *WebhookRepo) Claim(ctx context.Context, limit int, lease time.Duration) ([]models.WebhookDelivery, error) {
+	logger := logging.FromContext(ctx, w.logger)
+
+	ctx, span := tracing.StartQuery(ctx, "WebhookRepo.Claim", claimQuery)
+	defer span.End()
+
+	claimedAt := now()
+	var rows []deliveryRow
+	if err := w.db.SelectContext(ctx, &rows, claimQuery, limit, claimedAt, claimedAt.Add(lease)); err != nil {
+		tracing.RecordError(span, err)
+		logger.Errorw("Failed to execute Claim query", "error", err)
+		return nil, err
+	}
+
+	deliveries := make([]models.WebhookDelivery, 0, len(rows))
+	for _, row := range rows {
+		deliveries = append(deliveries, row.model())
+	}
+	return deliveries, nil
+}
+
+func (w *WebhookRepo) RecordAttempt(ctx context.Context, attempt models.DeliveryAttempt) error {
+	logger := logging.FromContext(ctx, w.logger)
+
+	attemptedAt := attempt.AttemptedAt.UTC()
+	var nextAttemptAt *time.Time
+	if attempt.NextAttemptAt != nil {
+		next := attempt.NextAttemptAt.UTC()
+		nextAttemptAt = &next
+	}
+
+	builder := sq.Update("webhook_deliveries").
+		Set("status", attempt.Status).
+		Set("attempts", sq.Expr("attempts + 1")).
+		Set("last_attempt_at", attemptedAt).
+		Set("next_attempt_at", nextAttemptAt).
+		Set("response_status", nullInt(attempt.ResponseStatus)).
+		Set("last_error", nullString(attempt.Error)).
+		Where(sq.Eq{"id": attempt.DeliveryID})
+	if attempt.Status == models.DeliveryDelivered {
+		builder = builder.Set("delivered_at", attemptedAt)
+	}
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		logger.Errorw("Failed to build SQL query for RecordAttempt", "error", err)
+		return err
+	}
+
+	ctx, span := tracing.StartQuery(ctx, "WebhookRepo.RecordAttempt", query)
+	defer span.End()
+
+	if _, err := w.db.ExecContext(ctx, query, args...); err != nil {
+		tracing.RecordError(span, err)
+		logger.Errorw("Failed to execute RecordAttempt query", "error", err)
+		return err
+	}
+	return nil
+}
+
+func nullInt(n int) *int {
+	if n == 0 {
+		return nil
+	}
+	return &n
+}
+
+func nullString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
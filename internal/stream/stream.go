@@ -0,0 +1,280 @@
+// Package stream fans song changes out to the clients following
+// GET /api/songs/events.
+//
+// Every replica tails the audit log on its own, so a client sees all changes
+// whichever replica it is connected to, and event IDs are audit event IDs on
+// all of them. The Hub keeps the latest events in a bounded log for clients
+// resuming with Last-Event-ID and hands new ones to each subscriber through a
+// buffered channel without waiting: a subscriber whose buffer is full is
+// dropped, and its client reconnects and resumes from the log, so slow
+// clients never hold up the poll loop or the writers behind it.
+package stream
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"go.uber.org/zap"
+	"slices"
+	"song-lib/internal/models"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrNotReady = errors.New("event stream is not ready yet")
+	ErrClosed   = errors.New("event stream is closed")
+)
+
+// Source is the audit log of the configured storage.
+type Source interface {
+	ListEvents(ctx context.Context, filter models.AuditFilter) ([]models.AuditEvent, error)
+	EventsAfter(ctx context.Context, afterID int64, limit uint64) ([]models.AuditEvent, error)
+}
+
+type Options struct {
+	// LogSize is the number of events kept for resuming clients.
+	LogSize int
+	// Buffer is the number of events a subscriber may fall behind by before
+	// it is dropped.
+	Buffer int
+	// GapTimeout is how long an event is held back behind a lower ID that
+	// has not shown up yet, which is usually a transaction still committing.
+	GapTimeout time.Duration
+}
+
+type Stats struct {
+	Subscribers int   `json:"subscribers"`
+	Dropped     int64 `json:"dropped"`
+	Logged      int   `json:"logged"`
+	LastEventID int64 `json:"last_event_id"`
+}
+
+type entry struct {
+	event models.OutboxEvent
+	// artists are the artists of the song before and after the change.
+	artists []string
+}
+
+// Subscription is one client following the stream.
+type Subscription struct {
+	// Backlog holds the logged events after the Last-Event-ID of the client,
+	// to be sent before those from Events.
+	Backlog []models.OutboxEvent
+	// Reset is set when the Last-Event-ID is older than the log, so some
+	// changes since then can no longer be sent.
+	Reset bool
+	// Events is closed when the subscriber falls too far behind or the hub
+	// is closed.
+	Events <-chan models.OutboxEvent
+
+	events  chan models.OutboxEvent
+	artists []string
+}
+
+func (s *Subscription) matches(e entry) bool {
+	if len(s.artists) == 0 {
+		return true
+	}
+	return slices.ContainsFunc(s.artists, func(artist string) bool {
+		return slices.ContainsFunc(e.artists, func(songArtist string) bool {
+			return strings.EqualFold(artist, songArtist)
+		})
+	})
+}
+
+type Hub struct {
+	source Source
+	opts   Options
+	logger *zap.SugaredLogger
+
+	mu      sync.Mutex
+	started bool
+	closed  bool
+	log     []entry
+	// evicted is the ID of the newest event no longer in the log.
+	evicted     int64
+	cursor      int64
+	gapSince    time.Time
+	subscribers map[*Subscription]struct{}
+	dropped     int64
+}
+
+func NewHub(source Source, opts Options, logger *zap.SugaredLogger) *Hub {
+	return &Hub{
+		source:      source,
+		opts:        opts,
+		logger:      logger,
+		subscribers: make(map[*Subscription]struct{}),
+	}
+}
+
+// Subscribe registers a subscriber for the events after lastEventID, or for
+// new events only if lastEventID is negative. Artists, if any, limit it to changes
+// of songs by those artists.
+func (h *Hub) Subscribe(lastEventID int64, artists []string) (*Subscription, error) {
+	events := make(chan models.OutboxEvent, h.opts.Buffer)
+	sub := &Subscription{Events: events, events: events, artists: artists}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	switch {
+	case h.closed:
+		return nil, ErrClosed
+	case !h.started:
+		return nil, ErrNotReady
+	}
+	if lastEventID >= 0 {
+		sub.Reset = lastEventID < h.evicted
+		for _, e := range h.log {
+			if e.event.ID > lastEventID && sub.matches(e) {
+				sub.Backlog = append(sub.Backlog, e.event)
+			}
+		}
+	}
+	h.subscribers[sub] = struct{}{}
+	return sub, nil
+}
+
+// Unsubscribe removes a subscriber whose client went away.
+func (h *Hub) Unsubscribe(sub *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.subscribers[sub]; ok {
+		delete(h.subscribers, sub)
+		close(sub.events)
+	}
+}
+
+// Poll reads the audit events written since the last call and publishes
+// them, and returns how many it published. The first call fills the log
+// with the latest events instead; subscribing fails until it succeeds.
+func (h *Hub) Poll(ctx context.Context) (int, error) {
+	h.mu.Lock()
+	started, cursor := h.started, h.cursor
+	h.mu.Unlock()
+
+	if !started {
+		return 0, h.fill(ctx)
+	}
+
+	auditEvents, err := h.source.EventsAfter(ctx, cursor, uint64(h.opts.LogSize))
+	if err != nil {
+		return 0, err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := time.Now()
+	published := 0
+	for _, auditEvent := range auditEvents {
+		if auditEvent.ID != h.cursor+1 && h.cursor > 0 {
+			if h.gapSince.IsZero() {
+				h.gapSince = now
+			}
+			if now.Sub(h.gapSince) < h.opts.GapTimeout {
+				break
+			}
+		}
+		h.gapSince = time.Time{}
+		h.publish(newEntry(auditEvent))
+		published++
+	}
+	return published, nil
+}
+
+func (h *Hub) fill(ctx context.Context) error {
+	auditEvents, err := h.source.ListEvents(ctx, models.AuditFilter{Limit: uint64(h.opts.LogSize)})
+	if err != nil {
+		return err
+	}
+	slices.SortFunc(auditEvents, func(a, b models.AuditEvent) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(auditEvents) == h.opts.LogSize {
+		// Older events may exist that did not fit.
+		h.evicted = auditEvents[0].ID - 1
+	}
+	for _, auditEvent := range auditEvents {
+		h.append(newEntry(auditEvent))
+	}
+	h.started = true
+	return nil
+}
+
+func newEntry(auditEvent models.AuditEvent) entry {
+	event := models.NewOutboxEvent(auditEvent)
+	event.ID = auditEvent.ID
+
+	e := entry{event: event}
+	for _, data := range []json.RawMessage{auditEvent.Before, auditEvent.After} {
+		var song models.Song
+		if len(data) > 0 && json.Unmarshal(data, &song) == nil && !slices.Contains(e.artists, song.Artist) {
+			e.artists = append(e.artists, song.Artist)
+		}
+	}
+	return e
+}
+
+// append adds the event to the log; h.mu must be held.
+func (h *Hub) append(e entry) {
+	h.log = append(h.log, e)
+	if len(h.log) > h.opts.LogSize {
+		h.evicted = h.log[0].event.ID
+		h.log = h.log[1:]
+	}
+	h.cursor = e.event.ID
+}
+
+// publish logs the event and hands it to the matching subscribers; h.mu
+// must be held.
+func (h *Hub) publish(e entry) {
+	h.append(e)
+	for sub := range h.subscribers {
+		if !sub.matches(e) {
+			continue
+		}
+		select {
+		case sub.events <- e.event:
+		default:
+			delete(h.subscribers, sub)
+			close(sub.events)
+			h.dropped++
+			h.logger.Infow("dropped slow event stream subscriber", "eventID", e.event.ID)
+		}
+	}
+}
+
+// Close ends every subscription and refuses new ones, so that open streams
+// do not hold up shutdown.
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.closed = true
+	for sub := range h.subscribers {
+		delete(h.subscribers, sub)
+		close(sub.events)
+	}
+}
+
+func (h *Hub) Stats() Stats {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return Stats{
+		Subscribers: len(h.subscribers),
+		Dropped:     h.dropped,
+		Logged:      len(h.log),
+		LastEventID: h.cursor,
+	}
+}
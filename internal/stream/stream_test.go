@@ -0,0 +1,274 @@
+package stream_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"slices"
+	"song-lib/internal/models"
+	"song-lib/internal/stream"
+	"sync"
+	"testing"
+	"time"
+)
+
+// source is an audit log the test appends to, with gaps where it leaves IDs
+// out.
+type source struct {
+	mu     sync.Mutex
+	events []models.AuditEvent
+}
+
+func (s *source) add(id int64, artist string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	after, _ := json.Marshal(models.Song{ID: int(id), Artist: artist, Title: fmt.Sprint("Song ", id)})
+	s.events = append(s.events, models.AuditEvent{ID: id, Action: models.AuditCreate, SongID: int(id), After: after})
+	slices.SortFunc(s.events, func(a, b models.AuditEvent) int { return int(a.ID - b.ID) })
+}
+
+// ListEvents returns the latest events first, like the repositories.
+func (s *source) ListEvents(_ context.Context, filter models.AuditFilter) ([]models.AuditEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	events := slices.Clone(s.events)
+	slices.Reverse(events)
+	return events[:min(int(filter.Limit), len(events))], nil
+}
+
+func (s *source) EventsAfter(_ context.Context, afterID int64, limit uint64) ([]models.AuditEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var events []models.AuditEvent
+	for _, event := range s.events {
+		if event.ID > afterID && uint64(len(events)) < limit {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+func newHub(t *testing.T, src *source, opts stream.Options) *stream.Hub {
+	t.Helper()
+
+	hub := stream.NewHub(src, opts, zap.NewNop().Sugar())
+	t.Cleanup(hub.Close)
+	poll(t, hub)
+	return hub
+}
+
+func poll(t *testing.T, hub *stream.Hub) int {
+	t.Helper()
+
+	published, err := hub.Poll(context.Background())
+	if err != nil {
+		t.Fatalf("Poll: %v", err)
+	}
+	return published
+}
+
+func subscribe(t *testing.T, hub *stream.Hub, lastEventID int64, artists ...string) *stream.Subscription {
+	t.Helper()
+
+	sub, err := hub.Subscribe(lastEventID, artists)
+	if err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+	return sub
+}
+
+func ids(events []models.OutboxEvent) []int64 {
+	var ids []int64
+	for _, event := range events {
+		ids = append(ids, event.ID)
+	}
+	return ids
+}
+
+// received drains what is buffered for sub without waiting.
+func received(sub *stream.Subscription) (events []models.OutboxEvent, open bool) {
+	for {
+		select {
+		case event, ok := <-sub.Events:
+			if !ok {
+				return events, false
+			}
+			events = append(events, event)
+		default:
+			return events, true
+		}
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	src := &source{}
+	for id := range int64(5) {
+		src.add(id+1, "Muse")
+	}
+
+	hub := stream.NewHub(src, stream.Options{LogSize: 3, Buffer: 10}, zap.NewNop().Sugar())
+	if _, err := hub.Subscribe(-1, nil); !errors.Is(err, stream.ErrNotReady) {
+		t.Errorf("Subscribe before the first Poll error = %v, want ErrNotReady", err)
+	}
+	poll(t, hub)
+
+	for _, tc := range []struct {
+		lastEventID int64
+		backlog     []int64
+		reset       bool
+	}{
+		{lastEventID: -1},
+		{lastEventID: 5},
+		{lastEventID: 4, backlog: []int64{5}},
+		{lastEventID: 2, backlog: []int64{3, 4, 5}},
+		{lastEventID: 1, backlog: []int64{3, 4, 5}, reset: true},
+		{lastEventID: 0, backlog: []int64{3, 4, 5}, reset: true},
+	} {
+		sub := subscribe(t, hub, tc.lastEventID)
+		if got := ids(sub.Backlog); !slices.Equal(got, tc.backlog) || sub.Reset != tc.reset {
+			t.Errorf("Subscribe(%d) backlog = %v, reset = %v; want %v, %v", tc.lastEventID, got, sub.Reset, tc.backlog, tc.reset)
+		}
+		hub.Unsubscribe(sub)
+	}
+
+	// Events after the log was filled evict the oldest.
+	src.add(6, "Muse")
+	poll(t, hub)
+	if sub := subscribe(t, hub, 2); !slices.Equal(ids(sub.Backlog), []int64{4, 5, 6}) || !sub.Reset {
+		t.Errorf("Subscribe(2) after event 6 backlog = %v, reset = %v; want [4 5 6] with a reset", ids(sub.Backlog), sub.Reset)
+	}
+
+	hub.Close()
+	if _, err := hub.Subscribe(-1, nil); !errors.Is(err, stream.ErrClosed) {
+		t.Errorf("Subscribe after Close error = %v, want ErrClosed", err)
+	}
+}
+
+func TestArtistFilter(t *testing.T) {
+	src := &source{}
+	src.add(1, "Muse")
+	src.add(2, "Queen")
+	hub := newHub(t, src, stream.Options{LogSize: 10, Buffer: 10})
+
+	if sub := subscribe(t, hub, 0, "muse"); !slices.Equal(ids(sub.Backlog), []int64{1}) {
+		t.Errorf("backlog for muse = %v, want [1]", ids(sub.Backlog))
+	}
+
+	sub := subscribe(t, hub, -1, "MUSE", "Radiohead")
+	src.add(3, "Queen")
+	src.add(4, "Muse")
+	src.add(5, "Radiohead")
+
+	// A song moved from Muse to Queen is a change of both.
+	before, _ := json.Marshal(models.Song{ID: 6, Artist: "Muse"})
+	after, _ := json.Marshal(models.Song{ID: 6, Artist: "Queen"})
+	src.mu.Lock()
+	src.events = append(src.events, models.AuditEvent{ID: 6, Action: models.AuditUpdate, SongID: 6, Before: before, After: after})
+	src.mu.Unlock()
+
+	poll(t, hub)
+	if events, _ := received(sub); !slices.Equal(ids(events), []int64{4, 5, 6}) {
+		t.Errorf("received %v, want [4 5 6]", ids(events))
+	}
+}
+
+func TestSlowSubscriberDropped(t *testing.T) {
+	src := &source{}
+	hub := newHub(t, src, stream.Options{LogSize: 10, Buffer: 2})
+
+	slow := subscribe(t, hub, -1)
+	fast := subscribe(t, hub, -1)
+	for id := range int64(2) {
+		src.add(id+1, "Muse")
+	}
+	poll(t, hub)
+	if events, _ := received(fast); len(events) != 2 {
+		t.Fatalf("fast subscriber received %v, want 2 events", ids(events))
+	}
+
+	// The slow subscriber has not read anything and is full.
+	src.add(3, "Muse")
+	done := make(chan int)
+	go func() {
+		published, _ := hub.Poll(context.Background())
+		done <- published
+	}()
+	select {
+	case published := <-done:
+		if published != 1 {
+			t.Errorf("Poll = %d, want 1", published)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Poll blocked on a full subscriber")
+	}
+
+	if events, open := received(slow); open || !slices.Equal(ids(events), []int64{1, 2}) {
+		t.Errorf("slow subscriber received %v, open = %v; want [1 2] and closed", ids(events), open)
+	}
+	if events, open := received(fast); !open || !slices.Equal(ids(events), []int64{3}) {
+		t.Errorf("fast subscriber received %v, open = %v; want [3] and still open", ids(events), open)
+	}
+	if stats := hub.Stats(); stats.Dropped != 1 || stats.Subscribers != 1 {
+		t.Errorf("Stats = %+v, want the slow subscriber dropped", stats)
+	}
+
+	// A dropped client resumes from the log.
+	if sub := subscribe(t, hub, 2); !slices.Equal(ids(sub.Backlog), []int64{3}) || sub.Reset {
+		t.Errorf("resumed backlog = %v, reset = %v; want [3]", ids(sub.Backlog), sub.Reset)
+	}
+}
+
+func TestGap(t *testing.T) {
+	t.Run("HeldBackUntilFilled", func(t *testing.T) {
+		src := &source{}
+		src.add(1, "Muse")
+		hub := newHub(t, src, stream.Options{LogSize: 10, Buffer: 10, GapTimeout: time.Minute})
+		sub := subscribe(t, hub, -1)
+
+		// Event 2 is still being committed.
+		src.add(3, "Muse")
+		if published := poll(t, hub); published != 0 {
+			t.Fatalf("Poll with a gap = %d, want 0", published)
+		}
+
+		src.add(2, "Muse")
+		if published := poll(t, hub); published != 2 {
+			t.Fatalf("Poll after the gap filled = %d, want 2", published)
+		}
+		if events, _ := received(sub); !slices.Equal(ids(events), []int64{2, 3}) {
+			t.Errorf("received %v, want [2 3] in order", ids(events))
+		}
+	})
+
+	t.Run("ReleasedAfterGapTimeout", func(t *testing.T) {
+		src := &source{}
+		src.add(1, "Muse")
+		hub := newHub(t, src, stream.Options{LogSize: 10, Buffer: 10, GapTimeout: 50 * time.Millisecond})
+		sub := subscribe(t, hub, -1)
+
+		// Event 2 was rolled back and never shows up.
+		src.add(3, "Muse")
+		src.add(4, "Muse")
+		if published := poll(t, hub); published != 0 {
+			t.Fatalf("Poll with a gap = %d, want 0", published)
+		}
+		time.Sleep(60 * time.Millisecond)
+		if published := poll(t, hub); published != 2 {
+			t.Fatalf("Poll after GapTimeout = %d, want 2", published)
+		}
+		if events, _ := received(sub); !slices.Equal(ids(events), []int64{3, 4}) {
+			t.Errorf("received %v, want [3 4]", ids(events))
+		}
+
+		// A gap is waited for once: the next one starts its own timeout.
+		src.add(6, "Muse")
+		if published := poll(t, hub); published != 0 {
+			t.Errorf("Poll with a new gap = %d, want 0", published)
+		}
+	})
+}
@@ -0,0 +1,67 @@
+package usecase
+
+import (
+	"context"
+	"go.uber.org/zap"
+	"song-lib/internal/auth"
+	"song-lib/internal/logging"
+	"song-lib/internal/models"
+	"song-lib/internal/usecase/apikey"
+)
+
+type APIKeyUseCase struct {
+	Repo   apikey.Repository
+	logger *zap.SugaredLogger
+}
+
+func NewAPIKeyInstance(repo apikey.Repository, logger *zap.SugaredLogger) *APIKeyUseCase {
+	return &APIKeyUseCase{Repo: repo, logger: logger}
+}
+
+// CreateKey returns the plaintext key alongside the stored record; the
+// plaintext is not persisted and cannot be recovered later.
+func (a *APIKeyUseCase) CreateKey(ctx context.Context, name string, scopes []string) (string, models.APIKey, error) {
+	logger := logging.FromContext(ctx, a.logger)
+
+	if err := auth.ValidateScopes(scopes); err != nil {
+		return "", models.APIKey{}, err
+	}
+
+	plain, prefix, hash, err := auth.GenerateKey()
+	if err != nil {
+		logger.Errorw("Failed to generate api key", "error", err)
+		return "", models.APIKey{}, err
+	}
+
+	key, err := a.Repo.CreateKey(ctx, models.APIKey{Name: name, Prefix: prefix, Scopes: scopes}, hash)
+	if err != nil {
+		logger.Errorw("Failed to store api key", "name", name, "error", err)
+		return "", models.APIKey{}, err
+	}
+
+	logger.Infow("API key created", "keyID", key.ID, "name", name, "scopes", scopes)
+	return plain, key, nil
+}
+
+func (a *APIKeyUseCase) ListKeys(ctx context.Context) ([]models.APIKey, error) {
+	return a.Repo.ListKeys(ctx)
+}
+
+func (a *APIKeyUseCase) RevokeKey(ctx context.Context, keyID int) error {
+	logger := logging.FromContext(ctx, a.logger)
+
+	if err := a.Repo.RevokeKey(ctx, keyID); err != nil {
+		logger.Errorw("Failed to revoke api key", "keyID", keyID, "error", err)
+		return err
+	}
+
+	logger.Infow("API key revoked", "keyID", keyID)
+	return nil
+}
+
+func (a *APIKeyUseCase) Authenticate(ctx context.Context, key string) (models.APIKey, error) {
+	if !auth.IsAPIKey(key) {
+		return models.APIKey{}, models.ErrAPIKeyNotFound
+	}
+	return a.Repo.Authenticate(ctx, auth.HashKey(key))
+}
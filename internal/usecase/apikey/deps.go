@@ -0,0 +1,13 @@
+package apikey
+
+import (
+	"context"
+	"song-lib/internal/models"
+)
+
+type Repository interface {
+	CreateKey(ctx context.Context, key models.APIKey, hash string) (models.APIKey, error)
+	ListKeys(ctx context.Context) ([]models.APIKey, error)
+	RevokeKey(ctx context.Context, keyID int) error
+	Authenticate(ctx context.Context, hash string) (models.APIKey, error)
+}
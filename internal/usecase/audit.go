@@ -0,0 +1,47 @@
+package usecase
+
+import (
+	"context"
+	"go.uber.org/zap"
+	"song-lib/internal/logging"
+	"song-lib/internal/models"
+	"song-lib/internal/usecase/audit"
+	"time"
+)
+
+type AuditUseCase struct {
+	Repo   audit.Repository
+	logger *zap.SugaredLogger
+}
+
+func NewAuditInstance(repo audit.Repository, logger *zap.SugaredLogger) *AuditUseCase {
+	return &AuditUseCase{Repo: repo, logger: logger}
+}
+
+func (a *AuditUseCase) ListEvents(ctx context.Context, filter models.AuditFilter) ([]models.AuditEvent, error) {
+	logger := logging.FromContext(ctx, a.logger)
+
+	events, err := a.Repo.ListEvents(ctx, filter)
+	if err != nil {
+		logger.Errorw("Failed to list audit events", "filter", filter, "error", err)
+		return nil, err
+	}
+	return events, nil
+}
+
+// EventsAfter returns up to limit events following afterID, oldest first.
+func (a *AuditUseCase) EventsAfter(ctx context.Context, afterID int64, limit uint64) ([]models.AuditEvent, error) {
+	logger := logging.FromContext(ctx, a.logger)
+
+	events, err := a.Repo.EventsAfter(ctx, afterID, limit)
+	if err != nil {
+		logger.Errorw("Failed to read audit events", "afterID", afterID, "error", err)
+		return nil, err
+	}
+	return events, nil
+}
+
+// PurgeExpired deletes audit events older than retention.
+func (a *AuditUseCase) PurgeExpired(ctx context.Context, retention time.Duration) (int64, error) {
+	return a.Repo.DeleteBefore(ctx, time.Now().Add(-retention))
+}
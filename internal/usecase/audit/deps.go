@@ -0,0 +1,15 @@
+package audit
+
+import (
+	"context"
+	"song-lib/internal/models"
+	"time"
+)
+
+type Repository interface {
+	ListEvents(ctx context.Context, filter models.AuditFilter) ([]models.AuditEvent, error)
+	// EventsAfter returns up to limit events with IDs above afterID, oldest
+	// first.
+	EventsAfter(ctx context.Context, afterID int64, limit uint64) ([]models.AuditEvent, error)
+	DeleteBefore(ctx context.Context, before time.Time) (int64, error)
+}
@@ -2,35 +2,50 @@ package usecase
 
 import (
 	"context"
+	"go.opentelemetry.io/otel/attribute"
 	"go.uber.org/zap"
-	"song-lib/internal/externalAPI"
+	"song-lib/internal/auth"
+	"song-lib/internal/logging"
 	"song-lib/internal/models"
+	"song-lib/internal/tracing"
 	"song-lib/internal/usecase/song"
 )
 
 type SongUseCase struct {
 	Repo        song.Repository
-	ExternalAPI externalAPI.Client
+	Tx          song.Transactor
+	ExternalAPI song.DetailsProvider
 	logger      *zap.SugaredLogger
 }
 
-func NewSongInstance(repo song.Repository, externalAPI externalAPI.Client, logger *zap.SugaredLogger) *SongUseCase {
-	return &SongUseCase{Repo: repo, ExternalAPI: externalAPI, logger: logger}
+func NewSongInstance(repo song.Repository, tx song.Transactor, externalAPI song.DetailsProvider, logger *zap.SugaredLogger) *SongUseCase {
+	return &SongUseCase{Repo: repo, Tx: tx, ExternalAPI: externalAPI, logger: logger}
 }
 
 func (s *SongUseCase) Exist(ctx context.Context, songID int) bool {
-	s.logger.Debugw("Checking if song exists", "songID", songID)
+	ctx, span := tracing.Start(ctx, "SongUseCase.Exist", attribute.Int("song.id", songID))
+	defer span.End()
+
+	logger := logging.FromContext(ctx, s.logger)
+	logger.Debugw("Checking if song exists", "songID", songID)
 	exists := s.Repo.Exist(ctx, songID)
-	s.logger.Debugw("Song existence check completed", "songID", songID, "exists", exists)
+	logger.Debugw("Song existence check completed", "songID", songID, "exists", exists)
 	return exists
 }
 
-func (s *SongUseCase) AddSong(ctx context.Context, group string, songTitle string) error {
-	s.logger.Infow("Adding new song", "group", group, "songTitle", songTitle)
+func (s *SongUseCase) AddSong(ctx context.Context, group string, songTitle string) (err error) {
+	ctx, span := tracing.Start(ctx, "SongUseCase.AddSong", attribute.String("song.artist", group), attribute.String("song.title", songTitle))
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	logger := logging.FromContext(ctx, s.logger)
+	logger.Infow("Adding new song", "group", group, "songTitle", songTitle)
 
 	externalData, err := s.ExternalAPI.GetSongDetails(ctx, group, songTitle)
 	if err != nil {
-		s.logger.Errorw("Failed to fetch song details from external API", "group", group, "songTitle", songTitle, "error", err)
+		logger.Errorw("Failed to fetch song details from external API", "group", group, "songTitle", songTitle, "error", err)
 		return err
 	}
 
@@ -41,65 +56,190 @@ func (s *SongUseCase) AddSong(ctx context.Context, group string, songTitle strin
 		Text:        externalData.Text,
 		SourceLink:  externalData.Link,
 	}
+	if principal, ok := auth.PrincipalFrom(ctx); ok && principal.UserID != 0 {
+		songInstance.CreatedBy = &principal.UserID
+		songInstance.UpdatedBy = &principal.UserID
+	}
 
 	err = s.Repo.CreateSong(ctx, songInstance)
 	if err != nil {
-		s.logger.Errorw("Failed to add song to the database", "song", songInstance, "error", err)
+		logger.Errorw("Failed to add song to the database", "song", songInstance, "error", err)
 		return err
 	}
 
-	s.logger.Infow("Song added successfully", "song", songInstance)
+	logger.Infow("Song added successfully", "song", songInstance)
 	return nil
 }
 
-func (s *SongUseCase) ChangeSong(ctx context.Context, song models.Song) error {
-	s.logger.Infow("Updating song", "songID", song.ID, "title", song.Title)
-
-	err := s.Repo.ChangeSong(ctx, song)
+func (s *SongUseCase) ChangeSong(ctx context.Context, song models.Song) (err error) {
+	ctx, span := tracing.Start(ctx, "SongUseCase.ChangeSong", attribute.Int("song.id", song.ID))
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	logger := logging.FromContext(ctx, s.logger)
+	logger.Infow("Updating song", "songID", song.ID, "title", song.Title)
+
+	// The policy check reads the owner in the same transaction as the update.
+	err = s.Tx.WithTx(ctx, func(ctx context.Context) error {
+		principal, err := s.authorize(ctx, song.ID)
+		if err != nil {
+			return err
+		}
+		song.UpdatedBy = nil
+		if principal.UserID != 0 {
+			song.UpdatedBy = &principal.UserID
+		}
+
+		err = s.Repo.ChangeSong(ctx, song)
+		if err != nil {
+			logger.Errorw("Failed to update song", "songID", song.ID, "title", song.Title, "error", err)
+		}
+		return err
+	})
 	if err != nil {
-		s.logger.Errorw("Failed to update song", "songID", song.ID, "title", song.Title, "error", err)
 		return err
 	}
 
-	s.logger.Infow("Song updated successfully", "songID", song.ID, "title", song.Title)
+	logger.Infow("Song updated successfully", "songID", song.ID, "title", song.Title)
 	return nil
 }
 
-func (s *SongUseCase) DeleteSong(ctx context.Context, songID int) error {
-	s.logger.Infow("Deleting song", "songID", songID)
+func (s *SongUseCase) DeleteSong(ctx context.Context, songID int) (err error) {
+	ctx, span := tracing.Start(ctx, "SongUseCase.DeleteSong", attribute.Int("song.id", songID))
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	logger := logging.FromContext(ctx, s.logger)
+	logger.Infow("Deleting song", "songID", songID)
+
+	err = s.Tx.WithTx(ctx, func(ctx context.Context) error {
+		if _, err := s.authorize(ctx, songID); err != nil {
+			return err
+		}
+
+		err := s.Repo.DeleteSong(ctx, songID)
+		if err != nil {
+			logger.Errorw("Failed to delete song", "songID", songID, "error", err)
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	logger.Infow("Song deleted successfully", "songID", songID)
+	return nil
+}
 
-	err := s.Repo.DeleteSong(ctx, songID)
+// RestoreSong brings back a deleted song from the snapshot recorded in the
+// audit log when it was deleted.
+func (s *SongUseCase) RestoreSong(ctx context.Context, songID int) (err error) {
+	ctx, span := tracing.Start(ctx, "SongUseCase.RestoreSong", attribute.Int("song.id", songID))
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	logger := logging.FromContext(ctx, s.logger)
+	logger.Infow("Restoring song", "songID", songID)
+
+	err = s.Tx.WithTx(ctx, func(ctx context.Context) error {
+		deleted, err := s.Repo.GetDeletedSong(ctx, songID)
+		if err != nil {
+			logger.Errorw("Failed to find deleted song", "songID", songID, "error", err)
+			return err
+		}
+		principal, err := s.checkPolicy(ctx, deleted)
+		if err != nil {
+			return err
+		}
+		deleted.UpdatedBy = nil
+		if principal.UserID != 0 {
+			deleted.UpdatedBy = &principal.UserID
+		}
+
+		err = s.Repo.RestoreSong(ctx, deleted)
+		if err != nil {
+			logger.Errorw("Failed to restore song", "songID", songID, "error", err)
+		}
+		return err
+	})
 	if err != nil {
-		s.logger.Errorw("Failed to delete song", "songID", songID, "error", err)
 		return err
 	}
 
-	s.logger.Infow("Song deleted successfully", "songID", songID)
+	logger.Infow("Song restored successfully", "songID", songID)
 	return nil
 }
 
-func (s *SongUseCase) GetSongs(ctx context.Context, filter models.SongFilter) ([]models.Song, error) {
-	s.logger.Infow("Retrieving songs", "filter", filter)
+func (s *SongUseCase) GetSongs(ctx context.Context, filter models.SongFilter) (_ []models.Song, err error) {
+	ctx, span := tracing.Start(ctx, "SongUseCase.GetSongs")
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	logger := logging.FromContext(ctx, s.logger)
+	logger.Infow("Retrieving songs", "filter", filter)
 
 	songs, err := s.Repo.GetSongs(ctx, filter)
 	if err != nil {
-		s.logger.Errorw("Failed to retrieve songs", "filter", filter, "error", err)
+		logger.Errorw("Failed to retrieve songs", "filter", filter, "error", err)
 		return nil, err
 	}
 
-	s.logger.Infow("Successfully retrieved songs", "count", len(songs))
+	logger.Infow("Successfully retrieved songs", "count", len(songs))
 	return songs, nil
 }
 
-func (s *SongUseCase) GetSongText(ctx context.Context, songID int) ([]string, error) {
-	s.logger.Infow("Retrieving song text", "songID", songID)
+func (s *SongUseCase) GetSongText(ctx context.Context, songID int) (_ []string, err error) {
+	ctx, span := tracing.Start(ctx, "SongUseCase.GetSongText", attribute.Int("song.id", songID))
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	logger := logging.FromContext(ctx, s.logger)
+	logger.Infow("Retrieving song text", "songID", songID)
 
 	text, err := s.Repo.GetSongText(ctx, songID)
 	if err != nil {
-		s.logger.Errorw("Failed to retrieve song text", "songID", songID, "error", err)
+		logger.Errorw("Failed to retrieve song text", "songID", songID, "error", err)
 		return nil, err
 	}
 
-	s.logger.Infow("Successfully retrieved song text", "songID", songID, "parts", len(text))
+	logger.Infow("Successfully retrieved song text", "songID", songID, "parts", len(text))
 	return text, nil
 }
+
+// authorize enforces the ownership policy: editors and admins may modify any
+// song, everyone else only the songs they created.
+func (s *SongUseCase) authorize(ctx context.Context, songID int) (auth.Principal, error) {
+	logger := logging.FromContext(ctx, s.logger)
+
+	existing, err := s.Repo.GetSong(ctx, songID)
+	if err != nil {
+		logger.Errorw("Failed to load song for policy check", "songID", songID, "error", err)
+		return auth.Principal{}, err
+	}
+	return s.checkPolicy(ctx, existing)
+}
+
+func (s *SongUseCase) checkPolicy(ctx context.Context, song models.Song) (auth.Principal, error) {
+	principal, ok := auth.PrincipalFrom(ctx)
+	if !ok {
+		return auth.Principal{}, models.ErrForbidden
+	}
+	if principal.HasScope(auth.ScopeAdmin) || principal.HasRole(auth.RoleEditor) {
+		return principal, nil
+	}
+	if principal.UserID == 0 || song.CreatedBy == nil || *song.CreatedBy != principal.UserID {
+		logging.FromContext(ctx, s.logger).Warnw("Song modification denied", "songID", song.ID, "userID", principal.UserID)
+		return auth.Principal{}, models.ErrForbidden
+	}
+	return principal, nil
+}
@@ -2,14 +2,28 @@ package song
 
 import (
 	"context"
+	"song-lib/internal/externalAPI"
 	"song-lib/internal/models"
 )
 
 type Repository interface {
 	Exist(ctx context.Context, songID int) bool
+	GetSong(ctx context.Context, songID int) (models.Song, error)
 	GetSongs(ctx context.Context, filter models.SongFilter) ([]models.Song, error)
 	GetSongText(ctx context.Context, songID int) ([]string, error)
 	CreateSong(ctx context.Context, song models.Song) error
 	ChangeSong(ctx context.Context, song models.Song) error
 	DeleteSong(ctx context.Context, songID int) error
+	GetDeletedSong(ctx context.Context, songID int) (models.Song, error)
+	RestoreSong(ctx context.Context, song models.Song) error
+}
+
+// Transactor runs fn as one unit of work: repository calls made with the ctx
+// passed to fn share a transaction. fn may run more than once.
+type Transactor interface {
+	WithTx(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+type DetailsProvider interface {
+	GetSongDetails(ctx context.Context, artist, title string) (*externalAPI.SongDetails, error)
 }
@@ -0,0 +1,125 @@
+package usecase_test
+
+import (
+	"context"
+	"errors"
+	"go.uber.org/zap"
+	"song-lib/internal/auth"
+	"song-lib/internal/models"
+	"song-lib/internal/repository/memory"
+	"song-lib/internal/repository/repotest"
+	"song-lib/internal/usecase"
+	"testing"
+)
+
+type fixture struct {
+	songs *usecase.SongUseCase
+	users map[string]auth.Principal
+}
+
+// newFixture registers a contributor alice, who owns the song it returns,
+// another contributor bob and an editor eve.
+func newFixture(t *testing.T) (fixture, int) {
+	t.Helper()
+
+	memoryDB := memory.NewDB()
+	userRepo := memory.NewUserRepo(memoryDB, zap.NewNop().Sugar())
+	f := fixture{
+		songs: usecase.NewSongInstance(memory.NewSongRepo(memoryDB, zap.NewNop().Sugar()), memory.NewTxManager(memoryDB), repotest.StubDetails{}, zap.NewNop().Sugar()),
+		users: make(map[string]auth.Principal),
+	}
+	for subject, role := range map[string]string{"alice": auth.RoleContributor, "bob": auth.RoleContributor, "eve": auth.RoleEditor} {
+		user, err := userRepo.UpsertUser(context.Background(), models.User{Subject: subject, Name: subject, Role: role})
+		if err != nil {
+			t.Fatalf("UpsertUser: %v", err)
+		}
+		f.users[subject] = auth.Principal{Subject: subject, UserID: user.ID, Roles: []string{role}, Scopes: auth.ScopesForRoles([]string{role})}
+	}
+
+	ctx := f.as("alice")
+	if err := f.songs.AddSong(ctx, "Muse", "Hysteria"); err != nil {
+		t.Fatalf("AddSong: %v", err)
+	}
+	songs, err := f.songs.GetSongs(ctx, models.SongFilter{Title: "Hysteria"})
+	if err != nil || len(songs) != 1 {
+		t.Fatalf("GetSongs = %v, %v", songs, err)
+	}
+	if songs[0].CreatedBy == nil || *songs[0].CreatedBy != f.users["alice"].UserID {
+		t.Fatalf("song created by %v, want alice", songs[0].CreatedBy)
+	}
+	return f, songs[0].ID
+}
+
+func (f fixture) as(subject string) context.Context {
+	return auth.WithPrincipal(context.Background(), f.users[subject])
+}
+
+func TestSongPolicy(t *testing.T) {
+	admin := auth.Principal{Subject: "key:1", Scopes: []string{auth.ScopeAdmin}}
+	// An API key with write scope but no user behind it owns nothing.
+	keyWithoutUser := auth.Principal{Subject: "key:2", Scopes: []string{auth.ScopeSongsRead, auth.ScopeSongsWrite, auth.ScopeSongsDelete}}
+
+	for name, tc := range map[string]struct {
+		ctx  func(f fixture) context.Context
+		want error
+	}{
+		"Owner":       {ctx: func(f fixture) context.Context { return f.as("alice") }},
+		"OtherUser":   {ctx: func(f fixture) context.Context { return f.as("bob") }, want: models.ErrForbidden},
+		"Editor":      {ctx: func(f fixture) context.Context { return f.as("eve") }},
+		"Admin":       {ctx: func(fixture) context.Context { return auth.WithPrincipal(context.Background(), admin) }},
+		"NoUserID":    {ctx: func(fixture) context.Context { return auth.WithPrincipal(context.Background(), keyWithoutUser) }, want: models.ErrForbidden},
+		"NoPrincipal": {ctx: func(fixture) context.Context { return context.Background() }, want: models.ErrForbidden},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Run("Change", func(t *testing.T) {
+				f, songID := newFixture(t)
+				ctx := tc.ctx(f)
+
+				err := f.songs.ChangeSong(ctx, models.Song{ID: songID, Artist: "Muse", Title: "Hysteria", Text: "changed"})
+				if !errors.Is(err, tc.want) {
+					t.Fatalf("ChangeSong error = %v, want %v", err, tc.want)
+				}
+				text, _ := f.songs.GetSongText(ctx, songID)
+				if changed := len(text) == 1 && text[0] == "changed"; changed != (tc.want == nil) {
+					t.Errorf("text after ChangeSong = %q", text)
+				}
+			})
+
+			t.Run("DeleteAndRestore", func(t *testing.T) {
+				f, songID := newFixture(t)
+				ctx := tc.ctx(f)
+
+				if err := f.songs.DeleteSong(ctx, songID); !errors.Is(err, tc.want) {
+					t.Fatalf("DeleteSong error = %v, want %v", err, tc.want)
+				}
+				if exists := f.songs.Exist(ctx, songID); exists != (tc.want != nil) {
+					t.Fatalf("Exist after DeleteSong = %v", exists)
+				}
+				if tc.want != nil {
+					// Restoring checks the owner recorded in the deleted song.
+					if err := f.songs.DeleteSong(f.as("alice"), songID); err != nil {
+						t.Fatalf("DeleteSong by the owner: %v", err)
+					}
+				}
+				if err := f.songs.RestoreSong(ctx, songID); !errors.Is(err, tc.want) {
+					t.Errorf("RestoreSong error = %v, want %v", err, tc.want)
+				}
+			})
+		})
+	}
+}
+
+func TestChangeSongRecordsEditor(t *testing.T) {
+	f, songID := newFixture(t)
+
+	if err := f.songs.ChangeSong(f.as("eve"), models.Song{ID: songID, Artist: "Muse", Title: "Hysteria", Text: "changed"}); err != nil {
+		t.Fatalf("ChangeSong: %v", err)
+	}
+	songs, err := f.songs.GetSongs(context.Background(), models.SongFilter{Title: "Hysteria"})
+	if err != nil || len(songs) != 1 {
+		t.Fatalf("GetSongs = %v, %v", songs, err)
+	}
+	if got := songs[0]; got.UpdatedBy == nil || *got.UpdatedBy != f.users["eve"].UserID || *got.CreatedBy != f.users["alice"].UserID {
+		t.Errorf("song = %+v, want created by alice and updated by eve", got)
+	}
+}
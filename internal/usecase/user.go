@@ -0,0 +1,69 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"go.uber.org/zap"
+	"song-lib/internal/auth"
+	"song-lib/internal/logging"
+	"song-lib/internal/models"
+	"song-lib/internal/usecase/user"
+)
+
+type UserUseCase struct {
+	Repo   user.Repository
+	logger *zap.SugaredLogger
+}
+
+func NewUserInstance(repo user.Repository, logger *zap.SugaredLogger) *UserUseCase {
+	return &UserUseCase{Repo: repo, logger: logger}
+}
+
+// Resolve registers the authenticated principal as a user and fills in its
+// user ID and role. API keys keep their own scopes and get the role implied
+// by them; token roles override the stored role, which is used only when
+// the token carries none.
+func (u *UserUseCase) Resolve(ctx context.Context, principal auth.Principal) (auth.Principal, error) {
+	logger := logging.FromContext(ctx, u.logger)
+
+	role := auth.HighestRole(principal.Roles)
+	if principal.KeyID != 0 {
+		role = auth.RoleForScopes(principal.Scopes)
+	}
+
+	stored, err := u.Repo.UpsertUser(ctx, models.User{Subject: principal.Subject, Name: principal.Name, Role: role})
+	if err != nil {
+		logger.Errorw("Failed to register user", "subject", principal.Subject, "error", err)
+		return auth.Principal{}, err
+	}
+
+	principal.UserID = stored.ID
+	principal.Roles = []string{stored.Role}
+	if principal.KeyID == 0 {
+		principal.Scopes = auth.ScopesForRoles(principal.Roles)
+	}
+	return principal, nil
+}
+
+func (u *UserUseCase) GetUser(ctx context.Context, userID int) (models.User, error) {
+	return u.Repo.GetUser(ctx, userID)
+}
+
+func (u *UserUseCase) ListUsers(ctx context.Context) ([]models.User, error) {
+	return u.Repo.ListUsers(ctx)
+}
+
+func (u *UserUseCase) SetRole(ctx context.Context, subject, role string) error {
+	logger := logging.FromContext(ctx, u.logger)
+
+	if !auth.IsRole(role) {
+		return fmt.Errorf("unknown role %q, expected one of %v", role, auth.Roles)
+	}
+	if err := u.Repo.SetRole(ctx, subject, role); err != nil {
+		logger.Errorw("Failed to set user role", "subject", subject, "role", role, "error", err)
+		return err
+	}
+
+	logger.Infow("User role changed", "subject", subject, "role", role)
+	return nil
+}
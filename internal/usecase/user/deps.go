@@ -0,0 +1,13 @@
+package user
+
+import (
+	"context"
+	"song-lib/internal/models"
+)
+
+type Repository interface {
+	UpsertUser(ctx context.Context, user models.User) (models.User, error)
+	GetUser(ctx context.Context, userID int) (models.User, error)
+	ListUsers(ctx context.Context) ([]models.User, error)
+	SetRole(ctx context.Context, subject, role string) error
+}
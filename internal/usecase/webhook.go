@@ -0,0 +1,162 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"net/url"
+	"slices"
+	"song-lib/internal/auth"
+	"song-lib/internal/logging"
+	"song-lib/internal/models"
+	"song-lib/internal/usecase/webhook"
+	"strings"
+	"time"
+)
+
+type WebhookUseCase struct {
+	Repo   webhook.Repository
+	logger *zap.SugaredLogger
+}
+
+func NewWebhookInstance(repo webhook.Repository, logger *zap.SugaredLogger) *WebhookUseCase {
+	return &WebhookUseCase{Repo: repo, logger: logger}
+}
+
+// CreateWebhook generates the signing secret of the webhook and returns it
+// in Secret; later reads leave Secret empty.
+func (w *WebhookUseCase) CreateWebhook(ctx context.Context, hook models.Webhook) (models.Webhook, error) {
+	logger := logging.FromContext(ctx, w.logger)
+
+	hook, err := normalizeWebhook(hook)
+	if err != nil {
+		return models.Webhook{}, err
+	}
+
+	hook.Secret, err = auth.GenerateWebhookSecret()
+	if err != nil {
+		logger.Errorw("Failed to generate webhook secret", "error", err)
+		return models.Webhook{}, err
+	}
+
+	created, err := w.Repo.CreateWebhook(ctx, hook)
+	if err != nil {
+		logger.Errorw("Failed to store webhook", "url", hook.URL, "error", err)
+		return models.Webhook{}, err
+	}
+
+	logger.Infow("Webhook created", "webhookID", created.ID, "url", created.URL, "events", created.Events)
+	return created, nil
+}
+
+func (w *WebhookUseCase) GetWebhook(ctx context.Context, webhookID int) (models.Webhook, error) {
+	hook, err := w.Repo.GetWebhook(ctx, webhookID)
+	hook.Secret = ""
+	return hook, err
+}
+
+func (w *WebhookUseCase) ListWebhooks(ctx context.Context) ([]models.Webhook, error) {
+	hooks, err := w.Repo.ListWebhooks(ctx)
+	for i := range hooks {
+		hooks[i].Secret = ""
+	}
+	return hooks, err
+}
+
+// UpdateWebhook replaces the subscription of a webhook and keeps its secret.
+func (w *WebhookUseCase) UpdateWebhook(ctx context.Context, hook models.Webhook) (models.Webhook, error) {
+	logger := logging.FromContext(ctx, w.logger)
+
+	hook, err := normalizeWebhook(hook)
+	if err != nil {
+		return models.Webhook{}, err
+	}
+
+	updated, err := w.Repo.UpdateWebhook(ctx, hook)
+	if err != nil {
+		if !errors.Is(err, models.ErrWebhookNotFound) {
+			logger.Errorw("Failed to update webhook", "webhookID", hook.ID, "error", err)
+		}
+		return models.Webhook{}, err
+	}
+
+	logger.Infow("Webhook updated", "webhookID", updated.ID, "url", updated.URL, "events", updated.Events, "active", updated.Active)
+	updated.Secret = ""
+	return updated, nil
+}
+
+// DeleteWebhook deletes the webhook along with its deliveries.
+func (w *WebhookUseCase) DeleteWebhook(ctx context.Context, webhookID int) error {
+	logger := logging.FromContext(ctx, w.logger)
+
+	if err := w.Repo.DeleteWebhook(ctx, webhookID); err != nil {
+		if !errors.Is(err, models.ErrWebhookNotFound) {
+			logger.Errorw("Failed to delete webhook", "webhookID", webhookID, "error", err)
+		}
+		return err
+	}
+
+	logger.Infow("Webhook deleted", "webhookID", webhookID)
+	return nil
+}
+
+func (w *WebhookUseCase) ListDeliveries(ctx context.Context, filter models.DeliveryFilter) ([]models.WebhookDelivery, error) {
+	if _, err := w.Repo.GetWebhook(ctx, filter.WebhookID); err != nil {
+		return nil, err
+	}
+	return w.Repo.ListDeliveries(ctx, filter)
+}
+
+func (w *WebhookUseCase) Redeliver(ctx context.Context, webhookID int, deliveryID int64) (models.WebhookDelivery, error) {
+	logger := logging.FromContext(ctx, w.logger)
+
+	delivery, err := w.Repo.Redeliver(ctx, webhookID, deliveryID)
+	if err != nil {
+		if !errors.Is(err, models.ErrDeliveryNotFound) {
+			logger.Errorw("Failed to redeliver webhook delivery", "webhookID", webhookID, "deliveryID", deliveryID, "error", err)
+		}
+		return models.WebhookDelivery{}, err
+	}
+
+	logger.Infow("Webhook delivery queued again", "webhookID", webhookID, "deliveryID", deliveryID)
+	return delivery, nil
+}
+
+// PurgeDeliveries deletes finished deliveries older than retention.
+func (w *WebhookUseCase) PurgeDeliveries(ctx context.Context, retention time.Duration) (int64, error) {
+	return w.Repo.DeleteDeliveriesBefore(ctx, time.Now().Add(-retention))
+}
+
+func normalizeWebhook(hook models.Webhook) (models.Webhook, error) {
+	hook.Name = strings.TrimSpace(hook.Name)
+
+	target, err := url.Parse(hook.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return models.Webhook{}, fmt.Errorf("%w: url must be an absolute http(s) URL", models.ErrInvalidWebhook)
+	}
+
+	if len(hook.Events) == 0 {
+		return models.Webhook{}, fmt.Errorf("%w: at least one event is required", models.ErrInvalidWebhook)
+	}
+	var events []string
+	for _, event := range hook.Events {
+		if !slices.Contains(models.WebhookEvents, event) {
+			return models.Webhook{}, fmt.Errorf("%w: unknown event %q, expected one of %v",
+				models.ErrInvalidWebhook, event, models.WebhookEvents)
+		}
+		if !slices.Contains(events, event) {
+			events = append(events, event)
+		}
+	}
+	hook.Events = events
+
+	artists := []string{}
+	for _, artist := range hook.Artists {
+		if artist = strings.TrimSpace(artist); artist != "" && !slices.Contains(artists, artist) {
+			artists = append(artists, artist)
+		}
+	}
+	hook.Artists = artists
+	return hook, nil
+}
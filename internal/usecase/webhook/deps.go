@@ -0,0 +1,22 @@
+package webhook
+
+import (
+	"context"
+	"song-lib/internal/models"
+	"time"
+)
+
+type Repository interface {
+	CreateWebhook(ctx context.Context, webhook models.Webhook) (models.Webhook, error)
+	GetWebhook(ctx context.Context, webhookID int) (models.Webhook, error)
+	ListWebhooks(ctx context.Context) ([]models.Webhook, error)
+	UpdateWebhook(ctx context.Context, webhook models.Webhook) (models.Webhook, error)
+	DeleteWebhook(ctx context.Context, webhookID int) error
+	ListDeliveries(ctx context.Context, filter models.DeliveryFilter) ([]models.WebhookDelivery, error)
+	// Redeliver queues a delivery for an immediate attempt with a fresh
+	// budget of attempts, whatever its status.
+	Redeliver(ctx context.Context, webhookID int, deliveryID int64) (models.WebhookDelivery, error)
+	// DeleteDeliveriesBefore deletes delivered and dead deliveries created
+	// before the given time.
+	DeleteDeliveriesBefore(ctx context.Context, before time.Time) (int64, error)
+}
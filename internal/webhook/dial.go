@@ -0,0 +1,58 @@
+package webhook
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/netip"
+	"slices"
+	"syscall"
+	"time"
+)
+
+// ErrInternalAddress is returned for a webhook that resolves to an address
+// of this host or its network.
+var ErrInternalAddress = errors.New("webhook address is not public")
+
+// internalPrefixes are the ranges not covered by the netip.Addr methods:
+// "this network", which Linux connects to locally, and carrier-grade NAT.
+var internalPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+}
+
+// newTransport returns the transport of the delivery client. Unless
+// allowInternal is set, it refuses to connect to loopback, private,
+// link-local (cloud metadata services among them) and unspecified addresses.
+// The check runs on the resolved address of every connection, redirects
+// included, so a public name pointing inside cannot get around it.
+func newTransport(allowInternal bool) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if allowInternal {
+		return transport
+	}
+
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second, Control: checkAddress}
+	transport.DialContext = dialer.DialContext
+	// A proxy would be dialled instead of the webhook.
+	transport.Proxy = nil
+	return transport
+}
+
+func checkAddress(_, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	if !isPublic(addrPort.Addr()) {
+		return ErrInternalAddress
+	}
+	return nil
+}
+
+func isPublic(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return !addr.IsLoopback() && !addr.IsPrivate() && !addr.IsLinkLocalUnicast() && !addr.IsMulticast() &&
+		!addr.IsUnspecified() &&
+		!slices.ContainsFunc(internalPrefixes, func(prefix netip.Prefix) bool { return prefix.Contains(addr) })
+}
@@ -0,0 +1,248 @@
+// Package webhook delivers song changes to the partner endpoints subscribed
+// through /api/webhooks.
+//
+// The Dispatcher is an outbox Sink: for every relayed event it queues a
+// delivery per matching webhook, once per webhook however often the relay
+// retries the event. Deliver then POSTs the due deliveries, signed with the
+// secret of their webhook, and reschedules failures with exponential backoff
+// until they are delivered or run out of attempts and are dead-lettered.
+// Retries can overtake later events, so receivers order by event ID.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+	"song-lib/internal/auth"
+	"song-lib/internal/logging"
+	"song-lib/internal/models"
+	"song-lib/internal/outbox"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	HeaderDeliveryID = "X-Songlib-Delivery-Id"
+	HeaderSignature  = "X-Songlib-Signature"
+)
+
+// Store is the webhook and delivery tables of the configured storage.
+type Store interface {
+	// ActiveWebhooks returns the enabled webhooks with their secrets.
+	ActiveWebhooks(ctx context.Context) ([]models.Webhook, error)
+	// Enqueue stores pending deliveries due now, skipping those already
+	// queued for the same webhook and event.
+	Enqueue(ctx context.Context, deliveries ...models.WebhookDelivery) error
+	// Claim returns up to limit pending deliveries of active webhooks that
+	// are due, and postpones them by lease so that other replicas leave them
+	// alone while they are attempted.
+	Claim(ctx context.Context, limit int, lease time.Duration) ([]models.WebhookDelivery, error)
+	RecordAttempt(ctx context.Context, attempt models.DeliveryAttempt) error
+}
+
+type Options struct {
+	BatchSize      int
+	Workers        int
+	Timeout        time.Duration
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// AllowInternal lets webhooks point at loopback and private addresses,
+	// for local development.
+	AllowInternal bool
+}
+
+type Stats struct {
+	Delivered int64  `json:"delivered"`
+	Failed    int64  `json:"failed"`
+	Dead      int64  `json:"dead"`
+	LastError string `json:"last_error,omitempty"`
+}
+
+type Dispatcher struct {
+	store  Store
+	opts   Options
+	client *http.Client
+	logger *zap.SugaredLogger
+
+	delivered atomic.Int64
+	failed    atomic.Int64
+	dead      atomic.Int64
+	lastError atomic.Pointer[string]
+}
+
+func NewDispatcher(store Store, opts Options, logger *zap.SugaredLogger) *Dispatcher {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 100
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = 1
+	}
+	return &Dispatcher{
+		store:  store,
+		opts:   opts,
+		client: &http.Client{Timeout: opts.Timeout, Transport: newTransport(opts.AllowInternal)},
+		logger: logger,
+	}
+}
+
+func (d *Dispatcher) Stats() Stats {
+	stats := Stats{Delivered: d.delivered.Load(), Failed: d.failed.Load(), Dead: d.dead.Load()}
+	if msg := d.lastError.Load(); msg != nil {
+		stats.LastError = *msg
+	}
+	return stats
+}
+
+// Publish queues event for every webhook subscribed to it.
+func (d *Dispatcher) Publish(ctx context.Context, event models.OutboxEvent) error {
+	hooks, err := d.store.ActiveWebhooks(ctx)
+	if err != nil {
+		return err
+	}
+
+	var deliveries []models.WebhookDelivery
+	for _, hook := range hooks {
+		if !hook.Matches(event) {
+			continue
+		}
+		payload, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		deliveries = append(deliveries, models.WebhookDelivery{
+			WebhookID: hook.ID,
+			EventID:   event.ID,
+			EventType: event.Type,
+			Payload:   payload,
+		})
+	}
+	if len(deliveries) == 0 {
+		return nil
+	}
+	return d.store.Enqueue(ctx, deliveries...)
+}
+
+// Deliver attempts the deliveries that are due, Workers at a time, and
+// returns how many succeeded.
+func (d *Dispatcher) Deliver(ctx context.Context) (int, error) {
+	deliveries, err := d.store.Claim(ctx, d.opts.BatchSize, d.lease())
+	if err != nil || len(deliveries) == 0 {
+		return 0, err
+	}
+
+	hooks, err := d.store.ActiveWebhooks(ctx)
+	if err != nil {
+		return 0, err
+	}
+	byID := make(map[int]models.Webhook, len(hooks))
+	for _, hook := range hooks {
+		byID[hook.ID] = hook
+	}
+
+	var delivered atomic.Int64
+	jobs := make(chan models.WebhookDelivery)
+	var wg sync.WaitGroup
+	for range min(d.opts.Workers, len(deliveries)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for delivery := range jobs {
+				// A webhook disabled since the claim keeps its deliveries
+				// pending until it is enabled again.
+				hook, ok := byID[delivery.WebhookID]
+				if ok && d.attempt(ctx, hook, delivery) {
+					delivered.Add(1)
+				}
+			}
+		}()
+	}
+	for _, delivery := range deliveries {
+		jobs <- delivery
+	}
+	close(jobs)
+	wg.Wait()
+
+	return int(delivered.Load()), nil
+}
+
+// lease covers a whole batch going through the workers at the slowest.
+func (d *Dispatcher) lease() time.Duration {
+	rounds := (d.opts.BatchSize + d.opts.Workers - 1) / d.opts.Workers
+	return time.Duration(rounds+1) * d.opts.Timeout
+}
+
+// Backoff returns the delay before the attempt that follows attempts failed
+// ones: InitialBackoff doubled with every failure, up to MaxBackoff.
+func (d *Dispatcher) Backoff(attempts int) time.Duration {
+	delay := d.opts.InitialBackoff
+	for i := 1; i < attempts && delay < d.opts.MaxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, d.opts.MaxBackoff)
+}
+
+func (d *Dispatcher) attempt(ctx context.Context, hook models.Webhook, delivery models.WebhookDelivery) bool {
+	logger := logging.FromContext(ctx, d.logger).With("webhookID", hook.ID, "deliveryID", delivery.ID,
+		"eventID", delivery.EventID, "attempt", delivery.Attempts+1)
+
+	attempt := models.DeliveryAttempt{DeliveryID: delivery.ID, AttemptedAt: time.Now()}
+	attempt.ResponseStatus, attempt.Error = d.post(ctx, hook, delivery, attempt.AttemptedAt)
+
+	switch attempts := delivery.Attempts + 1; {
+	case attempt.Error == "":
+		attempt.Status = models.DeliveryDelivered
+		d.delivered.Add(1)
+		logger.Debugw("Webhook delivered", "status", attempt.ResponseStatus)
+	case attempts >= d.opts.MaxAttempts:
+		attempt.Status = models.DeliveryDead
+		d.dead.Add(1)
+		d.lastError.Store(&attempt.Error)
+		logger.Warnw("Webhook delivery is dead after running out of attempts", "url", hook.URL, "error", attempt.Error)
+	default:
+		attempt.Status = models.DeliveryPending
+		next := attempt.AttemptedAt.Add(d.Backoff(attempts))
+		attempt.NextAttemptAt = &next
+		d.failed.Add(1)
+		d.lastError.Store(&attempt.Error)
+		logger.Infow("Webhook delivery failed, will retry", "url", hook.URL, "nextAttemptAt", next, "error", attempt.Error)
+	}
+
+	if err := d.store.RecordAttempt(ctx, attempt); err != nil {
+		// The lease runs out and the delivery is attempted again.
+		logger.Warnw("Failed to record webhook delivery attempt", "error", err)
+	}
+	return attempt.Status == models.DeliveryDelivered
+}
+
+// post sends the delivery and returns the response status and, unless the
+// webhook answered 2xx, what went wrong.
+func (d *Dispatcher) post(ctx context.Context, hook models.Webhook, delivery models.WebhookDelivery, at time.Time) (int, string) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err.Error()
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(outbox.HeaderEventID, strconv.FormatInt(delivery.EventID, 10))
+	req.Header.Set(outbox.HeaderEventType, delivery.EventType)
+	req.Header.Set(HeaderDeliveryID, strconv.FormatInt(delivery.ID, 10))
+	req.Header.Set(HeaderSignature, auth.SignWebhook(hook.Secret, at, delivery.Payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err.Error()
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Sprintf("webhook responded with %s", resp.Status)
+	}
+	return resp.StatusCode, ""
+}
@@ -0,0 +1,262 @@
+package webhook_test
+
+import (
+	"context"
+	"encoding/json"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"song-lib/internal/auth"
+	"song-lib/internal/models"
+	"song-lib/internal/outbox"
+	"song-lib/internal/repository/memory"
+	"song-lib/internal/usecase"
+	"song-lib/internal/webhook"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// receiver is a webhook endpoint like cmd/mockreceiver: it checks the
+// signature of every delivery and answers with status, or 401 for a bad
+// signature.
+type receiver struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	secret   string
+	status   int
+	received []*http.Request
+	verified []bool
+}
+
+func newReceiver(t *testing.T) *receiver {
+	t.Helper()
+
+	r := &receiver{status: http.StatusNoContent}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		verified := auth.VerifyWebhook(r.secret, req.Header.Get(webhook.HeaderSignature), body, time.Minute) == nil
+		r.received = append(r.received, req)
+		r.verified = append(r.verified, verified)
+		if !verified {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(r.status)
+	}))
+	t.Cleanup(r.Close)
+	return r
+}
+
+func (r *receiver) verifyWith(secret string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.secret = secret
+}
+
+func (r *receiver) answer(status int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.status = status
+}
+
+func (r *receiver) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.received)
+}
+
+func (r *receiver) last() (*http.Request, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.received[len(r.received)-1], r.verified[len(r.verified)-1]
+}
+
+type fixture struct {
+	webhooks   *usecase.WebhookUseCase
+	dispatcher *webhook.Dispatcher
+	hook       models.Webhook
+}
+
+// newFixture subscribes a webhook at target to song.created and queues a
+// delivery of one event for it.
+func newFixture(t *testing.T, target string, opts webhook.Options) fixture {
+	t.Helper()
+
+	repo := memory.NewWebhookRepo(memory.NewDB(), zap.NewNop().Sugar())
+	webhooks := usecase.NewWebhookInstance(repo, zap.NewNop().Sugar())
+	hook, err := webhooks.CreateWebhook(context.Background(), models.Webhook{
+		Name: "test", URL: target, Events: []string{models.EventSongCreated}, Active: true,
+	})
+	if err != nil {
+		t.Fatalf("CreateWebhook: %v", err)
+	}
+
+	if opts.Timeout == 0 {
+		opts.Timeout = time.Second
+	}
+	dispatcher := webhook.NewDispatcher(repo, opts, zap.NewNop().Sugar())
+	err = dispatcher.Publish(context.Background(), models.OutboxEvent{
+		ID: 7, Type: models.EventSongCreated, SongID: 1, Song: json.RawMessage(`{"group":"Muse","song":"Hysteria"}`),
+	})
+	if err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	return fixture{webhooks: webhooks, dispatcher: dispatcher, hook: hook}
+}
+
+func (f fixture) deliver(t *testing.T) int {
+	t.Helper()
+
+	delivered, err := f.dispatcher.Deliver(context.Background())
+	if err != nil {
+		t.Fatalf("Deliver: %v", err)
+	}
+	return delivered
+}
+
+func (f fixture) delivery(t *testing.T) models.WebhookDelivery {
+	t.Helper()
+
+	deliveries, err := f.webhooks.ListDeliveries(context.Background(), models.DeliveryFilter{WebhookID: f.hook.ID})
+	if err != nil || len(deliveries) != 1 {
+		t.Fatalf("ListDeliveries = %v, %v; want one delivery", deliveries, err)
+	}
+	return deliveries[0]
+}
+
+func TestDeliverSigned(t *testing.T) {
+	r := newReceiver(t)
+	f := newFixture(t, r.URL+"/hook", webhook.Options{MaxAttempts: 3, InitialBackoff: time.Minute, MaxBackoff: time.Minute, AllowInternal: true})
+	r.verifyWith(f.hook.Secret)
+
+	if delivered := f.deliver(t); delivered != 1 {
+		t.Fatalf("Deliver = %d, want 1", delivered)
+	}
+	req, verified := r.last()
+	if !verified {
+		t.Error("receiver could not verify the signature with the webhook secret")
+	}
+	if req.URL.Path != "/hook" || req.Header.Get(outbox.HeaderEventID) != "7" ||
+		req.Header.Get(outbox.HeaderEventType) != models.EventSongCreated ||
+		req.Header.Get(webhook.HeaderDeliveryID) != strconv.FormatInt(f.delivery(t).ID, 10) {
+		t.Errorf("delivery went to %s with headers %v", req.URL.Path, req.Header)
+	}
+	if delivery := f.delivery(t); delivery.Status != models.DeliveryDelivered || delivery.ResponseStatus != http.StatusNoContent {
+		t.Errorf("delivery = %+v, want delivered with 204", delivery)
+	}
+}
+
+func TestDeliverWrongSecret(t *testing.T) {
+	r := newReceiver(t)
+	f := newFixture(t, r.URL, webhook.Options{MaxAttempts: 3, InitialBackoff: time.Minute, MaxBackoff: time.Minute, AllowInternal: true})
+	r.verifyWith("whsec_other")
+
+	if delivered := f.deliver(t); delivered != 0 {
+		t.Fatalf("Deliver = %d, want 0", delivered)
+	}
+	if delivery := f.delivery(t); delivery.Status != models.DeliveryPending || delivery.ResponseStatus != http.StatusUnauthorized {
+		t.Errorf("delivery = %+v, want pending after a 401", delivery)
+	}
+}
+
+func TestDeliverBacksOff(t *testing.T) {
+	r := newReceiver(t)
+	f := newFixture(t, r.URL, webhook.Options{MaxAttempts: 5, InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Minute, AllowInternal: true})
+	r.verifyWith(f.hook.Secret)
+	r.answer(http.StatusInternalServerError)
+
+	for attempt, backoff := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond} {
+		f.deliver(t)
+		delivery := f.delivery(t)
+		if delivery.Attempts != attempt+1 || delivery.Status != models.DeliveryPending {
+			t.Fatalf("delivery after attempt %d = %+v, want it pending", attempt+1, delivery)
+		}
+		if got := delivery.NextAttemptAt.Sub(*delivery.LastAttemptAt); got != backoff {
+			t.Errorf("attempt %d backoff = %v, want %v", attempt+1, got, backoff)
+		}
+
+		// Not due yet.
+		f.deliver(t)
+		if n := r.count(); n != attempt+1 {
+			t.Fatalf("receiver got %d requests before the backoff ran out, want %d", n, attempt+1)
+		}
+		time.Sleep(time.Until(*delivery.NextAttemptAt))
+	}
+	if stats := f.dispatcher.Stats(); stats.Failed != 2 || stats.LastError == "" {
+		t.Errorf("Stats = %+v, want 2 failures", stats)
+	}
+}
+
+func TestDeadAfterMaxAttempts(t *testing.T) {
+	r := newReceiver(t)
+	f := newFixture(t, r.URL, webhook.Options{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond, AllowInternal: true})
+	r.verifyWith(f.hook.Secret)
+	r.answer(http.StatusServiceUnavailable)
+
+	for range 5 {
+		f.deliver(t)
+		time.Sleep(2 * time.Millisecond)
+	}
+	if n := r.count(); n != 3 {
+		t.Errorf("receiver got %d requests, want 3", n)
+	}
+	delivery := f.delivery(t)
+	if delivery.Status != models.DeliveryDead || delivery.NextAttemptAt != nil {
+		t.Fatalf("delivery = %+v, want dead", delivery)
+	}
+	if stats := f.dispatcher.Stats(); stats.Dead != 1 {
+		t.Errorf("Stats = %+v, want 1 dead", stats)
+	}
+
+	r.answer(http.StatusOK)
+	if _, err := f.webhooks.Redeliver(context.Background(), f.hook.ID, delivery.ID); err != nil {
+		t.Fatalf("Redeliver: %v", err)
+	}
+	if delivered := f.deliver(t); delivered != 1 {
+		t.Fatalf("Deliver after Redeliver = %d, want 1", delivered)
+	}
+	if delivery := f.delivery(t); delivery.Status != models.DeliveryDelivered || delivery.Attempts != 1 {
+		t.Errorf("delivery after Redeliver = %+v, want delivered on a fresh first attempt", delivery)
+	}
+}
+
+func TestInternalAddressRefused(t *testing.T) {
+	r := newReceiver(t)
+	port := strings.TrimPrefix(r.URL, "http://127.0.0.1:")
+
+	for _, target := range []string{
+		r.URL,
+		"http://localhost:" + port,
+		"http://[::1]:" + port,
+		"http://[::ffff:127.0.0.1]:" + port,
+		"http://0.0.0.0:" + port,
+		"http://10.0.0.1/",
+		"http://192.168.1.1/",
+		"http://100.64.0.1/",
+		"http://169.254.169.254/latest/meta-data/",
+		"http://[fd00::1]/",
+	} {
+		t.Run(url.PathEscape(target), func(t *testing.T) {
+			f := newFixture(t, target, webhook.Options{MaxAttempts: 3, InitialBackoff: time.Minute, MaxBackoff: time.Minute})
+
+			if delivered := f.deliver(t); delivered != 0 {
+				t.Errorf("Deliver = %d, want 0", delivered)
+			}
+			if delivery := f.delivery(t); !strings.Contains(delivery.LastError, webhook.ErrInternalAddress.Error()) {
+				t.Errorf("delivery error = %q, want %q", delivery.LastError, webhook.ErrInternalAddress)
+			}
+		})
+	}
+	if n := r.count(); n != 0 {
+		t.Errorf("receiver got %d requests, want none", n)
+	}
+}
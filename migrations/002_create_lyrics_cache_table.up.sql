@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS lyrics_cache (
+                       key TEXT PRIMARY KEY,
+                       value BYTEA NOT NULL,
+                       expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS lyrics_cache_expires_at_idx ON lyrics_cache (expires_at);
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS songs_created_by_idx;
+
+ALTER TABLE songs
+    DROP COLUMN IF EXISTS updated_by,
+    DROP COLUMN IF EXISTS created_by;
+
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS users (
+                       id SERIAL PRIMARY KEY,
+                       subject VARCHAR(255) NOT NULL UNIQUE,
+                       name VARCHAR(255) NOT NULL,
+                       role VARCHAR(32) NOT NULL DEFAULT 'viewer',
+                       created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+                       last_seen_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+ALTER TABLE songs
+    ADD COLUMN IF NOT EXISTS created_by INT REFERENCES users (id) ON DELETE SET NULL,
+    ADD COLUMN IF NOT EXISTS updated_by INT REFERENCES users (id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS songs_created_by_idx ON songs (created_by);
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS audit_events (
+                       id BIGSERIAL PRIMARY KEY,
+                       occurred_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+                       action VARCHAR(16) NOT NULL,
+                       song_id INT NOT NULL,
+                       actor_id INT,
+                       actor VARCHAR(255) NOT NULL,
+                       request_id VARCHAR(128) NOT NULL,
+                       client_ip VARCHAR(64) NOT NULL,
+                       before JSONB,
+                       after JSONB
+);
+
+CREATE INDEX IF NOT EXISTS audit_events_song_id_idx ON audit_events (song_id, occurred_at);
+CREATE INDEX IF NOT EXISTS audit_events_actor_idx ON audit_events (actor, occurred_at);
+CREATE INDEX IF NOT EXISTS audit_events_occurred_at_idx ON audit_events (occurred_at);
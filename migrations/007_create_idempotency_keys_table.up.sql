@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+                       subject VARCHAR(255) NOT NULL,
+                       key VARCHAR(255) NOT NULL,
+                       request_hash CHAR(64) NOT NULL,
+                       status INT,
+                       content_type VARCHAR(255),
+                       body BYTEA,
+                       created_at TIMESTAMPTZ NOT NULL,
+                       expires_at TIMESTAMPTZ NOT NULL,
+                       PRIMARY KEY (subject, key)
+);
+
+CREATE INDEX IF NOT EXISTS idempotency_keys_expires_at_idx ON idempotency_keys (expires_at);
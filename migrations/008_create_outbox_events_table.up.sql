@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS outbox_events (
+                       id BIGSERIAL PRIMARY KEY,
+                       occurred_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+                       type VARCHAR(32) NOT NULL,
+                       song_id INT NOT NULL,
+                       song JSONB NOT NULL,
+                       attempts INT NOT NULL DEFAULT 0,
+                       last_error TEXT
+);
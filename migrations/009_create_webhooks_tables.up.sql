@@ -0,0 +1,31 @@
+CREATE TABLE IF NOT EXISTS webhooks (
+                       id SERIAL PRIMARY KEY,
+                       name VARCHAR(255) NOT NULL,
+                       url TEXT NOT NULL,
+                       secret VARCHAR(128) NOT NULL,
+                       events TEXT[] NOT NULL,
+                       artists TEXT[] NOT NULL,
+                       active BOOLEAN NOT NULL DEFAULT true,
+                       created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+                       updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+                       id BIGSERIAL PRIMARY KEY,
+                       webhook_id INT NOT NULL REFERENCES webhooks (id) ON DELETE CASCADE,
+                       event_id BIGINT NOT NULL,
+                       event_type VARCHAR(32) NOT NULL,
+                       payload JSONB NOT NULL,
+                       status VARCHAR(16) NOT NULL,
+                       attempts INT NOT NULL DEFAULT 0,
+                       next_attempt_at TIMESTAMPTZ,
+                       last_attempt_at TIMESTAMPTZ,
+                       response_status INT,
+                       last_error TEXT,
+                       created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+                       delivered_at TIMESTAMPTZ,
+                       UNIQUE (webhook_id, event_id)
+);
+
+CREATE INDEX IF NOT EXISTS webhook_deliveries_due_idx ON webhook_deliveries (next_attempt_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS webhook_deliveries_created_at_idx ON webhook_deliveries (created_at);
@@ -0,0 +1,4 @@
+ALTER TABLE outbox_events ADD COLUMN IF NOT EXISTS next_attempt_at TIMESTAMPTZ;
+ALTER TABLE outbox_events ADD COLUMN IF NOT EXISTS dead_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS outbox_events_song_id_idx ON outbox_events (song_id, id) WHERE dead_at IS NULL;
@@ -0,0 +1,11 @@
+package migrations
+
+import "embed"
+
+//go:embed *.sql
+var FS embed.FS
+
+// SQLite holds the schema for storage: sqlite under sqlite/.
+//
+//go:embed sqlite/*.sql
+var SQLite embed.FS
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS users (
+                       id INTEGER PRIMARY KEY,
+                       subject TEXT NOT NULL UNIQUE,
+                       name TEXT NOT NULL,
+                       role TEXT NOT NULL DEFAULT 'viewer',
+                       created_at TIMESTAMP NOT NULL,
+                       last_seen_at TIMESTAMP NOT NULL
+);
@@ -0,0 +1,35 @@
+CREATE TABLE IF NOT EXISTS songs (
+                       id INTEGER PRIMARY KEY AUTOINCREMENT, -- deleted ids are never reused, see restore
+                       artist TEXT NOT NULL,
+                       title TEXT NOT NULL,
+                       release_date TEXT NOT NULL,
+                       text TEXT NOT NULL,
+                       source_link TEXT NOT NULL,
+                       created_by INTEGER REFERENCES users (id) ON DELETE SET NULL,
+                       updated_by INTEGER REFERENCES users (id) ON DELETE SET NULL,
+                       UNIQUE (artist, title)
+);
+
+CREATE INDEX IF NOT EXISTS songs_created_by_idx ON songs (created_by);
+
+-- The trigram tokenizer matches substrings like the LIKE filter on Postgres,
+-- case_sensitive keeps the same case rules.
+CREATE VIRTUAL TABLE IF NOT EXISTS songs_fts USING fts5(
+    text,
+    content = 'songs',
+    content_rowid = 'id',
+    tokenize = 'trigram case_sensitive 1'
+);
+
+CREATE TRIGGER IF NOT EXISTS songs_fts_insert AFTER INSERT ON songs BEGIN
+    INSERT INTO songs_fts (rowid, text) VALUES (new.id, new.text);
+END;
+
+CREATE TRIGGER IF NOT EXISTS songs_fts_delete AFTER DELETE ON songs BEGIN
+    INSERT INTO songs_fts (songs_fts, rowid, text) VALUES ('delete', old.id, old.text);
+END;
+
+CREATE TRIGGER IF NOT EXISTS songs_fts_update AFTER UPDATE OF text ON songs BEGIN
+    INSERT INTO songs_fts (songs_fts, rowid, text) VALUES ('delete', old.id, old.text);
+    INSERT INTO songs_fts (rowid, text) VALUES (new.id, new.text);
+END;
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS audit_events (
+                       id INTEGER PRIMARY KEY AUTOINCREMENT,
+                       occurred_at TIMESTAMP NOT NULL,
+                       action TEXT NOT NULL,
+                       song_id INTEGER NOT NULL,
+                       actor_id INTEGER,
+                       actor TEXT NOT NULL,
+                       request_id TEXT NOT NULL,
+                       client_ip TEXT NOT NULL,
+                       before TEXT, -- JSON
+                       after TEXT
+);
+
+CREATE INDEX IF NOT EXISTS audit_events_song_id_idx ON audit_events (song_id, occurred_at);
+CREATE INDEX IF NOT EXISTS audit_events_actor_idx ON audit_events (actor, occurred_at);
+CREATE INDEX IF NOT EXISTS audit_events_occurred_at_idx ON audit_events (occurred_at);
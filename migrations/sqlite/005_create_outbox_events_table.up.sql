@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS outbox_events (
+                       id INTEGER PRIMARY KEY AUTOINCREMENT,
+                       occurred_at TIMESTAMP NOT NULL,
+                       type TEXT NOT NULL,
+                       song_id INTEGER NOT NULL,
+                       song TEXT NOT NULL, -- JSON
+                       attempts INTEGER NOT NULL DEFAULT 0,
+                       last_error TEXT
+);
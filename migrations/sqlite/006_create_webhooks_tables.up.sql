@@ -0,0 +1,31 @@
+CREATE TABLE IF NOT EXISTS webhooks (
+                       id INTEGER PRIMARY KEY,
+                       name TEXT NOT NULL,
+                       url TEXT NOT NULL,
+                       secret TEXT NOT NULL,
+                       events TEXT NOT NULL, -- JSON array
+                       artists TEXT NOT NULL, -- JSON array
+                       active BOOLEAN NOT NULL DEFAULT 1,
+                       created_at TIMESTAMP NOT NULL,
+                       updated_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+                       id INTEGER PRIMARY KEY AUTOINCREMENT,
+                       webhook_id INTEGER NOT NULL REFERENCES webhooks (id) ON DELETE CASCADE,
+                       event_id INTEGER NOT NULL,
+                       event_type TEXT NOT NULL,
+                       payload TEXT NOT NULL, -- JSON
+                       status TEXT NOT NULL,
+                       attempts INTEGER NOT NULL DEFAULT 0,
+                       next_attempt_at TIMESTAMP,
+                       last_attempt_at TIMESTAMP,
+                       response_status INTEGER,
+                       last_error TEXT,
+                       created_at TIMESTAMP NOT NULL,
+                       delivered_at TIMESTAMP,
+                       UNIQUE (webhook_id, event_id)
+);
+
+CREATE INDEX IF NOT EXISTS webhook_deliveries_due_idx ON webhook_deliveries (next_attempt_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS webhook_deliveries_created_at_idx ON webhook_deliveries (created_at);
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS outbox_events_song_id_idx;
+
+ALTER TABLE outbox_events DROP COLUMN dead_at;
+ALTER TABLE outbox_events DROP COLUMN next_attempt_at;
@@ -0,0 +1,4 @@
+ALTER TABLE outbox_events ADD COLUMN next_attempt_at TIMESTAMP;
+ALTER TABLE outbox_events ADD COLUMN dead_at TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS outbox_events_song_id_idx ON outbox_events (song_id, id) WHERE dead_at IS NULL;